@@ -50,6 +50,7 @@ func TestAppRestart(t *testing.T) {
 	dbForPut.CreateTable("CREATE TABLE payments (id INT, status STRING, international BOOL)")
 	dbForPut.CreateTable("CREATE TABLE refunds (status STRING, id INT, PRIMARY KEY (id))")
 	buildTestData(dbForPut)
+	dbForPut.Close()
 
 	// new instance created to test for app restart
 	// creating a separate instance is similar to testing for app restart
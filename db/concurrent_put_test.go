@@ -2,10 +2,15 @@ package db
 
 import (
 	"fmt"
+	"path/filepath"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/golang-db/sstable"
+	"github.com/golang-db/wal"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // Run this with go test -race ./...
@@ -40,3 +45,93 @@ func TestDb_ConcurrentPuts(t *testing.T) {
 		}
 	}
 }
+
+// concurrent puts and commits are written to the wal in groups, every one of them must be replayed after a restart
+func TestDb_ConcurrentPutsAndCommitsSurviveRestart(t *testing.T) {
+	dbInstance, config := newDBForWalCommandTest(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				if j%2 == 0 {
+					assert.NoError(t, dbInstance.Put(fmt.Sprintf("key_%d_%d", id, j), fmt.Sprintf("value_%d_%d", id, j)))
+					continue
+				}
+				txn, err := dbInstance.Begin()
+				require.NoError(t, err)
+				assert.NoError(t, txn.Put(fmt.Sprintf("key_%d_%d", id, j), fmt.Sprintf("value_%d_%d", id, j)))
+				assert.NoError(t, txn.Commit())
+			}
+		}(i)
+	}
+	wg.Wait()
+	dbInstance.Close()
+
+	dbAfterRestart, err := NewDB(config)
+	require.NoError(t, err)
+	defer dbAfterRestart.Close()
+	for i := 0; i < 20; i++ {
+		for j := 0; j < 20; j++ {
+			value, err := dbAfterRestart.Get(fmt.Sprintf("key_%d_%d", i, j))
+			require.NoError(t, err)
+			assert.Equal(t, fmt.Sprintf("value_%d_%d", i, j), value)
+		}
+	}
+}
+
+func TestNextWriteGroupIsCappedInBytes(t *testing.T) {
+	db := &DB{}
+	bigRecord := make([]byte, maxGroupCommitBytes/2)
+	db.writeQueue = []*pendingWrite{{walRecord: bigRecord}, {walRecord: bigRecord}, {walRecord: []byte("small")}}
+	assert.Len(t, db.nextWriteGroup(), 2)
+
+	// the leader is always part of the group, even if its record alone crosses the cap
+	db.writeQueue = []*pendingWrite{{walRecord: make([]byte, 2*maxGroupCommitBytes)}, {walRecord: []byte("small")}}
+	assert.Len(t, db.nextWriteGroup(), 1)
+}
+
+// go test -run=^$ -bench=BenchmarkConcurrentPut ./db
+// with SyncAlways the concurrent puts share the fsync of their group commit.
+func benchmarkConcurrentPut(b *testing.B, walConfig wal.Config) {
+	dir := b.TempDir()
+	dbInstance, err := NewDB(Config{
+		SsTableConfig: sstable.Config{
+			DataFilesDirectory: filepath.Join(dir, "sstable"),
+		},
+		WalFilePath: filepath.Join(dir, "wal.log"),
+		WalConfig:   walConfig,
+	})
+	require.NoError(b, err)
+	defer dbInstance.Close()
+
+	var keyId int64
+	var keyIdMu sync.Mutex
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			keyIdMu.Lock()
+			keyId++
+			id := keyId
+			keyIdMu.Unlock()
+			if err := dbInstance.Put(fmt.Sprintf("key_%d", id), fmt.Sprintf("value_%d", id)); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+}
+
+func BenchmarkConcurrentPut_SyncAlways(b *testing.B) {
+	benchmarkConcurrentPut(b, wal.Config{SyncMode: wal.SyncAlways})
+}
+
+func BenchmarkConcurrentPut_SyncEvery10Ms(b *testing.B) {
+	benchmarkConcurrentPut(b, wal.Config{SyncMode: wal.SyncInterval, SyncInterval: 10 * time.Millisecond})
+}
+
+func BenchmarkConcurrentPut_SyncNever(b *testing.B) {
+	benchmarkConcurrentPut(b, wal.Config{SyncMode: wal.SyncNever})
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"log/slog"
+	"slices"
 
 	sqlparser "github.com/golang-db/sql_parser"
 )
@@ -47,9 +49,143 @@ func (db *DB) createTable(createTableInput sqlparser.CreateTable) error {
 	}
 	db.Put(fmt.Sprintf(SecondaryIndexesCatalogKeyTemplate, tableName), string(secondaryIndexCatalogBuf))
 
+	// PERFORM PUT operation with _table_id:[table_name] key, the id prefixes the keys of the rows and indexes
+	if _, ok := db.tableNameVsTableIdMap[tableName]; !ok {
+		db.tableNameVsTableIdMap[tableName] = db.nextTableId
+		db.nextTableId++
+	}
+	db.Put(fmt.Sprintf(TableIdTemplate, tableName), string(binary.BigEndian.AppendUint32(nil, db.tableNameVsTableIdMap[tableName])))
+
 	return nil
 }
 
+// loads the ids of the tables. the tables created before the ids existed have their rows and indexes
+// stored under `table_name:pk_value` and `index:table_name:index_name:col_values:pk_value` keys, which
+// don't sort as per the SQL order of the values. such tables get an id and their keys are rewritten.
+func (db *DB) loadTableIds() error {
+	db.tableNameVsTableIdMap = map[string]uint32{}
+	db.nextTableId = 1
+	legacyTableNames := []string{}
+	for tableName := range db.tableNameVsSchemaMap {
+		tableIdStr, err := db.Get(fmt.Sprintf(TableIdTemplate, tableName))
+		if err != nil {
+			return err
+		}
+		if tableIdStr == "" {
+			legacyTableNames = append(legacyTableNames, tableName)
+			continue
+		}
+		if len(tableIdStr) != 4 {
+			return fmt.Errorf("malformed id of table: '%s'", tableName)
+		}
+		tableId := binary.BigEndian.Uint32([]byte(tableIdStr))
+		db.tableNameVsTableIdMap[tableName] = tableId
+		db.nextTableId = max(db.nextTableId, tableId+1)
+	}
+	// sorted so that the ids don't depend on the map order
+	slices.Sort(legacyTableNames)
+	for _, tableName := range legacyTableNames {
+		if err := db.migrateLegacyTableKeys(tableName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// the legacy keys of a table are rewritten by batches of about this many bytes, as a table can be larger
+// than a single wal record.
+const legacyKeysMigrationBatchBytes = 256 << 10
+
+var errMigrationBatchFull = errors.New("migration batch is full")
+
+// rewrites the rows and the index entries of the table under tuple keys. the rows are moved by batches and
+// each batch deletes the legacy keys of the rows it rewrites, so a crash leaves every row either under its
+// legacy key or under its tuple key with its index entries. the rows left are moved on the next start.
+// the legacy index entries are deleted once all the rows are moved and the id is written last, so the
+// migration is repeated until it completes. the id only depends on the ids of the tables migrated before,
+// hence a repeated migration picks the same id and continues where the crash stopped it.
+func (db *DB) migrateLegacyTableKeys(tableName string) error {
+	tableId := db.nextTableId
+	db.tableNameVsTableIdMap[tableName] = tableId
+	db.nextTableId++
+
+	rowsMigrated := 0
+	err := db.migrateLegacyKeysInBatches(tableName+":", func(batch *WriteBatch, key, value string) error {
+		// the row is encoded again, the legacy rows store INT values with fewer bytes
+		rowValues, err := db.deserializeLegacyRowValues(tableName, value)
+		if err != nil {
+			return err
+		}
+		insertInput := sqlparser.InsertIntoTable{TableName: tableName, ColumnValues: rowValues}
+		rowKey, rowValue, err := db.serialiseInsertIntoTableInput(insertInput)
+		if err != nil {
+			return err
+		}
+		secondaryIndexKeys, err := db.getSecondaryIndexKeys(insertInput)
+		if err != nil {
+			return err
+		}
+		batch.Delete(key)
+		batch.Put(rowKey, string(rowValue))
+		for _, secondaryIndexKey := range secondaryIndexKeys {
+			batch.Put(secondaryIndexKey, "")
+		}
+		rowsMigrated++
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	err = db.migrateLegacyKeysInBatches(fmt.Sprintf(IndexKeyTemplateTableNameIndexNamePrefix, tableName, ""),
+		func(batch *WriteBatch, key, _ string) error {
+			batch.Delete(key)
+			return nil
+		})
+	if err != nil {
+		return err
+	}
+	batch := &WriteBatch{}
+	batch.Put(fmt.Sprintf(TableIdTemplate, tableName), string(binary.BigEndian.AppendUint32(nil, tableId)))
+	slog.Info("MIGRATE_LEGACY_TABLE_KEYS", "table_name", tableName, "table_id", tableId, "rows_migrated", rowsMigrated)
+	return db.Write(batch)
+}
+
+// calls fn for each key with the prefix, fn adds the writes rewriting the key to the batch. the batch is
+// written once it is about legacyKeysMigrationBatchBytes long and the scan continues after the last key
+// it covered.
+func (db *DB) migrateLegacyKeysInBatches(prefix string, fn func(batch *WriteBatch, key, value string) error) error {
+	lower, upper := prefix, prefixUpperBound(prefix)
+	batch := &WriteBatch{}
+	for {
+		batchBytes := 0
+		err := db.rangeScan(lower, upper, nil, func(key, value string) error {
+			if batchBytes >= legacyKeysMigrationBatchBytes {
+				return errMigrationBatchFull
+			}
+			opsBefore := batch.Len()
+			if err := fn(batch, key, value); err != nil {
+				return err
+			}
+			for _, op := range batch.ops[opsBefore:] {
+				batchBytes += op.encodedLength()
+			}
+			lower = key + "\x00"
+			return nil
+		})
+		isBatchFull := errors.Is(err, errMigrationBatchFull)
+		if err != nil && !isBatchFull {
+			return err
+		}
+		if err := db.Write(batch); err != nil {
+			return err
+		}
+		if !isBatchFull {
+			return nil
+		}
+		batch.Reset()
+	}
+}
+
 // serialisation: [number_of_indexes][idx_1_name_len][idx_1_name]
 // [number_of_columns_in_idx_1][col_1_idx_1][col2_idx_2]...
 // column idx is as per the order stored in _schema:[table_name].
@@ -96,7 +232,8 @@ func (db *DB) deserialiseSecondaryIndexCatalog(tableName string, buf []byte, tab
 	if i+4 > len(buf) {
 		return nil, errors.New("unexpected error while reading number of indexes")
 	}
-	secondaryIndexes := []sqlparser.SecondaryIndex{}
+	// nil when the table has no indexes, like the schema the table was created with
+	var secondaryIndexes []sqlparser.SecondaryIndex
 	numIndexes := binary.BigEndian.Uint32(buf[i : i+4])
 	i += 4
 	for j := 0; j < int(numIndexes); j++ {
@@ -4,10 +4,14 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"io"
+	"log/slog"
+	"maps"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/golang-db/memtable"
 	sqlparser "github.com/golang-db/sql_parser"
@@ -19,61 +23,129 @@ const (
 	CatalogKey                               = "_calatog"
 	SecondaryIndexesCatalogKeyTemplate       = "_secondary_indexes:%s"
 	SchemaTemplate                           = "_schema:%s"
+	TableIdTemplate                          = "_table_id:%s"
 	IndexKeyTemplateTableNameIndexNamePrefix = "index:%s:%s"
 	CmdPut                                   = "PUT"
+	CmdDelete                                = "DELETE"
+	CmdSequenced                             = "SEQUENCED"
 )
 
 type LocksAcquired struct {
-	writerTxnId  uint64
-	readerTxnIds []uint64
+	writerTxnId uint64
+	// transactions waiting for the write lock, in the order they asked for it
+	waiters []*lockWaiter
 }
 type transactionManager struct {
 	nextTransactionId     uint64
 	mu                    sync.Mutex
 	keyVsLocksAcquiredMap map[string]*LocksAcquired
+	// transaction id vs the key whose write lock it waits for, the wait-for graph is derived from it
+	txnIdVsAwaitedKeyMap map[uint64]string
+	lockWaitTimeout      time.Duration
 }
 
 type DB struct {
-	mu                   sync.RWMutex
-	wal                  *wal.Wal
-	memTable             *memtable.Memtable
+	mu       sync.RWMutex
+	wal      *wal.SegmentedWal
+	memTable *memtable.Memtable
+	// decides how unreadable wal records are handled while building the memtables on startup
+	walRecoveryMode wal.RecoveryMode
+	// segment id vs what the replay dropped from it on startup, only for the segments which lost records
+	walRecoveryReports map[int]wal.RecoveryReport
+	// full memtables waiting to be flushed, ordered from the oldest to the newest
+	immutableMemTables    []*immutableMemtable
+	maxImmutableMemtables int
+	// signalled whenever a memtable is rotated or flushed and when the db is closed
+	flushCond *sync.Cond
+	// writes waiting to be committed to the wal, the first one is the leader of the next group commit
+	writeQueue []*pendingWrite
+	writeCond  *sync.Cond
+	flushErr   error
+	closed     bool
+	// sequence number of the newest write which is visible to the reads
+	lastSequence atomic.Uint64
+	// sequence number of the next write, guarded by mu
+	nextSequence         uint64
+	snapshots            snapshotList
+	backgroundWg         sync.WaitGroup // tracks the flush loop and the compactions
 	ssTable              *sstable.SsTable
 	tableNameVsSchemaMap map[string]sqlparser.CreateTable
-	transactionManager   transactionManager
+	// ids used by the tuple keys of the rows and index entries of the tables
+	tableNameVsTableIdMap map[string]uint32
+	nextTableId           uint32
+	transactionManager    transactionManager
 }
 
 type Config struct {
 	SsTableConfig sstable.Config
-	WalFilePath   string
+	// WalFilePath is the path prefix of the wal segments, which are named <wal_file_path>.<segment_id>.
+	WalFilePath string
+	// WalConfig decides when the wal is fsynced. Defaults to fsync on every group commit.
+	WalConfig wal.Config
+	// WalRecoveryMode decides how records of the wal which can't be read are handled on startup.
+	// Defaults to wal.RecoveryStrict which fails NewDB.
+	WalRecoveryMode wal.RecoveryMode
+	// MaxImmutableMemtables is the number of full memtables which can wait to be flushed
+	// before writes are stalled. Defaults to 4.
+	MaxImmutableMemtables int
+	// LockWaitTimeout is how long a transaction waits for a write lock held by another transaction.
+	// Defaults to 1 second.
+	LockWaitTimeout time.Duration
 }
 
 func NewDB(config Config) (*DB, error) {
-	db := DB{}
-	wal, err := wal.NewWal(config.WalFilePath)
+	if config.WalFilePath == "" {
+		config.WalFilePath = defaultWalFilePath
+	}
+	if config.MaxImmutableMemtables == 0 {
+		config.MaxImmutableMemtables = defaultMaxImmutableMemtables
+	}
+	if config.LockWaitTimeout == 0 {
+		config.LockWaitTimeout = defaultLockWaitTimeout
+	}
+	db := DB{
+		maxImmutableMemtables: config.MaxImmutableMemtables,
+		walRecoveryMode:       config.WalRecoveryMode,
+		walRecoveryReports:    map[int]wal.RecoveryReport{},
+	}
+	db.flushCond = sync.NewCond(&db.mu)
+	db.writeCond = sync.NewCond(&db.mu)
+	db.snapshots = snapshotList{refCounts: map[uint64]int{}}
+	var err error
+	// the manifest records which wal segments are flushed, hence the sstable is opened before the wal is replayed
+	db.ssTable, err = sstable.NewSsTable(config.SsTableConfig)
 	if err != nil {
 		return nil, err
 	}
-	db.wal = wal
-
-	memTable, err := db.buildMemtableFromWal()
+	db.ssTable.SetLiveSnapshotsFunc(db.liveSnapshots)
+	db.lastSequence.Store(db.ssTable.LastSequence())
+	db.wal, err = wal.NewSegmentedWal(config.WalFilePath, config.WalConfig)
 	if err != nil {
 		return nil, err
 	}
-	db.memTable = memTable
-	db.ssTable, err = sstable.NewSsTable(config.SsTableConfig)
-	if err != nil {
+	if err := db.buildMemtableFromWal(); err != nil {
+		db.wal.Close()
+		db.ssTable.Close()
 		return nil, err
 	}
+	db.nextSequence = db.lastSequence.Load() + 1
+	db.backgroundWg.Add(1)
+	go db.flushLoop()
 
 	db.tableNameVsSchemaMap, err = db.getTableNameVsSchemaMap()
 	if err != nil {
 		return nil, err
 	}
+	if err := db.loadTableIds(); err != nil {
+		return nil, err
+	}
 
 	db.transactionManager = transactionManager{
 		nextTransactionId:     1,
 		mu:                    sync.Mutex{},
 		keyVsLocksAcquiredMap: map[string]*LocksAcquired{},
+		txnIdVsAwaitedKeyMap:  map[uint64]string{},
+		lockWaitTimeout:       config.LockWaitTimeout,
 	}
 
 	return &db, err
@@ -116,62 +188,92 @@ func (db *DB) getTableNameVsSchemaMap() (map[string]sqlparser.CreateTable, error
 	return tableNameVsSchemaMap, nil
 }
 
+// Close flushes the immutable memtables and waits for the running compactions before closing the files.
+// the active memtable is not flushed, it is recovered from the wal on the next start.
 func (db *DB) Close() {
+	db.mu.Lock()
+	if db.closed {
+		db.mu.Unlock()
+		return
+	}
+	db.closed = true
+	db.flushCond.Broadcast()
+	// the leader of a group commit writes to the wal without db.mu
+	for len(db.writeQueue) > 0 {
+		db.writeCond.Wait()
+	}
+	db.mu.Unlock()
+
+	db.backgroundWg.Wait()
 	db.wal.Close()
-	// todo: close all sstable files
+	db.ssTable.Close()
 }
 
+// Get returns the value of the newest committed write of the key.
 func (db *DB) Get(key string) (value string, err error) {
+	return db.GetFromSnapshot(key, nil)
+}
+
+// GetFromSnapshot returns the value of the key as of the snapshot. A nil snapshot reads the newest
+// committed write of the key.
+func (db *DB) GetFromSnapshot(key string, snapshot *Snapshot) (value string, err error) {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
-	value, ok := db.memTable.Get(key)
-	if !ok {
-		value, err = db.ssTable.Get(key)
+	// without a snapshot no write is committed while the read lock is held, hence the versions
+	// visible at the sequence can't be compacted away.
+	sequence, err := snapshot.readSequence(db)
+	if err != nil {
+		return "", err
 	}
-	return value, err
+	return db.getAtSequence(key, sequence)
 }
 
-func (db *DB) createSsTableAndClearWalAndMemTable() error {
-	if err := db.flushMemtableToSsTable(); err != nil {
-		return err
+// returns the value of the newest version of the key written at or before the sequence.
+// an empty value is returned if the key is not found or the version is a tombstone.
+// must be called with db.mu held.
+func (db *DB) getAtSequence(key string, sequence uint64) (string, error) {
+	version, found, err := db.getVersion(key, sequence)
+	if err != nil || !found || version.Tombstone {
+		return "", err
 	}
-	db.memTable.Clear()
-	db.wal.Clear()
-	return nil
+	return version.Value, nil
 }
 
-func (db *DB) Put(key, value string) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
-	if err := db.writeToWal(key, value); err != nil {
-		return errors.New("Something went wrong")
-	}
-	db.memTable.Put(key, value)
-
-	if db.memTable.ShouldFlush() {
-		if err := db.createSsTableAndClearWalAndMemTable(); err != nil {
-			return err
+// returns the newest version of the key written at or before the sequence. must be called with db.mu held.
+func (db *DB) getVersion(key string, sequence uint64) (sstable.Version, bool, error) {
+	// newest memtable to the oldest one
+	memTables := []*memtable.Memtable{db.memTable}
+	for i := len(db.immutableMemTables) - 1; i >= 0; i-- {
+		memTables = append(memTables, db.immutableMemTables[i].memTable)
+	}
+	for _, memTable := range memTables {
+		entry, ok := memTable.Get(key, sequence)
+		if !ok {
+			continue
 		}
+		// a tombstone in the memtable hides the older values present in older memtables and the sstable
+		return sstable.Version{Value: entry.Value, Tombstone: entry.Tombstone, Sequence: entry.Sequence}, true, nil
 	}
-	return nil
+	return db.ssTable.GetVersion(key, sequence)
 }
 
-func (db *DB) flushMemtableToSsTable() error {
-	ssTableFile, err := db.ssTable.NewFile()
+func (db *DB) Put(key, value string) error {
+	err := db.write(serialisePutCommand(key, value), []string{key}, func(memTable *memtable.Memtable, sequence uint64) {
+		memTable.Put(key, value, sequence)
+	})
 	if err != nil {
+		slog.Error("PUT_FAILED", "error", err.Error())
 		return err
 	}
-
-	err = db.ssTable.Write(ssTableFile, db.memTable.Iterate)
-	if db.ssTable.ShouldRunCompaction() {
-		go db.ssTable.RunCompaction()
-	}
-	return err
+	return nil
 }
 
-func (db *DB) writeToWal(key, value string) error {
-	buf := serialisePutCommand(key, value)
-	return db.wal.WriteEntry(buf)
+// Delete removes the key by writing a tombstone. The tombstone is persisted to the sstable on flush
+// and is dropped during compaction once no older file can hold the key.
+func (db *DB) Delete(key string) error {
+	return db.write(serialiseDeleteCommand(key), []string{key}, func(memTable *memtable.Memtable, sequence uint64) {
+		memTable.Delete(key, sequence)
+	})
 }
 
 func appendLengthPrefixedString(buf []byte, value string) []byte {
@@ -202,6 +304,24 @@ func readLengthPrefixedString(buf []byte, offset *int) (string, error) {
 	return value, nil
 }
 
+// the record of every committed write carries its first sequence number:
+// [length_of_command][command="SEQUENCED"][sequence][PUT, DELETE or TRANSACTION command]
+// records written before sequence numbers were added only have the inner command.
+func serialiseSequencedCommand(sequence uint64, command []byte) []byte {
+	buf := appendLengthPrefixedString([]byte{}, CmdSequenced)
+	buf = binary.BigEndian.AppendUint64(buf, sequence)
+	return append(buf, command...)
+}
+
+func readUint64(buf []byte, offset *int) (uint64, error) {
+	if len(buf)-*offset < 8 {
+		return 0, errors.New("malformed WAL command: missing uint64")
+	}
+	value := binary.BigEndian.Uint64(buf[*offset : *offset+8])
+	*offset += 8
+	return value, nil
+}
+
 func serialisePutCommand(key, value string) []byte {
 	buf := []byte{}
 	buf = appendLengthPrefixedString(buf, CmdPut)
@@ -225,58 +345,182 @@ func deserialisePutCommand(buf []byte, offset *int) (key, value string, err erro
 	return key, value, nil
 }
 
-func (db *DB) buildMemtableFromWal() (*memtable.Memtable, error) {
-	memTable := memtable.NewMemtable()
-	for {
-		payload, err := db.wal.ReadEntry()
-		if err == io.EOF {
-			return &memTable, nil
+func serialiseDeleteCommand(key string) []byte {
+	buf := []byte{}
+	buf = appendLengthPrefixedString(buf, CmdDelete)
+	buf = appendLengthPrefixedString(buf, key)
+	return buf
+}
+
+func deserialiseDeleteCommand(buf []byte, offset *int) (key string, err error) {
+	key, err = readLengthPrefixedString(buf, offset)
+	if err != nil {
+		return "", err
+	}
+	if *offset != len(buf) {
+		return "", errors.New("malformed WAL command: unexpected trailing bytes")
+	}
+	return key, nil
+}
+
+// buildMemtableFromWal replays the surviving wal segments from the oldest to the newest one. every segment
+// gets its own memtable: new writes are appended to the newest segment and its memtable, the older
+// memtables are queued to be flushed. segments which are already flushed are removed without a replay.
+// the last sequence is moved forward to the newest replayed write.
+func (db *DB) buildMemtableFromWal() error {
+	segmentIds, err := db.wal.SegmentIds()
+	if err != nil {
+		return err
+	}
+	minUnflushedWalSegmentId := db.ssTable.MinUnflushedWalSegmentId()
+	for _, segmentId := range segmentIds {
+		isActiveSegment := segmentId == db.wal.ActiveSegmentId()
+		// left behind by a crash after the flush was recorded in the manifest but before the segment was removed
+		if segmentId < minUnflushedWalSegmentId && !isActiveSegment {
+			slog.Info("FLUSHED_WAL_SEGMENT_REMOVED", "segment_id", segmentId)
+			if err := db.wal.RemoveSegment(segmentId); err != nil {
+				return err
+			}
+			continue
 		}
-		// for now, I will abort even in case of partial write
-		// todo: in case of partial write we should just truncate that log.
-		// we can also do that as part of listening to signal SIGTERM and SIGKILL?
+		segmentReader, err := db.wal.NewSegmentReader(segmentId)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		memTable, lastSequence, report, err := replayWalSegment(segmentReader, db.walRecoveryMode, db.lastSequence.Load())
+		segmentReader.Close()
+		if err != nil {
+			return err
+		}
+		if report.DroppedTailBytes > 0 || len(report.SkippedRanges) > 0 {
+			skippedBytes := 0
+			for _, skippedRange := range report.SkippedRanges {
+				skippedBytes += skippedRange.Length
+			}
+			slog.Warn("WAL_SEGMENT_RECOVERED_WITH_DATA_LOSS", "segment_id", segmentId,
+				"dropped_tail_bytes", report.DroppedTailBytes, "skipped_ranges_count", len(report.SkippedRanges),
+				"skipped_bytes", skippedBytes)
+			db.walRecoveryReports[segmentId] = report
 		}
+		db.lastSequence.Store(lastSequence)
+		if isActiveSegment {
+			db.memTable = memTable
+			continue
+		}
+		db.immutableMemTables = append(db.immutableMemTables, &immutableMemtable{
+			memTable:     memTable,
+			walSegmentId: segmentId,
+		})
+	}
+	return nil
+}
 
+// WalRecoveryReports returns what the replay of the wal dropped on startup as per the recovery mode, by the
+// id of the segment which lost the records. it is empty if every record was replayed.
+func (db *DB) WalRecoveryReports() map[int]wal.RecoveryReport {
+	return maps.Clone(db.walRecoveryReports)
+}
+
+// replays the segment into a new memtable. records which can't be read are handled as per the recovery mode.
+// records without a sequence number are numbered after lastSequence, which is the sequence number of the
+// newest write replayed so far. returns the sequence number of the newest write after the replay and what the
+// replay dropped from the segment.
+func replayWalSegment(w *wal.Wal, recoveryMode wal.RecoveryMode, lastSequence uint64) (
+	*memtable.Memtable, uint64, wal.RecoveryReport, error) {
+	memTable := memtable.NewMemtable()
+	report, err := w.Replay(recoveryMode, func(payload []byte) error {
 		offset := 0
 		cmd, err := readLengthPrefixedString(payload, &offset)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		sequence := lastSequence + 1
+		if cmd == CmdSequenced {
+			if sequence, err = readUint64(payload, &offset); err != nil {
+				return err
+			}
+			if cmd, err = readLengthPrefixedString(payload, &offset); err != nil {
+				return err
+			}
 		}
 		switch cmd {
 		case CmdPut:
 			key, value, err := deserialisePutCommand(payload, &offset)
 			if err != nil {
-				return nil, err
+				return err
+			}
+			memTable.Put(key, value, sequence)
+			lastSequence = max(lastSequence, sequence)
+		case CmdDelete:
+			key, err := deserialiseDeleteCommand(payload, &offset)
+			if err != nil {
+				return err
 			}
-			memTable.Put(key, value)
+			memTable.Delete(key, sequence)
+			lastSequence = max(lastSequence, sequence)
 		case CmdTransaction:
 			putCmds, err := deserialiseTransactionCommand(payload[offset:])
 			if err != nil {
-				return nil, err
+				return err
+			}
+			// the writes of a transaction use consecutive sequence numbers in the order of the record
+			for i, cmd := range putCmds {
+				memTable.Put(cmd.key, cmd.value, sequence+uint64(i))
+				lastSequence = max(lastSequence, sequence+uint64(i))
 			}
-			for _, cmd := range putCmds {
-				memTable.Put(cmd.key, cmd.value)
+		case CmdBatch:
+			ops, err := deserialiseBatchCommand(payload[offset:])
+			if err != nil {
+				return err
 			}
+			applyBatch(&memTable, ops, sequence)
+			lastSequence = max(lastSequence, sequence+uint64(len(ops))-1)
 		default:
-			return nil, fmt.Errorf("unknown WAL command: %s", cmd)
+			return fmt.Errorf("unknown WAL command: %s", cmd)
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, report, err
 	}
+	return &memTable, lastSequence, report, nil
 }
 
+// Begin starts a transaction which reads the snapshot of the db as of the newest committed write.
+// the reads of the transaction don't take any lock, the writes of other transactions committed after
+// Begin are not visible to it.
 func (db *DB) Begin() (*Transaction, error) {
+	return db.BeginWithIsolation(SnapshotIsolation)
+}
+
+// BeginWithIsolation starts a transaction like Begin at the isolation level. this is the only way to choose
+// the isolation level: the SQL statements and the REPL in main.go don't start transactions.
+func (db *DB) BeginWithIsolation(isolationLevel IsolationLevel) (*Transaction, error) {
 	db.transactionManager.mu.Lock()
 	defer db.transactionManager.mu.Unlock()
 
 	txn := Transaction{
-		id: db.transactionManager.nextTransactionId,
-		db: db,
+		id:             db.transactionManager.nextTransactionId,
+		db:             db,
+		snapshot:       db.acquireSnapshot(),
+		isolationLevel: isolationLevel,
 	}
 	db.transactionManager.nextTransactionId++
 	return &txn, nil
 }
 
+// BeginOptimistic starts a transaction which takes no locks. it reads the same snapshot as a transaction
+// started with Begin and records the version of every key it reads. the commit fails with ErrConflict if
+// a key it read or wrote was updated by another write committed after the transaction saw the key.
+func (db *DB) BeginOptimistic() (*Transaction, error) {
+	txn, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	txn.optimistic = true
+	return txn, nil
+}
+
 func (db *DB) InsertIntoTable(query string) error {
 	parser := sqlparser.NewParser(query)
 	input, err := parser.ParseInsertIntoTable()
@@ -286,29 +530,52 @@ func (db *DB) InsertIntoTable(query string) error {
 	return db.insertIntoTable(*input)
 }
 
-// key: table_name:primary_key_value
-// value: [value1][size_of_value2][value2][value3]
-// value1 and value2 are fixed sized datatype like int and bool while value2 is variable sized
-// datatype like string.
+// key: tuple key of the primary key value, see key_codec.go
+// value: see serialiseRowValues
 // todo: value of primary_key is stored unnecessarily twice (both in key and value)
-// todo: lexicographic ordering is currently as per string: 100 will come before 11. this won't
-// work for SELECT range queries.
 func (db *DB) serialiseInsertIntoTableInput(insertIntoTableInput sqlparser.InsertIntoTable) (
 	key string, valueSchemaBuf []byte, err error) {
 	tableName := insertIntoTableInput.TableName
 	table := db.tableNameVsSchemaMap[tableName]
-	primaryKeyValue := ""
-	for i, columnValue := range insertIntoTableInput.ColumnValues {
-		if i == table.PrimaryKeyColumnPosition {
-			primaryKeyValue = columnValue
-		}
+	valueSchemaBuf, err = db.serialiseRowValues(tableName, insertIntoTableInput.ColumnValues, rowIntLength)
+	if err != nil {
+		return "", nil, err
+	}
+	key, err = db.getRowKey(tableName, insertIntoTableInput.ColumnValues[table.PrimaryKeyColumnPosition])
+	if err != nil {
+		return "", nil, err
+	}
+	return key, valueSchemaBuf, nil
+}
+
+const (
+	// length of an INT in the rows stored under tuple keys
+	rowIntLength = 8
+	// length of an INT in the rows of the tables created before the tables had ids. negative values and
+	// values beyond 32 bits weren't stored correctly by them.
+	legacyRowIntLength = 4
+)
+
+// value: [value1][size_of_value2][value2][value3]
+// value1 and value2 are fixed sized datatype like int and bool while value2 is variable sized
+// datatype like string.
+// an INT is stored as intLength big endian bytes, rowIntLength for the rows under tuple keys. 8 bytes hold
+// every value which the tuple keys can hold, so the keys rebuilt from a row always match its stored keys.
+func (db *DB) serialiseRowValues(tableName string, columnValues []string, intLength int) ([]byte, error) {
+	table := db.tableNameVsSchemaMap[tableName]
+	valueSchemaBuf := []byte{}
+	for i, columnValue := range columnValues {
 		switch table.ColumnDetails[i].DataType {
 		case sqlparser.Int:
-			valueInt, err := strconv.Atoi(columnValue)
+			valueInt, err := strconv.ParseInt(columnValue, 10, 64)
 			if err != nil {
-				return "", nil, err
+				return nil, err
+			}
+			if intLength == legacyRowIntLength {
+				valueSchemaBuf = binary.BigEndian.AppendUint32(valueSchemaBuf, uint32(valueInt))
+			} else {
+				valueSchemaBuf = binary.BigEndian.AppendUint64(valueSchemaBuf, uint64(valueInt))
 			}
-			valueSchemaBuf = binary.BigEndian.AppendUint32(valueSchemaBuf, uint32(valueInt))
 		case sqlparser.String:
 			valueSchemaBuf = binary.BigEndian.AppendUint32(valueSchemaBuf, uint32(len(columnValue)))
 			valueSchemaBuf = append(valueSchemaBuf, []byte(columnValue)...)
@@ -316,16 +583,15 @@ func (db *DB) serialiseInsertIntoTableInput(insertIntoTableInput sqlparser.Inser
 			// only 0, 1 supported and not true, false
 			valueInt, err := strconv.Atoi(columnValue)
 			if err != nil {
-				return "", nil, err
+				return nil, err
 			}
 			if valueInt != 0 && valueInt != 1 {
-				return "", nil, errors.New("only 0 and 1 values supported for BOOL data type")
+				return nil, errors.New("only 0 and 1 values supported for BOOL data type")
 			}
 			valueSchemaBuf = append(valueSchemaBuf, uint8(valueInt))
 		}
 	}
-
-	return fmt.Sprintf("%s:%s", tableName, primaryKeyValue), valueSchemaBuf, nil
+	return valueSchemaBuf, nil
 }
 
 func (db *DB) insertIntoTable(insertIntoTableInput sqlparser.InsertIntoTable) error {
@@ -333,8 +599,19 @@ func (db *DB) insertIntoTable(insertIntoTableInput sqlparser.InsertIntoTable) er
 	if err != nil {
 		return err
 	}
+	if err := db.insertIntoTableInTxn(insertIntoTableInput, txn); err != nil {
+		txn.Rollback()
+		return err
+	}
+	return txn.Commit()
+}
 
-	table := db.tableNameVsSchemaMap[insertIntoTableInput.TableName]
+// writes the row and its secondary index entries as writes of the transaction.
+func (db *DB) insertIntoTableInTxn(insertIntoTableInput sqlparser.InsertIntoTable, txn *Transaction) error {
+	table, ok := db.tableNameVsSchemaMap[insertIntoTableInput.TableName]
+	if !ok {
+		return fmt.Errorf("table with name %q not found", insertIntoTableInput.TableName)
+	}
 	if len(insertIntoTableInput.ColumnValues) != len(table.ColumnDetails) {
 		return errors.New("INSERT INTO requires all columns to be present. ")
 	}
@@ -343,37 +620,67 @@ func (db *DB) insertIntoTable(insertIntoTableInput sqlparser.InsertIntoTable) er
 		return err
 	}
 	if err := txn.Put(key, string(valueSchemaBuf)); err != nil {
-		txn.Rollback()
+		return err
 	}
-
 	// todo: also test for the atomicity in the end-to-end test.
-	err = db.updateSecondaryIndexes(insertIntoTableInput, txn)
+	return db.updateSecondaryIndexes(insertIntoTableInput, txn)
+}
+
+// returns the prefix of the index keys having the values of the leading index columns, which are in the
+// order of the index columns. all the index keys of the table are matched if no value is provided.
+// Key structure: tuple key [table_id][index_id][column_value_1][column_value_2]...[pk_value], see key_codec.go
+func (db *DB) getSecondaryIndexPrefix(tableName string, secondaryIndex sqlparser.SecondaryIndex, columnValues []string) (string, error) {
+	schema := db.tableNameVsSchemaMap[tableName]
+	indexId, err := getSecondaryIndexId(schema, secondaryIndex.IndexName)
 	if err != nil {
-		txn.Rollback()
+		return "", err
 	}
+	dataTypes, err := db.getColumnDataTypes(tableName, secondaryIndex.Columns[:len(columnValues)])
+	if err != nil {
+		return "", err
+	}
+	buf := tupleKeyPrefix(db.tableNameVsTableIdMap[tableName], indexId)
+	for i, columnValue := range columnValues {
+		if buf, err = appendTupleColumn(buf, dataTypes[i], columnValue); err != nil {
+			return "", err
+		}
+	}
+	return string(buf), nil
+}
 
-	txn.Commit()
-
-	return nil
+// returns the index key of the row, the values of all the index columns are followed by the primary key value.
+func (db *DB) getSecondaryIndexKey(tableName string, secondaryIndex sqlparser.SecondaryIndex, columnValues []string, primaryKeyValue string) (string, error) {
+	prefix, err := db.getSecondaryIndexPrefix(tableName, secondaryIndex, columnValues)
+	if err != nil {
+		return "", err
+	}
+	schema := db.tableNameVsSchemaMap[tableName]
+	buf, err := appendTupleColumn([]byte(prefix), schema.ColumnDetails[schema.PrimaryKeyColumnPosition].DataType, primaryKeyValue)
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
 }
 
-// generic function which can be used for both GET (pkColValue not available as found out after prefix)
-// and PUT (pkColValue should always be present) operations
-// Key structure `index:<table_name>:<index_name>:<column_value_1>:<column_value_2>:<pk_value_1>`
-// pk_value_1 would be missing in prefix for GET
-func getSecondaryIndexKeyOrPrefix(tableName, indexName string, columnValues []string, primaryKeyValue string) string {
-	indexKey := fmt.Sprintf(IndexKeyTemplateTableNameIndexNamePrefix, tableName, indexName)
-	indexColValues := ""
-	for _, colValue := range columnValues {
-		indexColValues += (":" + colValue)
+// returns the primary key value which the index key ends with.
+func (db *DB) getPrimaryKeyFromSecondaryIndexKey(tableName string, secondaryIndex sqlparser.SecondaryIndex, indexKey string) (string, error) {
+	dataTypes, err := db.getColumnDataTypes(tableName, secondaryIndex.Columns)
+	if err != nil {
+		return "", err
+	}
+	schema := db.tableNameVsSchemaMap[tableName]
+	dataTypes = append(dataTypes, schema.ColumnDetails[schema.PrimaryKeyColumnPosition].DataType)
+	offset := len(tupleKeyPrefix(0, 0))
+	primaryKeyValue := ""
+	for _, dataType := range dataTypes {
+		if primaryKeyValue, err = readTupleColumn([]byte(indexKey), &offset, dataType); err != nil {
+			return "", err
+		}
 	}
-	indexKey += indexColValues
-	if primaryKeyValue != "" {
-		indexKey += (":" + primaryKeyValue)
-	} else {
-		indexKey += ":"
+	if offset != len(indexKey) {
+		return "", ErrMalformedTupleKey
 	}
-	return indexKey
+	return primaryKeyValue, nil
 }
 
 func (db *DB) getIndexAndPrimaryKeyColumnValuesInIndexSequence(indexColumnNames []string, insertIntoTableInput sqlparser.InsertIntoTable) ([]string, string, error) {
@@ -400,26 +707,44 @@ func (db *DB) getIndexAndPrimaryKeyColumnValuesInIndexSequence(indexColumnNames
 	return colValues, pkColValue, nil
 }
 
-func (db *DB) updateSecondaryIndexes(insertIntoTableInput sqlparser.InsertIntoTable, txn *Transaction) error {
+// returns the keys of the entries of the row in every secondary index of the table.
+func (db *DB) getSecondaryIndexKeys(insertIntoTableInput sqlparser.InsertIntoTable) ([]string, error) {
 	table := db.tableNameVsSchemaMap[insertIntoTableInput.TableName]
-	secondaryIndexes := table.SecondaryIndexes
-
-	for _, secondaryIndex := range secondaryIndexes {
+	secondaryIndexKeys := []string{}
+	for _, secondaryIndex := range table.SecondaryIndexes {
 		colValues, pkColValue, err := db.getIndexAndPrimaryKeyColumnValuesInIndexSequence(secondaryIndex.Columns, insertIntoTableInput)
 		if err != nil {
+			return nil, err
+		}
+		secondaryIndexKey, err := db.getSecondaryIndexKey(insertIntoTableInput.TableName, secondaryIndex, colValues, pkColValue)
+		if err != nil {
+			return nil, err
+		}
+		secondaryIndexKeys = append(secondaryIndexKeys, secondaryIndexKey)
+	}
+	return secondaryIndexKeys, nil
+}
+
+func (db *DB) updateSecondaryIndexes(insertIntoTableInput sqlparser.InsertIntoTable, txn *Transaction) error {
+	secondaryIndexKeys, err := db.getSecondaryIndexKeys(insertIntoTableInput)
+	if err != nil {
+		return err
+	}
+	for _, secondaryIndexKey := range secondaryIndexKeys {
+		if err := txn.Put(secondaryIndexKey, ""); err != nil {
 			return err
 		}
-		secondaryIndexKey := getSecondaryIndexKeyOrPrefix(insertIntoTableInput.TableName, secondaryIndex.IndexName, colValues, pkColValue)
-		txn.Put(secondaryIndexKey, "")
 	}
 	return nil
 }
 
+// ShowTables returns the names of the tables in sorted order.
 func (db *DB) ShowTables() []string {
 	tableNames := []string{}
 	for _, table := range db.tableNameVsSchemaMap {
 		tableNames = append(tableNames, table.TableName)
 	}
+	slices.Sort(tableNames)
 	return tableNames
 }
 
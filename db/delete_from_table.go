@@ -0,0 +1,68 @@
+package db
+
+import (
+	"fmt"
+
+	sqlparser "github.com/golang-db/sql_parser"
+)
+
+// DeleteFromTable runs the DELETE FROM query within a transaction and returns the number of rows deleted.
+func (db *DB) DeleteFromTable(query string) (int, error) {
+	parser := sqlparser.NewParser(query)
+	input, err := parser.ParseDeleteFromTable()
+	if err != nil {
+		return 0, err
+	}
+	return db.deleteFromTable(*input)
+}
+
+func (db *DB) deleteFromTable(deleteFromTableInput sqlparser.DeleteFromTable) (int, error) {
+	txn, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	rowsDeleted, err := db.deleteFromTableInTxn(deleteFromTableInput, txn)
+	if err != nil {
+		txn.Rollback()
+		return 0, err
+	}
+	if err := txn.Commit(); err != nil {
+		return 0, err
+	}
+	return rowsDeleted, nil
+}
+
+// finds the rows matching the query conditions like a SELECT query does, with a point lookup of the primary key,
+// an index scan or a full table scan. the row keys and the secondary index entries of the rows are deleted
+// by the transaction.
+func (db *DB) deleteFromTableInTxn(deleteFromTableInput sqlparser.DeleteFromTable, txn *Transaction) (int, error) {
+	tableName := deleteFromTableInput.TableName
+	table, ok := db.tableNameVsSchemaMap[tableName]
+	if !ok {
+		return 0, fmt.Errorf("table with name %q not found", tableName)
+	}
+	rows, err := db.selectRows(sqlparser.SelectFromTable{
+		TableName:       tableName,
+		ColumnsRequired: []string{sqlparser.SymbolStar},
+		QueryConditions: deleteFromTableInput.QueryConditions,
+	}, txn)
+	if err != nil {
+		return 0, err
+	}
+	for _, row := range rows {
+		key, err := db.getRowKey(tableName, row[table.PrimaryKeyColumnPosition])
+		if err != nil {
+			return 0, err
+		}
+		secondaryIndexKeys, err := db.getSecondaryIndexKeys(sqlparser.InsertIntoTable{TableName: tableName, ColumnValues: row})
+		if err != nil {
+			return 0, err
+		}
+		for _, key := range append([]string{key}, secondaryIndexKeys...) {
+			if err := txn.Delete(key); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(rows), nil
+}
@@ -0,0 +1,110 @@
+package db
+
+import (
+	"encoding/binary"
+	"testing"
+
+	sqlparser "github.com/golang-db/sql_parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// returns the number of row keys and index keys of table t1.
+func countT1Keys(t *testing.T, dbInstance *DB) int {
+	t.Helper()
+	prefix := binary.BigEndian.AppendUint32([]byte(tupleKeyTag), dbInstance.tableNameVsTableIdMap["t1"])
+	count := 0
+	require.NoError(t, dbInstance.prefixScan(string(prefix), nil, func(_, _ string) error {
+		count++
+		return nil
+	}))
+	return count
+}
+
+func TestDeleteFromTableRemovesTheRowsAndTheirIndexEntries(t *testing.T) {
+	dbInstance, config := newDBForWalCommandTest(t)
+	_, _, err := createTestTable(dbInstance, true)
+	require.NoError(t, err)
+	insertT1Rows(t, dbInstance,
+		[]string{"k1", "a", "1", "0"}, []string{"k2", "a", "2", "1"}, []string{"k3", "b", "3", "0"}, []string{"k4", "c", "4", "1"})
+	// a row key and 3 index entries per row
+	assert.Equal(t, 16, countT1Keys(t, dbInstance))
+
+	// point lookup of the primary key
+	rowsDeleted, err := dbInstance.DeleteFromTable("DELETE FROM t1 WHERE c1 = k1;")
+	require.NoError(t, err)
+	assert.Equal(t, 1, rowsDeleted)
+	rowsDeleted, err = dbInstance.DeleteFromTable("DELETE FROM t1 WHERE c1 = k1;")
+	require.NoError(t, err)
+	assert.Equal(t, 0, rowsDeleted)
+
+	// secondary index scan with a condition on another column
+	rowsDeleted, err = dbInstance.DeleteFromTable("DELETE FROM t1 WHERE c2 = a AND c4 = 1;")
+	require.NoError(t, err)
+	assert.Equal(t, 1, rowsDeleted)
+
+	assert.Equal(t, [][]string{{"k3", "b", "3", "0"}, {"k4", "c", "4", "1"}}, selectT1Rows(t, dbInstance))
+	assert.Empty(t, selectT1Rows(t, dbInstance,
+		sqlparser.QueryCondition{ColumnName: "c2", QueryType: sqlparser.Equals, Value: "a"}))
+	assert.Empty(t, selectT1Rows(t, dbInstance,
+		sqlparser.QueryCondition{ColumnName: "c3", QueryType: sqlparser.Lt, Value: "3"}))
+	assert.Equal(t, 8, countT1Keys(t, dbInstance))
+
+	// the deletes are replayed from the wal
+	dbInstance.Close()
+	dbInstance, err = NewDB(config)
+	require.NoError(t, err)
+	defer dbInstance.Close()
+	assert.Equal(t, 8, countT1Keys(t, dbInstance))
+
+	rowsDeleted, err = dbInstance.DeleteFromTable("DELETE FROM t1;")
+	require.NoError(t, err)
+	assert.Equal(t, 2, rowsDeleted)
+	assert.Empty(t, selectT1Rows(t, dbInstance))
+	assert.Equal(t, 0, countT1Keys(t, dbInstance))
+}
+
+func TestDeleteFromTableWithinTransactionIsRolledBack(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	_, _, err := createTestTable(dbInstance, true)
+	require.NoError(t, err)
+	insertT1Rows(t, dbInstance, []string{"k1", "a", "1", "0"}, []string{"k2", "b", "2", "0"})
+
+	txn, err := dbInstance.Begin()
+	require.NoError(t, err)
+	rowsDeleted, err := txn.DeleteFromTable("DELETE FROM t1 WHERE c3 >= 2;")
+	require.NoError(t, err)
+	assert.Equal(t, 1, rowsDeleted)
+	rows, err := txn.SelectFromTable("SELECT * FROM t1;")
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"k1", "a", "1", "0"}}, rows)
+
+	txn.Rollback()
+	assert.Equal(t, [][]string{{"k1", "a", "1", "0"}, {"k2", "b", "2", "0"}}, selectT1Rows(t, dbInstance))
+	assert.Equal(t, 8, countT1Keys(t, dbInstance))
+}
+
+func TestDeleteFromTableWhoseCommitFailsReleasesItsLocksAndSnapshot(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	_, _, err := createTestTable(dbInstance, true)
+	require.NoError(t, err)
+	insertT1Rows(t, dbInstance, []string{"k1", "a", "1", "0"})
+
+	// the wal write of the commit fails
+	dbInstance.wal.Close()
+	_, err = dbInstance.DeleteFromTable("DELETE FROM t1 WHERE c1 = k1;")
+	require.Error(t, err)
+	assert.Empty(t, dbInstance.transactionManager.keyVsLocksAcquiredMap)
+	assert.Empty(t, dbInstance.liveSnapshots())
+	assert.Equal(t, [][]string{{"k1", "a", "1", "0"}}, selectT1Rows(t, dbInstance))
+}
+
+func TestDeleteFromMissingTableFails(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	_, err := dbInstance.DeleteFromTable("DELETE FROM t1;")
+	assert.EqualError(t, err, "table with name \"t1\" not found")
+}
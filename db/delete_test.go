@@ -0,0 +1,119 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang-db/internalkey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// puts enough keys so that the memtable is flushed to a new sstable file.
+func putKeysUntilFlush(t *testing.T, dbInstance *DB, keyPrefix string) {
+	t.Helper()
+	for i := 0; dbInstance.memTable.GetSize() != 0 || i == 0; i++ {
+		require.NoError(t, dbInstance.Put(fmt.Sprintf("%s_%d", keyPrefix, i), fmt.Sprintf("value_%d", i)))
+	}
+	require.NoError(t, dbInstance.waitForPendingFlushes())
+}
+
+func TestDeleteHidesValueInMemtable(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	require.NoError(t, dbInstance.Put("key", "value"))
+	require.NoError(t, dbInstance.Delete("key"))
+
+	value, err := dbInstance.Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+}
+
+// the value is flushed to an older sstable file. the tombstone in the memtable and later in the
+// newer sstable file should hide it.
+func TestDeleteHidesValueInOlderSsTable(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	require.NoError(t, dbInstance.Put("deleted_key", "old value"))
+	putKeysUntilFlush(t, dbInstance, "first")
+
+	require.NoError(t, dbInstance.Delete("deleted_key"))
+	value, err := dbInstance.Get("deleted_key")
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+
+	putKeysUntilFlush(t, dbInstance, "second")
+	_, ok := dbInstance.memTable.Get("deleted_key", internalkey.MaxSequence)
+	require.False(t, ok)
+
+	value, err = dbInstance.Get("deleted_key")
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+
+	err = dbInstance.prefixScan("deleted", nil, func(key, _ string) error {
+		t.Errorf("deleted key %q returned by prefix scan", key)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func TestDeleteIsRecoveredFromWal(t *testing.T) {
+	dbInstance, config := newDBForWalCommandTest(t)
+	closeDB := closeDBOnce(dbInstance)
+	defer closeDB()
+
+	require.NoError(t, dbInstance.Put("deleted_key", "value"))
+	require.NoError(t, dbInstance.Put("live_key", "value"))
+	require.NoError(t, dbInstance.Delete("deleted_key"))
+	closeDB()
+
+	dbAfterRestart, err := NewDB(config)
+	require.NoError(t, err)
+	defer dbAfterRestart.Close()
+
+	value, err := dbAfterRestart.Get("deleted_key")
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+
+	value, err = dbAfterRestart.Get("live_key")
+	require.NoError(t, err)
+	assert.Equal(t, "value", value)
+}
+
+func TestCompactionDropsTombstones(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	require.NoError(t, dbInstance.Put("deleted_key", "old value"))
+	putKeysUntilFlush(t, dbInstance, "first")
+	require.NoError(t, dbInstance.Delete("deleted_key"))
+	putKeysUntilFlush(t, dbInstance, "second")
+	// level 0 is compacted once it has 4 files
+	putKeysUntilFlush(t, dbInstance, "third")
+	putKeysUntilFlush(t, dbInstance, "fourth")
+
+	require.NoError(t, dbInstance.ssTable.RunCompaction())
+
+	value, err := dbInstance.Get("deleted_key")
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+
+	value, err = dbInstance.Get("first_0")
+	require.NoError(t, err)
+	assert.Equal(t, "value_0", value)
+}
+
+func TestSerialiseDeleteCommandRoundTrip(t *testing.T) {
+	payload := serialiseDeleteCommand("key with spaces")
+
+	offset := 0
+	cmd, err := readLengthPrefixedString(payload, &offset)
+	require.NoError(t, err)
+	assert.Equal(t, CmdDelete, cmd)
+
+	key, err := deserialiseDeleteCommand(payload, &offset)
+	require.NoError(t, err)
+	assert.Equal(t, "key with spaces", key)
+}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/golang-db/memtable"
+)
+
+const (
+	defaultWalFilePath = "wal.log"
+	// writes wait once these many memtables are waiting to be flushed.
+	defaultMaxImmutableMemtables = 4
+)
+
+var errDBClosed = errors.New("db is closed")
+
+// immutableMemtable is a full memtable waiting to be flushed to an sstable.
+// it is still read by Get and iterators till the flush completes.
+type immutableMemtable struct {
+	memTable     *memtable.Memtable
+	walSegmentId int // wal segment holding the writes of the memtable. removed once the memtable is flushed.
+}
+
+// rotateMemtable moves the full memtable to the immutable queue and starts a new memtable along with a
+// new wal segment, so that every memtable is tied to the segment that started it.
+// must be called with db.mu held.
+func (db *DB) rotateMemtable() error {
+	fullMemtableWalSegmentId := db.wal.ActiveSegmentId()
+	if _, err := db.wal.Rotate(); err != nil {
+		return err
+	}
+	db.immutableMemTables = append(db.immutableMemTables, &immutableMemtable{
+		memTable:     db.memTable,
+		walSegmentId: fullMemtableWalSegmentId,
+	})
+	newMemtable := memtable.NewMemtable()
+	db.memTable = &newMemtable
+	db.flushCond.Broadcast()
+	return nil
+}
+
+// waitForRoomToWrite applies backpressure on writes while too many memtables are waiting to be flushed.
+// must be called with db.mu held.
+func (db *DB) waitForRoomToWrite() error {
+	for len(db.immutableMemTables) >= db.maxImmutableMemtables && db.flushErr == nil && !db.closed {
+		slog.Info("WRITE_STALLED_FOR_FLUSH", "immutable_memtables_count", len(db.immutableMemTables))
+		db.flushCond.Wait()
+	}
+	if db.flushErr != nil {
+		return db.flushErr
+	}
+	if db.closed {
+		return errDBClosed
+	}
+	return nil
+}
+
+// flushLoop runs in the background and flushes the immutable memtables from the oldest to the newest one.
+// a memtable is removed from the queue and its wal segment is deleted only after the sstable is
+// recorded in the manifest. a failed flush stops the loop and fails all later writes.
+func (db *DB) flushLoop() {
+	defer db.backgroundWg.Done()
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for {
+		for len(db.immutableMemTables) == 0 && !db.closed {
+			db.flushCond.Wait()
+		}
+		if len(db.immutableMemTables) == 0 {
+			return
+		}
+		oldest := db.immutableMemTables[0]
+
+		db.mu.Unlock()
+		err := db.flushMemtableToSsTable(oldest)
+		db.mu.Lock()
+
+		if err != nil {
+			slog.Error("MEMTABLE_FLUSH_FAILED", "error", err.Error())
+			db.flushErr = err
+			db.flushCond.Broadcast()
+			return
+		}
+		db.immutableMemTables = db.immutableMemTables[1:]
+		// a segment which can't be removed is replayed again on the next start. it only rewrites the same entries.
+		if err := db.wal.RemoveSegment(oldest.walSegmentId); err != nil {
+			slog.Error("WAL_SEGMENT_REMOVE_FAILED", "segment_id", oldest.walSegmentId, "error", err.Error())
+		}
+		db.flushCond.Broadcast()
+	}
+}
+
+// waitForPendingFlushes blocks till every immutable memtable is flushed.
+func (db *DB) waitForPendingFlushes() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for len(db.immutableMemTables) > 0 && db.flushErr == nil {
+		db.flushCond.Wait()
+	}
+	return db.flushErr
+}
+
+func (db *DB) flushMemtableToSsTable(immutable *immutableMemtable) error {
+	ssTableFile, err := db.ssTable.NewFile()
+	if err != nil {
+		return err
+	}
+
+	err = db.ssTable.FlushMemtable(ssTableFile, immutable.memTable.Iterate, immutable.walSegmentId,
+		immutable.memTable.LastSequence())
+	if db.ssTable.ShouldRunCompaction() {
+		db.backgroundWg.Add(1)
+		go func() {
+			defer db.backgroundWg.Done()
+			db.ssTable.RunCompaction()
+		}()
+	}
+	return err
+}
@@ -0,0 +1,200 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/golang-db/wal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stops the flush loop so that the test controls when the immutable memtables are flushed.
+// the returned func starts the flush loop again.
+func stopFlushLoop(dbInstance *DB) func() {
+	dbInstance.mu.Lock()
+	dbInstance.closed = true
+	dbInstance.flushCond.Broadcast()
+	dbInstance.mu.Unlock()
+	dbInstance.backgroundWg.Wait()
+	dbInstance.mu.Lock()
+	dbInstance.closed = false
+	dbInstance.mu.Unlock()
+	return func() {
+		dbInstance.backgroundWg.Add(1)
+		go dbInstance.flushLoop()
+	}
+}
+
+// rotates the active memtable like a write filling it up would
+func rotateMemtableForTest(t *testing.T, dbInstance *DB) {
+	dbInstance.mu.Lock()
+	defer dbInstance.mu.Unlock()
+	require.NoError(t, dbInstance.rotateMemtable())
+}
+
+func TestFullMemtableIsFlushedInBackground(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	putKeysUntilFlush(t, dbInstance, "key")
+
+	// only the active segment is left once the older segments are flushed
+	segmentIds, err := dbInstance.wal.SegmentIds()
+	require.NoError(t, err)
+	assert.Equal(t, []int{dbInstance.wal.ActiveSegmentId()}, segmentIds)
+	assert.Empty(t, dbInstance.immutableMemTables)
+	assert.Equal(t, dbInstance.wal.ActiveSegmentId(), dbInstance.ssTable.MinUnflushedWalSegmentId())
+
+	// the flushed keys are read from the sstable
+	value, err := dbInstance.ssTable.Get("key_0")
+	require.NoError(t, err)
+	assert.Equal(t, "value_0", value)
+	value, err = dbInstance.Get("key_0")
+	require.NoError(t, err)
+	assert.Equal(t, "value_0", value)
+}
+
+func TestGetAndIteratorReadImmutableMemtables(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	startFlushLoop := stopFlushLoop(dbInstance)
+	defer startFlushLoop()
+	require.NoError(t, dbInstance.Put("key", "immutable value"))
+	require.NoError(t, dbInstance.Put("deleted_key", "immutable value"))
+	rotateMemtableForTest(t, dbInstance)
+	require.NoError(t, dbInstance.Delete("deleted_key"))
+	require.Len(t, dbInstance.immutableMemTables, 1)
+
+	value, err := dbInstance.Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "immutable value", value)
+	value, err = dbInstance.Get("deleted_key")
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+
+	it, err := dbInstance.NewIterator("", "")
+	require.NoError(t, err)
+	defer it.Close()
+	assert.Equal(t, map[string]string{"key": "immutable value"}, collectIterator(t, it))
+}
+
+func TestWritesStallWhileTooManyMemtablesWaitForFlush(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	startFlushLoop := stopFlushLoop(dbInstance)
+	for i := 0; i < dbInstance.maxImmutableMemtables; i++ {
+		require.NoError(t, dbInstance.Put(fmt.Sprintf("immutable_%d", i), "value"))
+		rotateMemtableForTest(t, dbInstance)
+	}
+
+	putDone := make(chan error)
+	go func() {
+		putDone <- dbInstance.Put("key", "value")
+	}()
+	select {
+	case <-putDone:
+		t.Fatal("put should wait for the immutable memtables to be flushed")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	startFlushLoop()
+
+	require.NoError(t, <-putDone)
+	require.NoError(t, dbInstance.waitForPendingFlushes())
+	for i := 0; i < dbInstance.maxImmutableMemtables; i++ {
+		value, err := dbInstance.ssTable.Get(fmt.Sprintf("immutable_%d", i))
+		require.NoError(t, err)
+		assert.Equal(t, "value", value)
+	}
+}
+
+func TestUnflushedWalSegmentsAreReplayedInOrder(t *testing.T) {
+	dbInstance, config := newDBForWalCommandTest(t)
+	dbInstance.Close()
+
+	// a crash after the memtable was rotated but before it was flushed leaves its segment behind
+	writeSegment := func(segmentId int, key, value string) {
+		segment, err := wal.NewWal(fmt.Sprintf("%s.%d", config.WalFilePath, segmentId))
+		require.NoError(t, err)
+		defer segment.Close()
+		require.NoError(t, segment.WriteEntry(serialisePutCommand(key, value)))
+	}
+	writeSegment(1, "key", "oldest value")
+	writeSegment(1, "other_key", "oldest value")
+	writeSegment(2, "key", "older value")
+	writeSegment(3, "key", "active value")
+
+	dbAfterRestart, err := NewDB(config)
+	require.NoError(t, err)
+	defer dbAfterRestart.Close()
+	assert.Equal(t, 3, dbAfterRestart.wal.ActiveSegmentId())
+	require.NoError(t, dbAfterRestart.waitForPendingFlushes())
+
+	segmentIds, err := dbAfterRestart.wal.SegmentIds()
+	require.NoError(t, err)
+	assert.Equal(t, []int{3}, segmentIds)
+	value, err := dbAfterRestart.Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "active value", value)
+	value, err = dbAfterRestart.ssTable.Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "older value", value)
+	value, err = dbAfterRestart.Get("other_key")
+	require.NoError(t, err)
+	assert.Equal(t, "oldest value", value)
+}
+
+func TestFlushedWalSegmentIsNotReplayed(t *testing.T) {
+	dbInstance, config := newDBForWalCommandTest(t)
+
+	startFlushLoop := stopFlushLoop(dbInstance)
+	require.NoError(t, dbInstance.Put("key", "old value"))
+	flushedSegmentId := dbInstance.wal.ActiveSegmentId()
+	flushedSegmentFilePath := fmt.Sprintf("%s.%d", config.WalFilePath, flushedSegmentId)
+	flushedSegment, err := os.ReadFile(flushedSegmentFilePath)
+	require.NoError(t, err)
+	rotateMemtableForTest(t, dbInstance)
+	startFlushLoop()
+	require.NoError(t, dbInstance.Put("key", "new value"))
+	rotateMemtableForTest(t, dbInstance)
+	require.NoError(t, dbInstance.waitForPendingFlushes())
+	dbInstance.Close()
+
+	// a crash after the flush is recorded in the manifest but before the segment is removed
+	require.NoError(t, os.WriteFile(flushedSegmentFilePath, flushedSegment, 0644))
+
+	dbAfterRestart, err := NewDB(config)
+	require.NoError(t, err)
+	defer dbAfterRestart.Close()
+	assert.NoFileExists(t, flushedSegmentFilePath)
+	assert.Empty(t, dbAfterRestart.immutableMemTables)
+	value, err := dbAfterRestart.Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "new value", value)
+}
+
+func TestFailedFlushFailsLaterWrites(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	// the manifest log can't be written once the sstable is closed
+	dbInstance.ssTable.Close()
+	for i := 0; dbInstance.memTable.GetSize() != 0 || i == 0; i++ {
+		require.NoError(t, dbInstance.Put(fmt.Sprintf("key_%d", i), "value"))
+	}
+	assert.Error(t, dbInstance.waitForPendingFlushes())
+	assert.Error(t, dbInstance.Delete("key_0"))
+
+	// the unflushed memtable and its segment are kept
+	value, err := dbInstance.Get("key_0")
+	require.NoError(t, err)
+	assert.Equal(t, "value", value)
+	segmentIds, err := dbInstance.wal.SegmentIds()
+	require.NoError(t, err)
+	assert.Len(t, segmentIds, 2)
+}
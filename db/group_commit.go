@@ -0,0 +1,144 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/golang-db/memtable"
+	"github.com/golang-db/wal"
+)
+
+// a group commit is capped so that the writers which joined it late don't wait for too long.
+const maxGroupCommitBytes = 1 << 20
+
+// ErrWriteTooLarge is returned for a write whose wal record would be longer than the wal can replay, like a
+// WriteBatch or a transaction with too many writes. nothing is written then, the writes have to be split
+// into smaller ones.
+var ErrWriteTooLarge = errors.New("write is too large for a single wal record")
+
+// pendingWrite is a write waiting in the write queue to be committed to the wal.
+type pendingWrite struct {
+	walRecord []byte
+	// keys written by the write in the order of their sequence numbers, one sequence number is used for each
+	keys []string
+	// first sequence number of the write, assigned by the leader of its group commit
+	sequence uint64
+	apply    func(memTable *memtable.Memtable, sequence uint64)
+	// optional, rejects the write if it fails. see writeValidated.
+	validate func(keysWrittenInGroup map[string]bool) error
+	done     bool
+	err      error
+}
+
+// write writes the record to the wal and then applies the same change to the memtable.
+// concurrent writes are committed as a group: the writer at the front of the queue becomes the leader,
+// writes the records of the queued writers to the wal with a single write and fsync and applies all of
+// them to the memtable in the queue order. the other writers just wait for the leader to finish.
+// the leader stamps every write with consecutive sequence numbers, apply gets the first one. the writes
+// become visible to the reads only once the whole group is applied.
+// a full memtable is moved to the immutable queue to be flushed in the background.
+func (db *DB) write(walRecord []byte, keys []string, apply func(memTable *memtable.Memtable, sequence uint64)) error {
+	return db.writeValidated(walRecord, keys, apply, nil)
+}
+
+// writeValidated is write with a validation which the leader runs with db.mu held just before the write
+// is assigned its sequence numbers, so no other write can be committed between the two. the write is
+// rejected with the error of validate. keysWrittenInGroup has the keys of the writes ahead of it in the
+// same group, which are not applied to the memtable yet.
+func (db *DB) writeValidated(walRecord []byte, keys []string, apply func(memTable *memtable.Memtable, sequence uint64),
+	validate func(keysWrittenInGroup map[string]bool) error) error {
+	// a record which can't be replayed must never be acknowledged. every write of a group commit is its
+	// own record, so only the size of each write is limited.
+	if recordLength := len(serialiseSequencedCommand(0, nil)) + len(walRecord); recordLength > wal.MaxPayloadLength {
+		return fmt.Errorf("%w: the record is %d bytes, at most %d bytes are allowed", ErrWriteTooLarge,
+			recordLength, wal.MaxPayloadLength)
+	}
+	w := &pendingWrite{walRecord: walRecord, keys: keys, apply: apply, validate: validate}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.writeQueue = append(db.writeQueue, w)
+	for !w.done && db.writeQueue[0] != w {
+		db.writeCond.Wait()
+	}
+	if w.done {
+		return w.err
+	}
+
+	if err := db.waitForRoomToWrite(); err != nil {
+		db.finishGroupCommit([]*pendingWrite{w}, err)
+		return err
+	}
+	group := db.nextWriteGroup()
+	acceptedWrites := make([]*pendingWrite, 0, len(group))
+	walRecords := make([][]byte, 0, len(group))
+	keysWrittenInGroup := map[string]bool{}
+	// a sequence number is never reused, even if the wal write fails
+	for _, groupWrite := range group {
+		if groupWrite.validate != nil {
+			if err := groupWrite.validate(keysWrittenInGroup); err != nil {
+				groupWrite.err = err
+				continue
+			}
+		}
+		for _, key := range groupWrite.keys {
+			keysWrittenInGroup[key] = true
+		}
+		groupWrite.sequence = db.nextSequence
+		db.nextSequence += uint64(len(groupWrite.keys))
+		acceptedWrites = append(acceptedWrites, groupWrite)
+		walRecords = append(walRecords, serialiseSequencedCommand(groupWrite.sequence, groupWrite.walRecord))
+	}
+
+	// only the leader writes to the wal and rotates the memtable, so the wal is written without db.mu.
+	// the readers keep reading the memtables meanwhile and the writers keep joining the queue.
+	var err error
+	if len(walRecords) > 0 {
+		db.mu.Unlock()
+		err = db.wal.WriteEntries(walRecords)
+		db.mu.Lock()
+	}
+
+	if err == nil {
+		for _, groupWrite := range acceptedWrites {
+			groupWrite.apply(db.memTable, groupWrite.sequence)
+		}
+		db.lastSequence.Store(db.nextSequence - 1)
+		// the writes are committed even if the rotation fails, the next write retries the rotation
+		if db.memTable.ShouldFlush() {
+			if rotateErr := db.rotateMemtable(); rotateErr != nil {
+				slog.Error("MEMTABLE_ROTATION_FAILED", "error", rotateErr.Error())
+			}
+		}
+	}
+	db.finishGroupCommit(group, err)
+	return w.err
+}
+
+// returns the writes at the front of the queue which are committed together. the first one is the leader.
+// must be called with db.mu held.
+func (db *DB) nextWriteGroup() []*pendingWrite {
+	groupBytes := 0
+	groupLength := 0
+	for _, queuedWrite := range db.writeQueue {
+		if groupLength > 0 && groupBytes+len(queuedWrite.walRecord) > maxGroupCommitBytes {
+			break
+		}
+		groupBytes += len(queuedWrite.walRecord)
+		groupLength++
+	}
+	return db.writeQueue[:groupLength]
+}
+
+// removes the group from the queue and wakes up its writers and the leader of the next group.
+// the writes rejected by their validation keep their own error. must be called with db.mu held.
+func (db *DB) finishGroupCommit(group []*pendingWrite, err error) {
+	for _, groupWrite := range group {
+		groupWrite.done = true
+		if groupWrite.err == nil {
+			groupWrite.err = err
+		}
+	}
+	db.writeQueue = db.writeQueue[len(group):]
+	db.writeCond.Broadcast()
+}
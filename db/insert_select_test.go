@@ -30,7 +30,7 @@ func TestInsertSelectTestWithPrimaryKey(t *testing.T) {
 			QueryType:  "=",
 			Value:      "id1234",
 		}},
-	})
+	}, nil)
 	assert.NoError(t, err)
 	assert.Len(t, res, 1)
 
@@ -64,7 +64,7 @@ func TestSelectFullTableScan(t *testing.T) {
 		tableScan, err := db.selectFromTable(sqlparser.SelectFromTable{
 			TableName:       tableName,
 			ColumnsRequired: []string{"*"},
-		})
+		}, nil)
 		assert.NoError(t, err)
 		expectedValStart := (i * 20)
 		expectedValEnd := (i * 20) + 19
@@ -0,0 +1,217 @@
+package db
+
+import (
+	"github.com/golang-db/internalkey"
+	"github.com/golang-db/sstable"
+)
+
+// Iterator iterates over the live key, value pairs of the DB in sorted key order.
+// It merges the memtables with every sstable file, the newest version of a key wins and deleted
+// keys are skipped. SsTable files are read one data block at a time.
+// The iterator reads from a point-in-time view of the memtable taken when it was created, versions
+// written after it was created are skipped.
+type Iterator struct {
+	merged sstable.Iterator
+	lower  string
+	upper  string
+	// only the versions written at or before this sequence number are visible
+	sequence uint64
+	key      string // user key of the current version
+	err      error
+}
+
+// NewIterator returns an iterator over the keys in the range [lower, upper) positioned at the
+// first key >= lower. An empty upper means that the range is unbounded.
+// Close must be called once the iterator is no longer needed.
+func (db *DB) NewIterator(lower, upper string) (*Iterator, error) {
+	return db.NewIteratorFromSnapshot(lower, upper, nil)
+}
+
+// NewIteratorFromSnapshot returns an iterator over the keys in the range [lower, upper) as of the
+// snapshot. A nil snapshot reads the newest committed writes.
+func (db *DB) NewIteratorFromSnapshot(lower, upper string, snapshot *Snapshot) (*Iterator, error) {
+	// cloning the memtable is not safe for concurrent calls, hence the exclusive lock.
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	sequence, err := snapshot.readSequence(db)
+	if err != nil {
+		return nil, err
+	}
+	return db.newIteratorAtSequence(lower, upper, sequence)
+}
+
+// returns an iterator over the keys in the range [lower, upper) as of the sequence, which must be
+// held by a snapshot unless it is the newest one. must be called with db.mu held exclusively.
+func (db *DB) newIteratorAtSequence(lower, upper string, sequence uint64) (*Iterator, error) {
+	merged, err := db.newMergingIterator()
+	if err != nil {
+		return nil, err
+	}
+	it := &Iterator{
+		merged:   merged,
+		lower:    lower,
+		upper:    upper,
+		sequence: sequence,
+	}
+	it.Seek(lower)
+	return it, nil
+}
+
+// returns an iterator over every version of every key in the memtables and the sstable files.
+// must be called with db.mu held exclusively.
+func (db *DB) newMergingIterator() (sstable.Iterator, error) {
+	ssTableIterators, err := db.ssTable.NewIterators()
+	if err != nil {
+		return nil, err
+	}
+	// memtable has the most up-to-date data, hence it is the newest source.
+	// it is followed by the immutable memtables from the newest to the oldest one.
+	iterators := []sstable.Iterator{db.memTable.NewIterator()}
+	for i := len(db.immutableMemTables) - 1; i >= 0; i-- {
+		iterators = append(iterators, db.immutableMemTables[i].memTable.NewIterator())
+	}
+	iterators = append(iterators, ssTableIterators...)
+	// the iterators hold their own copy of the memtables and their own handle to the files, so a
+	// compaction can't drop the versions they read. the versions of an older snapshot are kept in
+	// the files by compaction till the snapshot is released.
+	return sstable.NewMergingIterator(iterators), nil
+}
+
+// returns true if a key in the range [lower, upper) has a version written after the sequence, a
+// tombstone included. must be called with db.mu held exclusively.
+func (db *DB) hasVersionsNewerThan(lower, upper string, sequence uint64) (bool, error) {
+	merged, err := db.newMergingIterator()
+	if err != nil {
+		return false, err
+	}
+	defer merged.Close()
+	for merged.Seek(internalkey.Make(lower, internalkey.MaxSequence)); merged.Valid(); merged.Next() {
+		userKey, versionSequence, err := internalkey.Parse(merged.Key())
+		if err != nil {
+			return false, err
+		}
+		if upper != "" && userKey >= upper {
+			break
+		}
+		if versionSequence > sequence {
+			return true, nil
+		}
+	}
+	return false, merged.Error()
+}
+
+// Seek positions the iterator at the first key >= the given key. Keys before lower are never returned.
+func (it *Iterator) Seek(key string) {
+	if key < it.lower {
+		key = it.lower
+	}
+	// the versions of the key newer than the iterator's sequence are skipped by the seek itself
+	it.merged.Seek(internalkey.Make(key, it.sequence))
+	it.skipToVisibleVersion("", false)
+}
+
+// moves to the newest visible version of the next live key. the versions newer than the iterator's
+// sequence, the older versions of the previous key and the deleted keys are skipped.
+func (it *Iterator) skipToVisibleVersion(previousKey string, hasPreviousKey bool) {
+	for it.merged.Valid() {
+		userKey, sequence, err := internalkey.Parse(it.merged.Key())
+		if err != nil {
+			it.err = err
+			return
+		}
+		if sequence > it.sequence || (hasPreviousKey && userKey == previousKey) {
+			it.merged.Next()
+			continue
+		}
+		// the newest visible version of the key. the older versions of a deleted key are skipped as well.
+		if it.merged.Tombstone() {
+			previousKey, hasPreviousKey = userKey, true
+			it.merged.Next()
+			continue
+		}
+		it.key = userKey
+		return
+	}
+}
+
+// Valid returns false once the iterator is exhausted, has gone past upper or has hit an error.
+func (it *Iterator) Valid() bool {
+	if it.err != nil || !it.merged.Valid() {
+		return false
+	}
+	return it.upper == "" || it.key < it.upper
+}
+
+func (it *Iterator) Next() {
+	it.merged.Next()
+	it.skipToVisibleVersion(it.key, true)
+}
+
+func (it *Iterator) Key() string {
+	return it.key
+}
+
+func (it *Iterator) Value() string {
+	return it.merged.Value()
+}
+
+func (it *Iterator) Error() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.merged.Error()
+}
+
+func (it *Iterator) Close() error {
+	return it.merged.Close()
+}
+
+// returns the smallest key which is greater than all the keys having the prefix.
+// it can be used as the exclusive upper bound of an iterator for a prefix scan.
+func prefixUpperBound(prefix string) string {
+	buf := []byte(prefix)
+	for i := len(buf) - 1; i >= 0; i-- {
+		if buf[i] < 0xff {
+			buf[i]++
+			return string(buf[:i+1])
+		}
+	}
+	// all bytes are 0xff, no upper bound exists.
+	return ""
+}
+
+// returns the smaller of the exclusive upper bounds, an empty upper bound is unbounded.
+func minUpperBound(a, b string) string {
+	if a == "" {
+		return b
+	}
+	if b == "" {
+		return a
+	}
+	return min(a, b)
+}
+
+// returns true if no key is within [lower, upper), an empty upper bound is unbounded.
+func isEmptyRange(lower, upper string) bool {
+	return upper != "" && lower >= upper
+}
+
+// prefixScan calls fn for each live key, value pair with the prefix in sorted key order as of the snapshot.
+func (db *DB) prefixScan(prefix string, snapshot *Snapshot, fn func(key, value string) error) error {
+	return db.rangeScan(prefix, prefixUpperBound(prefix), snapshot, fn)
+}
+
+// rangeScan calls fn for each live key, value pair within [lower, upper) in sorted key order as of the snapshot.
+func (db *DB) rangeScan(lower, upper string, snapshot *Snapshot, fn func(key, value string) error) error {
+	it, err := db.NewIteratorFromSnapshot(lower, upper, snapshot)
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	for ; it.Valid(); it.Next() {
+		if err := fn(it.Key(), it.Value()); err != nil {
+			return err
+		}
+	}
+	return it.Error()
+}
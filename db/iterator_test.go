@@ -0,0 +1,110 @@
+package db
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func collectIterator(t *testing.T, it *Iterator) map[string]string {
+	t.Helper()
+	result := map[string]string{}
+	previousKey := ""
+	for ; it.Valid(); it.Next() {
+		require.Greater(t, it.Key(), previousKey, "keys should be returned in sorted order")
+		previousKey = it.Key()
+		result[it.Key()] = it.Value()
+	}
+	require.NoError(t, it.Error())
+	return result
+}
+
+// writes spread across multiple sstable files and the memtable. overwrites and deletes in newer
+// sources should win over older ones.
+func TestIteratorMergesMemtableAndSsTables(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	expected := map[string]string{}
+	for i := 0; i < 30; i++ {
+		key := fmt.Sprintf("key_%02d", i)
+		require.NoError(t, dbInstance.Put(key, "old"))
+		expected[key] = "old"
+	}
+	putKeysUntilFlush(t, dbInstance, "filler_a")
+
+	for i := 0; i < 30; i += 3 {
+		key := fmt.Sprintf("key_%02d", i)
+		require.NoError(t, dbInstance.Put(key, "new"))
+		expected[key] = "new"
+	}
+	putKeysUntilFlush(t, dbInstance, "filler_b")
+
+	for i := 1; i < 30; i += 3 {
+		key := fmt.Sprintf("key_%02d", i)
+		require.NoError(t, dbInstance.Delete(key))
+		delete(expected, key)
+	}
+	require.NoError(t, dbInstance.Put("key_02", "newest"))
+	expected["key_02"] = "newest"
+
+	it, err := dbInstance.NewIterator("key_", "key_~")
+	require.NoError(t, err)
+	defer it.Close()
+	assert.Equal(t, expected, collectIterator(t, it))
+}
+
+func TestIteratorBoundsAndSeek(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	for i := 0; i < 50; i++ {
+		require.NoError(t, dbInstance.Put(fmt.Sprintf("key_%02d", i), fmt.Sprintf("value_%02d", i)))
+	}
+
+	it, err := dbInstance.NewIterator("key_10", "key_20")
+	require.NoError(t, err)
+	defer it.Close()
+
+	result := collectIterator(t, it)
+	assert.Len(t, result, 10)
+	assert.Equal(t, "value_10", result["key_10"])
+	assert.NotContains(t, result, "key_20")
+
+	it.Seek("key_15")
+	require.True(t, it.Valid())
+	assert.Equal(t, "key_15", it.Key())
+
+	// seek before the lower bound is clamped to the lower bound
+	it.Seek("a")
+	require.True(t, it.Valid())
+	assert.Equal(t, "key_10", it.Key())
+
+	it.Seek("key_25")
+	assert.False(t, it.Valid())
+}
+
+// writes after the iterator is created should not be visible to it.
+func TestIteratorIsolatedFromLaterWrites(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	require.NoError(t, dbInstance.Put("key_1", "value_1"))
+	it, err := dbInstance.NewIterator("", "")
+	require.NoError(t, err)
+	defer it.Close()
+
+	require.NoError(t, dbInstance.Put("key_2", "value_2"))
+	require.NoError(t, dbInstance.Delete("key_1"))
+
+	assert.Equal(t, map[string]string{"key_1": "value_1"}, collectIterator(t, it))
+}
+
+func TestPrefixUpperBound(t *testing.T) {
+	assert.Equal(t, "t1;", prefixUpperBound("t1:"))
+	assert.Equal(t, "b", prefixUpperBound("a\xff"))
+	assert.Equal(t, "", prefixUpperBound("\xff\xff"))
+	assert.Equal(t, "", prefixUpperBound(""))
+}
@@ -0,0 +1,148 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+
+	sqlparser "github.com/golang-db/sql_parser"
+)
+
+// the rows and the secondary index entries of the tables are stored under tuple keys:
+// [0x01][table_id][index_id][column_1][column_2]...
+// the table id and the index id are 4 byte big endian, the primary index has id 0 and the secondary
+// indexes are numbered from 1 in the order of the table's index catalog. the row key holds the primary
+// key column, an index key holds the index columns followed by the primary key column.
+// every column is encoded so that the byte order of the keys is the SQL order of the values:
+//   - INT: 8 byte big endian with the sign bit flipped, so the negative values sort first
+//   - STRING: every 0x00 byte escaped as 0x00 0xff, terminated by 0x00 0x01. the terminator sorts
+//     before any escaped byte, so a string sorts before the longer strings it is a prefix of
+//   - BOOL: 1 byte
+//
+// every encoded column is self delimiting, so the encoded values of the leading columns are a prefix of
+// all the keys having those values.
+const (
+	tupleKeyTag      = "\x01"
+	primaryIndexId   = 0
+	stringEscapeByte = 0xff
+	stringTerminator = "\x00\x01"
+)
+
+var ErrMalformedTupleKey = errors.New("malformed tuple key")
+
+// returns the prefix of the keys of the index of the table.
+func tupleKeyPrefix(tableId, indexId uint32) []byte {
+	buf := []byte(tupleKeyTag)
+	buf = binary.BigEndian.AppendUint32(buf, tableId)
+	return binary.BigEndian.AppendUint32(buf, indexId)
+}
+
+// appends the column value encoded as per its data type. the value is parsed as per the data type, so
+// the values which the row can't store are rejected.
+func appendTupleColumn(buf []byte, dataType sqlparser.DataType, value string) ([]byte, error) {
+	switch dataType {
+	case sqlparser.Int:
+		valueInt, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return binary.BigEndian.AppendUint64(buf, uint64(valueInt)^(1<<63)), nil
+	case sqlparser.String:
+		for i := 0; i < len(value); i++ {
+			buf = append(buf, value[i])
+			if value[i] == 0x00 {
+				buf = append(buf, stringEscapeByte)
+			}
+		}
+		return append(buf, stringTerminator...), nil
+	case sqlparser.Bool:
+		valueInt, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, err
+		}
+		if valueInt != 0 && valueInt != 1 {
+			return nil, errors.New("only 0 and 1 values supported for BOOL data type")
+		}
+		return append(buf, byte(valueInt)), nil
+	}
+	return nil, fmt.Errorf("unknown data type: %d", dataType)
+}
+
+// reads the column value encoded by appendTupleColumn at the offset and moves the offset past it.
+func readTupleColumn(buf []byte, offset *int, dataType sqlparser.DataType) (string, error) {
+	switch dataType {
+	case sqlparser.Int:
+		if *offset+8 > len(buf) {
+			return "", ErrMalformedTupleKey
+		}
+		valueInt := int64(binary.BigEndian.Uint64(buf[*offset:*offset+8]) ^ (1 << 63))
+		*offset += 8
+		return strconv.FormatInt(valueInt, 10), nil
+	case sqlparser.String:
+		value := []byte{}
+		for i := *offset; i+1 < len(buf); i++ {
+			if buf[i] != 0x00 {
+				value = append(value, buf[i])
+				continue
+			}
+			switch buf[i+1] {
+			case stringEscapeByte:
+				value = append(value, 0x00)
+				i++
+			case stringTerminator[1]:
+				*offset = i + 2
+				return string(value), nil
+			default:
+				return "", ErrMalformedTupleKey
+			}
+		}
+		return "", ErrMalformedTupleKey
+	case sqlparser.Bool:
+		if *offset+1 > len(buf) || buf[*offset] > 1 {
+			return "", ErrMalformedTupleKey
+		}
+		*offset++
+		return strconv.Itoa(int(buf[*offset-1])), nil
+	}
+	return "", fmt.Errorf("unknown data type: %d", dataType)
+}
+
+// returns the types of the columns in the order of the names.
+func (db *DB) getColumnDataTypes(tableName string, columnNames []string) ([]sqlparser.DataType, error) {
+	dataTypes := []sqlparser.DataType{}
+	for _, columnName := range columnNames {
+		colPos := db.getColPositionFromColName(tableName, columnName)
+		if colPos == -1 {
+			return nil, fmt.Errorf("column: '%s' not found", columnName)
+		}
+		dataTypes = append(dataTypes, db.tableNameVsSchemaMap[tableName].ColumnDetails[colPos].DataType)
+	}
+	return dataTypes, nil
+}
+
+// returns the key of the row with the primary key value.
+func (db *DB) getRowKey(tableName, primaryKeyValue string) (string, error) {
+	schema := db.tableNameVsSchemaMap[tableName]
+	buf := tupleKeyPrefix(db.tableNameVsTableIdMap[tableName], primaryIndexId)
+	buf, err := appendTupleColumn(buf, schema.ColumnDetails[schema.PrimaryKeyColumnPosition].DataType, primaryKeyValue)
+	if err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// returns the prefix of the keys of all the rows of the table.
+func (db *DB) getRowKeyPrefix(tableName string) string {
+	return string(tupleKeyPrefix(db.tableNameVsTableIdMap[tableName], primaryIndexId))
+}
+
+// returns the id of the secondary index, which is its position in the index catalog of the table plus one.
+func getSecondaryIndexId(schema sqlparser.CreateTable, indexName string) (uint32, error) {
+	for i, secondaryIndex := range schema.SecondaryIndexes {
+		if secondaryIndex.IndexName == indexName {
+			return uint32(i + 1), nil
+		}
+	}
+	return 0, fmt.Errorf("index: '%s' not found", indexName)
+}
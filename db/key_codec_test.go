@@ -0,0 +1,318 @@
+package db
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	sqlparser "github.com/golang-db/sql_parser"
+	"github.com/golang-db/sstable"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTupleColumnsSortInSQLOrder(t *testing.T) {
+	tests := []struct {
+		dataType sqlparser.DataType
+		values   []string
+	}{
+		{sqlparser.Int, []string{"-9223372036854775808", "-100", "-11", "-1", "0", "1", "11", "100", "9223372036854775807"}},
+		{sqlparser.String, []string{"", "\x00", "\x00\x00", "\x00a", "a", "a\x00", "a:b", "ab", "b"}},
+		{sqlparser.Bool, []string{"0", "1"}},
+	}
+	for _, test := range tests {
+		keys := []string{}
+		for _, value := range test.values {
+			buf, err := appendTupleColumn([]byte("prefix"), test.dataType, value)
+			require.NoError(t, err)
+			keys = append(keys, string(buf))
+
+			offset := len("prefix")
+			decoded, err := readTupleColumn(buf, &offset, test.dataType)
+			require.NoError(t, err)
+			assert.Equal(t, value, decoded)
+			assert.Equal(t, len(buf), offset)
+		}
+		assert.True(t, slices.IsSorted(keys), "values of data type %d", test.dataType)
+	}
+}
+
+func TestAppendTupleColumnRejectsValuesNotMatchingTheDataType(t *testing.T) {
+	_, err := appendTupleColumn(nil, sqlparser.Int, "abc")
+	assert.Error(t, err)
+	_, err = appendTupleColumn(nil, sqlparser.Bool, "2")
+	assert.Error(t, err)
+}
+
+func TestReadTupleColumnRejectsTruncatedKeys(t *testing.T) {
+	offset := 0
+	_, err := readTupleColumn([]byte("abc"), &offset, sqlparser.String)
+	assert.ErrorIs(t, err, ErrMalformedTupleKey)
+	_, err = readTupleColumn([]byte{0x80, 0x00}, &offset, sqlparser.Int)
+	assert.ErrorIs(t, err, ErrMalformedTupleKey)
+}
+
+func TestFullTableScanReturnsIntPrimaryKeysInNumericOrder(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	require.NoError(t, dbInstance.CreateTable("CREATE TABLE t (name STRING, id INT, PRIMARY KEY (id));"))
+	for _, id := range []string{"100", "11", "0", "2"} {
+		require.NoError(t, dbInstance.InsertIntoTable(fmt.Sprintf("INSERT INTO t VALUES (name%s, %s)", id, id)))
+	}
+
+	rows, err := dbInstance.selectFromTable(sqlparser.SelectFromTable{TableName: "t", ColumnsRequired: []string{"*"}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"name0", "0"}, {"name2", "2"}, {"name11", "11"}, {"name100", "100"}}, rows)
+}
+
+func TestValuesWithSeparatorsDontLeakIntoOtherRows(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	_, _, err := createTestTable(dbInstance, true)
+	require.NoError(t, err)
+
+	// with the old `index:t1:idxc2:a:b:pk` keys the prefix of c2 = 'a' matched the rows having c2 = 'a:b'
+	for _, row := range [][]string{{"k1", "a", "1", "0"}, {"k2", "a:b", "1", "0"}, {"k:3", "a", "1", "0"}} {
+		require.NoError(t, dbInstance.insertIntoTable(sqlparser.InsertIntoTable{TableName: "t1", ColumnValues: row}))
+	}
+
+	rows, err := dbInstance.selectFromTable(sqlparser.SelectFromTable{
+		TableName:       "t1",
+		ColumnsRequired: []string{"*"},
+		QueryConditions: []sqlparser.QueryCondition{{ColumnName: "c2", QueryType: sqlparser.Equals, Value: "a"}},
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"k1", "a", "1", "0"}, {"k:3", "a", "1", "0"}}, rows)
+
+	rows, err = dbInstance.selectFromTable(sqlparser.SelectFromTable{
+		TableName:       "t1",
+		ColumnsRequired: []string{"*"},
+		QueryConditions: []sqlparser.QueryCondition{{ColumnName: "c1", QueryType: sqlparser.Equals, Value: "k:3"}},
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"k:3", "a", "1", "0"}}, rows)
+}
+
+func TestTablesWithLegacyKeysAreMigratedOnStart(t *testing.T) {
+	dbInstance, config := newDBForWalCommandTest(t)
+	_, _, err := createTestTable(dbInstance, true)
+	require.NoError(t, err)
+
+	// store the rows and index entries the way the tables without an id did
+	require.NoError(t, dbInstance.Delete(fmt.Sprintf(TableIdTemplate, "t1")))
+	legacyKeys := []string{}
+	for _, row := range [][]string{{"k100", "v", "100", "1"}, {"k11", "v", "11", "0"}} {
+		value, err := dbInstance.serialiseRowValues("t1", row, legacyRowIntLength)
+		require.NoError(t, err)
+		legacyKeys = append(legacyKeys,
+			"t1:"+row[0],
+			fmt.Sprintf("index:t1:idxc1:%s:%s", row[0], row[0]),
+			fmt.Sprintf("index:t1:idxc2:%s:%s", row[1], row[0]),
+			fmt.Sprintf("index:t1:idxc3c4:%s:%s:%s", row[2], row[3], row[0]),
+		)
+		require.NoError(t, dbInstance.Put("t1:"+row[0], string(value)))
+		for _, key := range legacyKeys[len(legacyKeys)-3:] {
+			require.NoError(t, dbInstance.Put(key, ""))
+		}
+	}
+	dbInstance.Close()
+
+	dbInstance, err = NewDB(config)
+	require.NoError(t, err)
+	defer dbInstance.Close()
+
+	for _, key := range legacyKeys {
+		it, err := dbInstance.NewIterator(key, key+"\x00")
+		require.NoError(t, err)
+		assert.False(t, it.Valid(), key)
+		require.NoError(t, it.Close())
+	}
+	rows, err := dbInstance.selectFromTable(sqlparser.SelectFromTable{TableName: "t1", ColumnsRequired: []string{"*"}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"k100", "v", "100", "1"}, {"k11", "v", "11", "0"}}, rows)
+	rows, err = dbInstance.selectFromTable(sqlparser.SelectFromTable{
+		TableName:       "t1",
+		ColumnsRequired: []string{"*"},
+		QueryConditions: []sqlparser.QueryCondition{{ColumnName: "c3", QueryType: sqlparser.Equals, Value: "11"}},
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"k11", "v", "11", "0"}}, rows)
+
+	// the next table gets a new id
+	require.NoError(t, dbInstance.CreateTable("CREATE TABLE t2 (name STRING, id INT, PRIMARY KEY (id));"))
+	assert.NotEqual(t, dbInstance.tableNameVsTableIdMap["t1"], dbInstance.tableNameVsTableIdMap["t2"])
+}
+
+func TestNegativeAndLargeIntsRoundTripThroughRowsAndKeys(t *testing.T) {
+	dbInstance, config := newDBForWalCommandTest(t)
+	require.NoError(t, dbInstance.createTable(sqlparser.CreateTable{
+		TableName: "ledger",
+		ColumnDetails: []sqlparser.Column{
+			{ColumnName: "name", DataType: sqlparser.String},
+			{ColumnName: "id", DataType: sqlparser.Int},
+			{ColumnName: "balance", DataType: sqlparser.Int},
+		},
+		PrimaryKeyColumnPosition: 1,
+		SecondaryIndexes:         []sqlparser.SecondaryIndex{{IndexName: "idxbalance", Columns: []string{"balance"}}},
+	}))
+	rows := [][]string{
+		{"min", "-9223372036854775808", "-4294967296"},
+		{"negative", "-5", "-1"},
+		{"zero", "0", "0"},
+		{"beyond_32_bits", "4294967296", "4294967297"},
+		{"max", "9223372036854775807", "9223372036854775807"},
+	}
+	for _, row := range rows {
+		require.NoError(t, dbInstance.insertIntoTable(sqlparser.InsertIntoTable{TableName: "ledger", ColumnValues: row}))
+	}
+	selectLedger := func(dbInstance *DB, input sqlparser.SelectFromTable) [][]string {
+		input.TableName = "ledger"
+		input.ColumnsRequired = []string{"*"}
+		rows, err := dbInstance.selectFromTable(input, nil)
+		require.NoError(t, err)
+		return rows
+	}
+	// a row key and an index entry per row
+	countLedgerKeys := func() int {
+		prefix := binary.BigEndian.AppendUint32([]byte(tupleKeyTag), dbInstance.tableNameVsTableIdMap["ledger"])
+		count := 0
+		require.NoError(t, dbInstance.prefixScan(string(prefix), nil, func(_, _ string) error {
+			count++
+			return nil
+		}))
+		return count
+	}
+
+	assert.Equal(t, rows, selectLedger(dbInstance, sqlparser.SelectFromTable{}))
+	assert.Equal(t, rows[:2], selectLedger(dbInstance, sqlparser.SelectFromTable{
+		QueryConditions: []sqlparser.QueryCondition{{ColumnName: "balance", QueryType: sqlparser.Lt, Value: "0"}},
+	}))
+	assert.Equal(t, [][]string{rows[3]}, selectLedger(dbInstance, sqlparser.SelectFromTable{
+		QueryConditions: []sqlparser.QueryCondition{{ColumnName: "balance", QueryType: sqlparser.Equals, Value: "4294967297"}},
+	}))
+	limit := 2
+	assert.Equal(t, [][]string{rows[4], rows[3]}, selectLedger(dbInstance, sqlparser.SelectFromTable{
+		OrderBy: []sqlparser.OrderByColumn{{ColumnName: "balance", Descending: true}},
+		Limit:   &limit,
+	}))
+
+	// UPDATE and DELETE rebuild the keys of the rows from the values read back from them
+	rowsUpdated, err := dbInstance.updateTable(sqlparser.UpdateTable{
+		TableName:       "ledger",
+		Assignments:     []sqlparser.ColumnAssignment{{ColumnName: "name", Value: "updated"}},
+		QueryConditions: []sqlparser.QueryCondition{{ColumnName: "balance", QueryType: sqlparser.Lte, Value: "-1"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, rowsUpdated)
+	rowsDeleted, err := dbInstance.deleteFromTable(sqlparser.DeleteFromTable{
+		TableName:       "ledger",
+		QueryConditions: []sqlparser.QueryCondition{{ColumnName: "id", QueryType: sqlparser.Gte, Value: "4294967296"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, rowsDeleted)
+	assert.Equal(t, 6, countLedgerKeys())
+
+	expectedRows := [][]string{
+		{"updated", "-9223372036854775808", "-4294967296"},
+		{"updated", "-5", "-1"},
+		{"zero", "0", "0"},
+	}
+	assert.Equal(t, expectedRows, selectLedger(dbInstance, sqlparser.SelectFromTable{}))
+	dbInstance.Close()
+	dbInstance, err = NewDB(config)
+	require.NoError(t, err)
+	defer dbInstance.Close()
+	assert.Equal(t, expectedRows, selectLedger(dbInstance, sqlparser.SelectFromTable{
+		QueryConditions: []sqlparser.QueryCondition{{ColumnName: "balance", QueryType: sqlparser.Lte, Value: "0"}},
+	}))
+}
+
+// asserts that no row or index entry of the table is left under a legacy key.
+func assertNoLegacyKeys(t *testing.T, dbInstance *DB, tableName string) {
+	t.Helper()
+	for _, prefix := range []string{tableName + ":", fmt.Sprintf(IndexKeyTemplateTableNameIndexNamePrefix, tableName, "")} {
+		require.NoError(t, dbInstance.prefixScan(prefix, nil, func(key, _ string) error {
+			t.Errorf("legacy key %q is left", key)
+			return nil
+		}))
+	}
+}
+
+func TestBaselineDataDirectoryIsMigratedOnOpen(t *testing.T) {
+	// see testdata/baseline/README.md for what the data directory holds
+	dir := t.TempDir()
+	require.NoError(t, os.CopyFS(dir, os.DirFS(filepath.Join("..", "testdata", "baseline"))))
+	config := Config{
+		SsTableConfig: sstable.Config{DataFilesDirectory: filepath.Join(dir, "sstable")},
+		WalFilePath:   filepath.Join(dir, "wal.log"),
+	}
+	expectedRows := [][]string{}
+	for i := 0; i < 60; i++ {
+		expectedRows = append(expectedRows, []string{
+			fmt.Sprintf("name%d", i), strconv.Itoa(i), strconv.Itoa((i % 6) * 100), strconv.Itoa(i % 2)})
+	}
+
+	for range 2 {
+		dbInstance, err := NewDB(config)
+		require.NoError(t, err)
+		value, err := dbInstance.Get("greeting")
+		require.NoError(t, err)
+		assert.Equal(t, "hello", value)
+
+		resultSet, err := dbInstance.Query("SELECT * FROM accounts;")
+		require.NoError(t, err)
+		assert.Equal(t, expectedRows, resultSet.Rows)
+		resultSet, err = dbInstance.Query("SELECT id FROM accounts WHERE balance = 300 AND id < 20;")
+		require.NoError(t, err)
+		assert.Equal(t, [][]string{{"3"}, {"9"}, {"15"}}, resultSet.Rows)
+		resultSet, err = dbInstance.Query("SELECT id, balance FROM accounts WHERE balance >= 400 ORDER BY balance DESC, id LIMIT 3;")
+		require.NoError(t, err)
+		assert.Equal(t, [][]string{{"5", "500"}, {"11", "500"}, {"17", "500"}}, resultSet.Rows)
+		assertNoLegacyKeys(t, dbInstance, "accounts")
+		// the migration is complete, so the next open finds the table id and doesn't repeat it
+		assert.Equal(t, uint32(1), dbInstance.tableNameVsTableIdMap["accounts"])
+		dbInstance.Close()
+	}
+}
+
+func TestLegacyTableLargerThanAWalRecordIsMigratedInBatches(t *testing.T) {
+	dbInstance, config := newDBForWalCommandTest(t)
+	_, _, err := createTestTable(dbInstance, true)
+	require.NoError(t, err)
+	require.NoError(t, dbInstance.Delete(fmt.Sprintf(TableIdTemplate, "t1")))
+	// about 1.2MB of rows, along with their index entries
+	name := strings.Repeat("n", 1000)
+	batch := &WriteBatch{}
+	for i := 0; i < 1200; i++ {
+		row := []string{fmt.Sprintf("k%04d", i), name, strconv.Itoa(i), "0"}
+		value, err := dbInstance.serialiseRowValues("t1", row, legacyRowIntLength)
+		require.NoError(t, err)
+		batch.Put("t1:"+row[0], string(value))
+		batch.Put(fmt.Sprintf("index:t1:idxc1:%s:%s", row[0], row[0]), "")
+		batch.Put(fmt.Sprintf("index:t1:idxc2:%s:%s", row[1], row[0]), "")
+		batch.Put(fmt.Sprintf("index:t1:idxc3c4:%s:%s:%s", row[2], row[3], row[0]), "")
+		if i%100 == 99 {
+			require.NoError(t, dbInstance.Write(batch))
+			batch.Reset()
+		}
+	}
+	dbInstance.Close()
+
+	dbInstance, err = NewDB(config)
+	require.NoError(t, err)
+	defer dbInstance.Close()
+	assertNoLegacyKeys(t, dbInstance, "t1")
+	rows := selectT1Rows(t, dbInstance)
+	require.Len(t, rows, 1200)
+	assert.Equal(t, []string{"k1199", name, "1199", "0"}, rows[1199])
+	assert.Equal(t, [][]string{{"k0100", name, "100", "0"}}, selectT1Rows(t, dbInstance,
+		sqlparser.QueryCondition{ColumnName: "c3", QueryType: sqlparser.Equals, Value: "100"},
+		sqlparser.QueryCondition{ColumnName: "c4", QueryType: sqlparser.Equals, Value: "0"}))
+	assert.Equal(t, 4*1200, countT1Keys(t, dbInstance))
+}
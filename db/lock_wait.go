@@ -0,0 +1,88 @@
+package db
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+const defaultLockWaitTimeout = time.Second
+
+var (
+	// ErrDeadlock is returned when waiting for a lock would close a cycle of transactions waiting for
+	// each other. the transaction which asked for the lock is rolled back.
+	ErrDeadlock = errors.New("transaction aborted to resolve a deadlock")
+	// ErrLockWaitTimeout is returned when a lock isn't handed over within the lock wait timeout.
+	ErrLockWaitTimeout = errors.New("lock wait timed out")
+)
+
+// lockWaiter is a transaction queued for the write lock of a key.
+type lockWaiter struct {
+	txn *Transaction
+	// closed once the lock is handed over to the transaction
+	granted chan struct{}
+}
+
+// returns the ids of the transactions which the transaction waits for: the holder of the lock it is
+// queued for and the transactions queued before it, as they get the lock first.
+// these are the edges of the wait-for graph. must be called with tm.mu held.
+func (tm *transactionManager) waitsFor(txnId uint64) []uint64 {
+	key, ok := tm.txnIdVsAwaitedKeyMap[txnId]
+	if !ok {
+		return nil
+	}
+	locksAcquired := tm.keyVsLocksAcquiredMap[key]
+	txnIds := []uint64{locksAcquired.writerTxnId}
+	for _, waiter := range locksAcquired.waiters {
+		if waiter.txn.id == txnId {
+			break
+		}
+		txnIds = append(txnIds, waiter.txn.id)
+	}
+	return txnIds
+}
+
+// returns true if the wait-for graph has a path from the transaction back to itself.
+// must be called with tm.mu held.
+func (tm *transactionManager) isDeadlocked(txnId uint64) bool {
+	visited := map[uint64]bool{}
+	pending := tm.waitsFor(txnId)
+	for len(pending) > 0 {
+		next := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		if next == txnId {
+			return true
+		}
+		if visited[next] {
+			continue
+		}
+		visited[next] = true
+		pending = append(pending, tm.waitsFor(next)...)
+	}
+	return false
+}
+
+// hands the write lock of the key over to the transaction which has waited for it the longest.
+// the lock is freed if no transaction waits for it. must be called with tm.mu held.
+func (tm *transactionManager) grantToNextWaiter(key string, locksAcquired *LocksAcquired) {
+	if len(locksAcquired.waiters) == 0 {
+		delete(tm.keyVsLocksAcquiredMap, key)
+		return
+	}
+	waiter := locksAcquired.waiters[0]
+	locksAcquired.waiters = locksAcquired.waiters[1:]
+	locksAcquired.writerTxnId = waiter.txn.id
+	// the waiting transaction is blocked till granted is closed, so its keys can be updated here
+	waiter.txn.lockAcquiredKeys = append(waiter.txn.lockAcquiredKeys, key)
+	delete(tm.txnIdVsAwaitedKeyMap, waiter.txn.id)
+	close(waiter.granted)
+}
+
+// removes a transaction which gave up waiting from the queue of the key. must be called with tm.mu held.
+func (tm *transactionManager) removeWaiter(key string, waiter *lockWaiter) {
+	locksAcquired := tm.keyVsLocksAcquiredMap[key]
+	locksAcquired.waiters = slices.DeleteFunc(locksAcquired.waiters, func(w *lockWaiter) bool {
+		return w == waiter
+	})
+	delete(tm.txnIdVsAwaitedKeyMap, waiter.txn.id)
+}
@@ -0,0 +1,157 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func waitForLockWaiters(t *testing.T, dbInstance *DB, key string, count int) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		dbInstance.transactionManager.mu.Lock()
+		defer dbInstance.transactionManager.mu.Unlock()
+		locksAcquired, ok := dbInstance.transactionManager.keyVsLocksAcquiredMap[key]
+		return ok && len(locksAcquired.waiters) == count
+	}, time.Second, time.Millisecond)
+}
+
+func TestPutWaitsForWriteLockToBeReleased(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	holder, err := dbInstance.Begin()
+	require.NoError(t, err)
+	require.NoError(t, holder.Put("key", "value by holder"))
+
+	waiter, err := dbInstance.Begin()
+	require.NoError(t, err)
+	putErr := make(chan error)
+	go func() {
+		putErr <- waiter.Put("key", "value by waiter")
+	}()
+	waitForLockWaiters(t, dbInstance, "key", 1)
+
+	holder.Rollback()
+	require.NoError(t, <-putErr)
+	require.NoError(t, waiter.Commit())
+	value, err := dbInstance.Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "value by waiter", value)
+	assert.Empty(t, dbInstance.transactionManager.keyVsLocksAcquiredMap)
+}
+
+func TestWaitersFailWithWriteConflictAsSoonAsTheHolderCommits(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	holder, err := dbInstance.Begin()
+	require.NoError(t, err)
+	require.NoError(t, holder.Put("key", "value by holder"))
+
+	putErrs := make(chan error, 3)
+	waiters := []*Transaction{}
+	for i := 0; i < 3; i++ {
+		waiter, err := dbInstance.Begin()
+		require.NoError(t, err)
+		waiters = append(waiters, waiter)
+		go func() {
+			putErrs <- waiter.Put("key", "value by waiter")
+		}()
+		waitForLockWaiters(t, dbInstance, "key", i+1)
+	}
+
+	start := time.Now()
+	require.NoError(t, holder.Commit())
+	// the waiters started before the commit, so none of them can write the key. each of them hands the
+	// lock over on failing, none waits for the lock wait timeout.
+	for i := 0; i < 3; i++ {
+		assert.EqualError(t, <-putErrs, WriteConflictError)
+	}
+	assert.Less(t, time.Since(start), dbInstance.transactionManager.lockWaitTimeout)
+	assert.Empty(t, dbInstance.transactionManager.keyVsLocksAcquiredMap)
+	for _, waiter := range waiters {
+		require.NoError(t, waiter.Commit())
+	}
+	value, err := dbInstance.Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "value by holder", value)
+}
+
+func TestWaitersAreGrantedTheLockInArrivalOrder(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	holder, err := dbInstance.Begin()
+	require.NoError(t, err)
+	require.NoError(t, holder.Put("key", "value"))
+
+	granted := make(chan int, 3)
+	waiters := []*Transaction{}
+	for i := 0; i < 3; i++ {
+		waiter, err := dbInstance.Begin()
+		require.NoError(t, err)
+		waiters = append(waiters, waiter)
+		go func() {
+			assert.NoError(t, waiter.Put("key", "value"))
+			granted <- i
+		}()
+		waitForLockWaiters(t, dbInstance, "key", i+1)
+	}
+
+	holder.Rollback()
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, i, <-granted)
+		waiters[i].Rollback()
+	}
+}
+
+func TestLockWaitClosingACycleAbortsTheTransactionWithErrDeadlock(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	txn1, err := dbInstance.Begin()
+	require.NoError(t, err)
+	txn2, err := dbInstance.Begin()
+	require.NoError(t, err)
+	require.NoError(t, txn1.Put("key_1", "value by txn1"))
+	require.NoError(t, txn2.Put("key_2", "value by txn2"))
+
+	putErr := make(chan error)
+	go func() {
+		putErr <- txn2.Put("key_1", "value by txn2")
+	}()
+	waitForLockWaiters(t, dbInstance, "key_1", 1)
+
+	// txn1 waiting for key_2 would wait for txn2, which waits for txn1
+	assert.ErrorIs(t, txn1.Put("key_2", "value by txn1"), ErrDeadlock)
+	require.NoError(t, <-putErr)
+	assert.EqualError(t, txn1.Commit(), TransactionFinishedError)
+	require.NoError(t, txn2.Commit())
+
+	for _, key := range []string{"key_1", "key_2"} {
+		value, err := dbInstance.Get(key)
+		require.NoError(t, err)
+		assert.Equal(t, "value by txn2", value)
+	}
+}
+
+func TestLockWaitTimesOut(t *testing.T) {
+	dbInstance, cleanupFunc, err := newDBForTest()
+	defer cleanupFunc()
+	require.NoError(t, err)
+
+	holder, err := dbInstance.Begin()
+	require.NoError(t, err)
+	require.NoError(t, holder.Put("key", "value"))
+	waiter, err := dbInstance.Begin()
+	require.NoError(t, err)
+
+	assert.ErrorIs(t, waiter.Put("key", "value"), ErrLockWaitTimeout)
+	// the waiter left the queue, so the lock is freed on rollback
+	holder.Rollback()
+	assert.Empty(t, dbInstance.transactionManager.keyVsLocksAcquiredMap)
+	assert.Empty(t, dbInstance.transactionManager.txnIdVsAwaitedKeyMap)
+}
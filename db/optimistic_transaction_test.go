@@ -0,0 +1,120 @@
+package db
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOptimisticCommitFailsIfReadKeyWasUpdated(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	require.NoError(t, dbInstance.Put("balance", "100"))
+	txn, err := dbInstance.BeginOptimistic()
+	require.NoError(t, err)
+	value, err := txn.Get("balance")
+	require.NoError(t, err)
+	assert.Equal(t, "100", value)
+	require.NoError(t, txn.Put("audit", "read 100"))
+
+	require.NoError(t, dbInstance.Put("balance", "50"))
+	assert.ErrorIs(t, txn.Commit(), ErrConflict)
+	assert.EqualError(t, txn.Commit(), TransactionFinishedError)
+
+	value, err = dbInstance.Get("audit")
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+}
+
+func TestOptimisticCommitFailsIfReadMissingKeyWasInserted(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	txn, err := dbInstance.BeginOptimistic()
+	require.NoError(t, err)
+	value, err := txn.Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+
+	require.NoError(t, dbInstance.Put("key", "value"))
+	assert.ErrorIs(t, txn.Commit(), ErrConflict)
+}
+
+func TestOptimisticWritesTakeNoLocksAndFirstCommitterWins(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	txn1, err := dbInstance.BeginOptimistic()
+	require.NoError(t, err)
+	txn2, err := dbInstance.BeginOptimistic()
+	require.NoError(t, err)
+	require.NoError(t, txn1.Put("key", "value by txn1"))
+	require.NoError(t, txn2.Put("key", "value by txn2"))
+	require.NoError(t, txn2.Put("other_key", "value by txn2"))
+	assert.Empty(t, dbInstance.transactionManager.keyVsLocksAcquiredMap)
+
+	require.NoError(t, txn1.Commit())
+	assert.ErrorIs(t, txn2.Commit(), ErrConflict)
+	value, err := dbInstance.Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "value by txn1", value)
+}
+
+func TestOptimisticCommitSucceedsIfOnlyOtherKeysWereUpdated(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	require.NoError(t, dbInstance.Put("key", "value"))
+	txn, err := dbInstance.BeginOptimistic()
+	require.NoError(t, err)
+	_, err = txn.Get("key")
+	require.NoError(t, err)
+	require.NoError(t, txn.Put("key", "new value"))
+
+	require.NoError(t, dbInstance.Put("other_key", "value"))
+	require.NoError(t, txn.Commit())
+	value, err := dbInstance.Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "new value", value)
+}
+
+// the commits are validated one after the other by the group commit leader, so no increment is lost
+// even when the conflicting commits are in the same group.
+func TestConcurrentOptimisticIncrementsAreNotLost(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	require.NoError(t, dbInstance.Put("counter", "0"))
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				txn, err := dbInstance.BeginOptimistic()
+				require.NoError(t, err)
+				value, err := txn.Get("counter")
+				require.NoError(t, err)
+				counter, err := strconv.Atoi(value)
+				require.NoError(t, err)
+				require.NoError(t, txn.Put("counter", strconv.Itoa(counter+1)))
+				err = txn.Commit()
+				if errors.Is(err, ErrConflict) {
+					continue
+				}
+				assert.NoError(t, err)
+				return
+			}
+		}()
+	}
+	wg.Wait()
+
+	value, err := dbInstance.Get("counter")
+	require.NoError(t, err)
+	assert.Equal(t, "20", value)
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"testing"
+
+	sqlparser "github.com/golang-db/sql_parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runs the query, projecting the id column of table scores, and returns the ids with the number of keys scanned.
+func queryScoreIds(t *testing.T, dbInstance *DB, query string) ([]string, int) {
+	t.Helper()
+	snapshot := dbInstance.NewSnapshot()
+	defer snapshot.Release()
+	return queryScoreIdsWithReader(t, dbInstance, query, snapshot)
+}
+
+// runs the query like queryScoreIds, reading the rows through the given reader.
+func queryScoreIdsWithReader(t *testing.T, dbInstance *DB, query string, rowReader rowReader) ([]string, int) {
+	t.Helper()
+	input, err := sqlparser.NewParser(query).ParseSelectFromTable()
+	require.NoError(t, err)
+	reader := &countingReader{rowReader: rowReader}
+	rows, err := dbInstance.selectRows(*input, reader)
+	require.NoError(t, err)
+	ids := []string{}
+	for _, row := range rows {
+		ids = append(ids, row[0])
+	}
+	return ids, reader.keysScanned
+}
+
+func TestOrderByPrimaryKeyWithLimitStopsTheScanEarly(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	createScoresTable(t, dbInstance)
+
+	ids, keysScanned := queryScoreIds(t, dbInstance, "SELECT id FROM scores ORDER BY id LIMIT 5;")
+	assert.Equal(t, []string{"0", "1", "2", "3", "4"}, ids)
+	assert.Equal(t, 5, keysScanned)
+
+	ids, keysScanned = queryScoreIds(t, dbInstance, "SELECT id FROM scores ORDER BY id ASC LIMIT 3 OFFSET 10;")
+	assert.Equal(t, []string{"10", "11", "12"}, ids)
+	assert.Equal(t, 13, keysScanned)
+
+	// the rows not matching the other conditions are skipped without counting towards the limit. the index
+	// keys with score 3 are read in the order of the primary key until the second one above 50.
+	ids, keysScanned = queryScoreIds(t, dbInstance, "SELECT id FROM scores WHERE id >= 50 AND score = 3 ORDER BY id LIMIT 2;")
+	assert.Equal(t, []string{"53", "63"}, ids)
+	assert.Equal(t, 7, keysScanned)
+
+	// the ids are compared as integers and not as strings
+	ids, _ = queryScoreIds(t, dbInstance, "SELECT id FROM scores WHERE id >= 8 ORDER BY id LIMIT 4;")
+	assert.Equal(t, []string{"8", "9", "10", "11"}, ids)
+
+	ids, keysScanned = queryScoreIds(t, dbInstance, "SELECT id FROM scores ORDER BY id LIMIT 0;")
+	assert.Empty(t, ids)
+	assert.Equal(t, 0, keysScanned)
+
+	ids, _ = queryScoreIds(t, dbInstance, "SELECT id FROM scores ORDER BY id OFFSET 98;")
+	assert.Equal(t, []string{"98", "99"}, ids)
+	ids, _ = queryScoreIds(t, dbInstance, "SELECT id FROM scores ORDER BY id LIMIT 5 OFFSET 200;")
+	assert.Empty(t, ids)
+}
+
+func TestOrderByPrimaryKeyWithLimitStopsTheScanEarlyWithinATransaction(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	createScoresTable(t, dbInstance)
+
+	txn, err := dbInstance.Begin()
+	require.NoError(t, err)
+	defer txn.Rollback()
+	rowsDeleted, err := txn.DeleteFromTable("DELETE FROM scores WHERE id <= 2;")
+	require.NoError(t, err)
+	require.Equal(t, 3, rowsDeleted)
+	_, err = txn.UpdateTable("UPDATE scores SET score = 8 WHERE id = 4;")
+	require.NoError(t, err)
+
+	// the buffered writes are merged into the scan in the order of the keys, and the deleted rows are skipped
+	// without being read by the query
+	ids, keysScanned := queryScoreIdsWithReader(t, dbInstance, "SELECT id FROM scores ORDER BY id LIMIT 3;", txn)
+	assert.Equal(t, []string{"3", "4", "5"}, ids)
+	assert.Equal(t, 3, keysScanned)
+	ids, _ = queryScoreIdsWithReader(t, dbInstance, "SELECT id FROM scores WHERE score = 8 ORDER BY id LIMIT 2;", txn)
+	assert.Equal(t, []string{"4", "8"}, ids)
+}
+
+func TestOrderBySecondaryIndexColumnsUsesTheIndexOrder(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	createScoresTable(t, dbInstance)
+
+	// the index keys with score 3 are in the order of the primary key
+	ids, keysScanned := queryScoreIds(t, dbInstance, "SELECT id FROM scores WHERE score = 3 ORDER BY id LIMIT 3;")
+	assert.Equal(t, []string{"3", "13", "23"}, ids)
+	assert.Equal(t, 3, keysScanned)
+
+	// the ORDER BY column having an equality condition doesn't change the order
+	ids, keysScanned = queryScoreIds(t, dbInstance,
+		"SELECT id FROM scores WHERE active = 1 AND score > 4 ORDER BY active, score, id LIMIT 4;")
+	assert.Equal(t, []string{"5", "15", "25", "35"}, ids)
+	assert.Equal(t, 4, keysScanned)
+}
+
+func TestOrderBySortsWhenTheScanOrderDoesNotMatch(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	createScoresTable(t, dbInstance)
+
+	// DESC is not served by the index order, so all the matching rows are read and sorted even under a LIMIT
+	ids, keysScanned := queryScoreIds(t, dbInstance, "SELECT id FROM scores ORDER BY id DESC LIMIT 3;")
+	assert.Equal(t, []string{"99", "98", "97"}, ids)
+	assert.Equal(t, 100, keysScanned)
+	ids, keysScanned = queryScoreIds(t, dbInstance, "SELECT id FROM scores WHERE score = 3 ORDER BY score, id DESC LIMIT 2;")
+	assert.Equal(t, []string{"93", "83"}, ids)
+	assert.Equal(t, 10, keysScanned)
+
+	// the rows having the same score are in the order of the next ORDER BY column
+	ids, _ = queryScoreIds(t, dbInstance, "SELECT id FROM scores WHERE id < 30 ORDER BY score DESC, id LIMIT 4 OFFSET 1;")
+	assert.Equal(t, []string{"19", "29", "8", "18"}, ids)
+
+	// the names are compared as strings
+	ids, _ = queryScoreIds(t, dbInstance, "SELECT id, name FROM scores WHERE id <= 11 ORDER BY name;")
+	assert.Equal(t, []string{"0", "1", "10", "11", "2", "3", "4", "5", "6", "7", "8", "9"}, ids)
+}
+
+func TestOrderByMissingColumnFails(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	createScoresTable(t, dbInstance)
+
+	_, err := dbInstance.Query("SELECT id FROM scores ORDER BY rank;")
+	assert.EqualError(t, err, "column: 'rank' not found")
+}
+
+func TestQueryWithOrderByAndLimit(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	createScoresTable(t, dbInstance)
+
+	resultSet, err := dbInstance.Query("SELECT name, score FROM scores WHERE score >= 8 ORDER BY score DESC, name DESC LIMIT 3;")
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"n99", "9"}, {"n9", "9"}, {"n89", "9"}}, resultSet.Rows)
+}
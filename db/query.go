@@ -0,0 +1,47 @@
+package db
+
+import (
+	sqlparser "github.com/golang-db/sql_parser"
+)
+
+// ResultColumn is a column of the rows returned by a query.
+type ResultColumn struct {
+	Name     string
+	DataType sqlparser.DataType
+}
+
+// ResultSet is the result of a SELECT query. every row has a value for each of the columns, in the same order.
+type ResultSet struct {
+	Columns []ResultColumn
+	Rows    [][]string
+}
+
+// Query runs the SELECT query on the newest committed rows.
+func (db *DB) Query(query string) (*ResultSet, error) {
+	return db.QueryFromSnapshot(query, nil)
+}
+
+// QueryFromSnapshot runs the SELECT query on the rows committed before the snapshot was created. the queries
+// run on the same snapshot see the same rows, so a report made of several queries is consistent without
+// a transaction. a nil snapshot reads the newest committed rows like Query.
+func (db *DB) QueryFromSnapshot(query string, snapshot *Snapshot) (*ResultSet, error) {
+	parser := sqlparser.NewParser(query)
+	input, err := parser.ParseSelectFromTable()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.selectFromTable(*input, snapshot)
+	if err != nil {
+		return nil, err
+	}
+	colPositions, err := db.getProjectedColumnPositions(input.TableName, input.ColumnsRequired)
+	if err != nil {
+		return nil, err
+	}
+	columns := []ResultColumn{}
+	for _, colPos := range colPositions {
+		col := db.tableNameVsSchemaMap[input.TableName].ColumnDetails[colPos]
+		columns = append(columns, ResultColumn{Name: col.ColumnName, DataType: col.DataType})
+	}
+	return &ResultSet{Columns: columns, Rows: rows}, nil
+}
@@ -0,0 +1,115 @@
+package db
+
+import (
+	"testing"
+
+	sqlparser "github.com/golang-db/sql_parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryReturnsColumnsWithTheRows(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	require.NoError(t, dbInstance.CreateTable("CREATE TABLE student (age INT, id STRING, isActive BOOL, PRIMARY KEY (id));"))
+	require.NoError(t, dbInstance.InsertIntoTable("INSERT INTO student VALUES (15, id1, 1)"))
+	require.NoError(t, dbInstance.InsertIntoTable("INSERT INTO student VALUES (16, id2, 0)"))
+
+	resultSet, err := dbInstance.Query("SELECT * FROM student WHERE age > 15;")
+	require.NoError(t, err)
+	assert.Equal(t, &ResultSet{
+		Columns: []ResultColumn{
+			{Name: "age", DataType: sqlparser.Int},
+			{Name: "id", DataType: sqlparser.String},
+			{Name: "isActive", DataType: sqlparser.Bool},
+		},
+		Rows: [][]string{{"16", "id2", "0"}},
+	}, resultSet)
+
+	_, err = dbInstance.Query("SELECT * FROM teacher;")
+	assert.EqualError(t, err, "table with name \"teacher\" not found")
+	_, err = dbInstance.Query("SELECT * FROM student")
+	assert.Error(t, err)
+}
+
+func TestQueryReturnsTheProjectedColumnsInTheRequestedOrder(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	_, _, err := createTestTable(dbInstance, true)
+	require.NoError(t, err)
+	insertT1Rows(t, dbInstance, []string{"k1", "a", "1", "0"}, []string{"k2", "b", "2", "1"})
+
+	resultSet, err := dbInstance.Query("SELECT c3, c1 FROM t1 WHERE c4 = 1;")
+	require.NoError(t, err)
+	assert.Equal(t, []ResultColumn{{Name: "c3", DataType: sqlparser.Int}, {Name: "c1", DataType: sqlparser.String}}, resultSet.Columns)
+	assert.Equal(t, [][]string{{"2", "k2"}}, resultSet.Rows)
+
+	// the star expands to all the columns wherever it is in the list
+	resultSet, err = dbInstance.Query("SELECT c2, * FROM t1 WHERE c1 = k1;")
+	require.NoError(t, err)
+	assert.Len(t, resultSet.Columns, 5)
+	assert.Equal(t, [][]string{{"a", "k1", "a", "1", "0"}}, resultSet.Rows)
+
+	// the filtered column isn't projected
+	resultSet, err = dbInstance.Query("SELECT c2 FROM t1 WHERE c3 > 1;")
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"b"}}, resultSet.Rows)
+
+	_, err = dbInstance.Query("SELECT c1, c9 FROM t1;")
+	assert.EqualError(t, err, "column: 'c9' not found")
+}
+
+func TestDeserializeRowValuesDecodesOnlyTheNeededColumns(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	_, _, err := createTestTable(dbInstance, true)
+	require.NoError(t, err)
+	_, value, err := dbInstance.serialiseInsertIntoTableInput(sqlparser.InsertIntoTable{
+		TableName: "t1", ColumnValues: []string{"k1", "a", "1", "0"}})
+	require.NoError(t, err)
+
+	rowValues, err := dbInstance.deserializeRowValues("t1", string(value), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"k1", "a", "1", "0"}, rowValues)
+	rowValues, err = dbInstance.deserializeRowValues("t1", string(value), []bool{false, true, false, false})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"", "a", "", ""}, rowValues)
+	// the values after the last needed column aren't read, even if they are missing
+	rowValues, err = dbInstance.deserializeRowValues("t1", string(value[:len(value)-9]), []bool{true, true, false, false})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"k1", "a", "", ""}, rowValues)
+}
+
+func TestQueriesFromASnapshotSeeTheSameRowsAcrossAFlush(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	_, _, err := createTestTable(dbInstance, true)
+	require.NoError(t, err)
+	insertT1Rows(t, dbInstance, []string{"k1", "a", "1", "0"}, []string{"k2", "b", "2", "1"})
+	snapshot := dbInstance.NewSnapshot()
+	defer snapshot.Release()
+
+	// the writes after the snapshot are flushed along with the rows it reads
+	insertT1Rows(t, dbInstance, []string{"k3", "c", "3", "0"})
+	_, err = dbInstance.UpdateTable("UPDATE t1 SET c2 = updated WHERE c1 = k1;")
+	require.NoError(t, err)
+	_, err = dbInstance.DeleteFromTable("DELETE FROM t1 WHERE c1 = k2;")
+	require.NoError(t, err)
+	putKeysUntilFlush(t, dbInstance, "filler")
+
+	resultSet, err := dbInstance.QueryFromSnapshot("SELECT c1, c2 FROM t1;", snapshot)
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"k1", "a"}, {"k2", "b"}}, resultSet.Rows)
+	// an index scan reads the same snapshot
+	resultSet, err = dbInstance.QueryFromSnapshot("SELECT c1 FROM t1 WHERE c3 >= 2;", snapshot)
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"k2"}}, resultSet.Rows)
+
+	resultSet, err = dbInstance.Query("SELECT c1, c2 FROM t1;")
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"k1", "updated"}, {"k3", "c"}}, resultSet.Rows)
+
+	snapshot.Release()
+	_, err = dbInstance.QueryFromSnapshot("SELECT * FROM t1;", snapshot)
+	assert.EqualError(t, err, SnapshotReleasedError)
+}
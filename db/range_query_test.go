@@ -0,0 +1,200 @@
+package db
+
+import (
+	"strconv"
+	"testing"
+
+	sqlparser "github.com/golang-db/sql_parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingReader counts the keys read by the range scans of a query.
+type countingReader struct {
+	rowReader
+	keysScanned int
+}
+
+func (r *countingReader) rangeScan(lower, upper string, fn func(key, value string) error) error {
+	return r.rowReader.rangeScan(lower, upper, func(key, value string) error {
+		r.keysScanned++
+		return fn(key, value)
+	})
+}
+
+// creates table scores (name STRING, id INT, score INT, active BOOL) with the primary key id and
+// inserts the rows with ids 0 to 99, score id % 10 and active id % 2.
+func createScoresTable(t *testing.T, dbInstance *DB) {
+	t.Helper()
+	require.NoError(t, dbInstance.createTable(sqlparser.CreateTable{
+		TableName: "scores",
+		ColumnDetails: []sqlparser.Column{
+			{ColumnName: "name", DataType: sqlparser.String},
+			{ColumnName: "id", DataType: sqlparser.Int},
+			{ColumnName: "score", DataType: sqlparser.Int},
+			{ColumnName: "active", DataType: sqlparser.Bool},
+		},
+		PrimaryKeyColumnPosition: 1,
+		SecondaryIndexes: []sqlparser.SecondaryIndex{
+			{IndexName: "idxscore", Columns: []string{"score"}},
+			{IndexName: "idxactivescore", Columns: []string{"active", "score"}},
+		},
+	}))
+	for i := 0; i < 100; i++ {
+		require.NoError(t, dbInstance.insertIntoTable(sqlparser.InsertIntoTable{
+			TableName:    "scores",
+			ColumnValues: []string{"n" + strconv.Itoa(i), strconv.Itoa(i), strconv.Itoa(i % 10), strconv.Itoa(i % 2)},
+		}))
+	}
+}
+
+func selectScores(t *testing.T, dbInstance *DB, queryConditions ...sqlparser.QueryCondition) ([]string, int) {
+	t.Helper()
+	snapshot := dbInstance.NewSnapshot()
+	defer snapshot.Release()
+	reader := &countingReader{rowReader: snapshot}
+	rows, err := dbInstance.selectRows(sqlparser.SelectFromTable{
+		TableName:       "scores",
+		ColumnsRequired: []string{"*"},
+		QueryConditions: queryConditions,
+	}, reader)
+	require.NoError(t, err)
+	ids := []string{}
+	for _, row := range rows {
+		ids = append(ids, row[1])
+	}
+	return ids, reader.keysScanned
+}
+
+func idsInRange(start, end, step int) []string {
+	ids := []string{}
+	for i := start; i < end; i += step {
+		ids = append(ids, strconv.Itoa(i))
+	}
+	return ids
+}
+
+func TestPrimaryKeyRangeQueryReadsOnlyTheMatchingRows(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	createScoresTable(t, dbInstance)
+
+	ids, keysScanned := selectScores(t, dbInstance,
+		sqlparser.QueryCondition{ColumnName: "id", QueryType: sqlparser.Gte, Value: "10"},
+		sqlparser.QueryCondition{ColumnName: "id", QueryType: sqlparser.Lt, Value: "50"})
+	assert.Equal(t, idsInRange(10, 50, 1), ids)
+	assert.Equal(t, 40, keysScanned)
+
+	// compared as numbers, 9 < 10 even though "9" > "10"
+	ids, keysScanned = selectScores(t, dbInstance,
+		sqlparser.QueryCondition{ColumnName: "id", QueryType: sqlparser.Gt, Value: "89"},
+		sqlparser.QueryCondition{ColumnName: "id", QueryType: sqlparser.Lte, Value: "200"})
+	assert.Equal(t, idsInRange(90, 100, 1), ids)
+	assert.Equal(t, 10, keysScanned)
+
+	// the conditions on the other columns are applied to the rows read
+	ids, keysScanned = selectScores(t, dbInstance,
+		sqlparser.QueryCondition{ColumnName: "id", QueryType: sqlparser.Lt, Value: "20"},
+		sqlparser.QueryCondition{ColumnName: "name", QueryType: sqlparser.Equals, Value: "n15"})
+	assert.Equal(t, []string{"15"}, ids)
+	assert.Equal(t, 20, keysScanned)
+
+	ids, keysScanned = selectScores(t, dbInstance,
+		sqlparser.QueryCondition{ColumnName: "id", QueryType: sqlparser.Gt, Value: "50"},
+		sqlparser.QueryCondition{ColumnName: "id", QueryType: sqlparser.Lt, Value: "10"})
+	assert.Empty(t, ids)
+	assert.Equal(t, 0, keysScanned)
+}
+
+func TestSecondaryIndexRangeQueryReadsOnlyTheMatchingIndexEntries(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	createScoresTable(t, dbInstance)
+
+	// 8 and 9 of every 10 rows, in the order of the index
+	ids, keysScanned := selectScores(t, dbInstance,
+		sqlparser.QueryCondition{ColumnName: "score", QueryType: sqlparser.Gt, Value: "7"})
+	assert.Equal(t, append(idsInRange(8, 100, 10), idsInRange(9, 100, 10)...), ids)
+	assert.Equal(t, 20, keysScanned)
+
+	// the range on the column after the equality prefix of the composite index
+	ids, keysScanned = selectScores(t, dbInstance,
+		sqlparser.QueryCondition{ColumnName: "active", QueryType: sqlparser.Equals, Value: "1"},
+		sqlparser.QueryCondition{ColumnName: "score", QueryType: sqlparser.Gte, Value: "3"},
+		sqlparser.QueryCondition{ColumnName: "score", QueryType: sqlparser.Lte, Value: "5"})
+	assert.Equal(t, append(idsInRange(3, 100, 10), idsInRange(5, 100, 10)...), ids)
+	assert.Equal(t, 20, keysScanned)
+}
+
+func TestEqualityOnSecondaryIndexIsPreferredOverPrimaryKeyRange(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	createScoresTable(t, dbInstance)
+
+	ids, keysScanned := selectScores(t, dbInstance,
+		sqlparser.QueryCondition{ColumnName: "score", QueryType: sqlparser.Equals, Value: "4"},
+		sqlparser.QueryCondition{ColumnName: "id", QueryType: sqlparser.Lt, Value: "50"})
+	assert.Equal(t, idsInRange(4, 50, 10), ids)
+	assert.Equal(t, 10, keysScanned)
+}
+
+func TestQueryConditionsCompareValuesAsPerDataType(t *testing.T) {
+	applicable, err := isQueryConditionApplicable([]string{"100"}, 0, sqlparser.Int,
+		sqlparser.QueryCondition{QueryType: sqlparser.Gt, Value: "11"})
+	require.NoError(t, err)
+	assert.True(t, applicable)
+
+	applicable, err = isQueryConditionApplicable([]string{"100"}, 0, sqlparser.String,
+		sqlparser.QueryCondition{QueryType: sqlparser.Gt, Value: "11"})
+	require.NoError(t, err)
+	assert.False(t, applicable)
+
+	_, err = isQueryConditionApplicable([]string{"100"}, 0, sqlparser.Int,
+		sqlparser.QueryCondition{QueryType: sqlparser.Gt, Value: "abc"})
+	assert.Error(t, err)
+}
+
+func TestRangeScanOfAPrefixMadeOnlyOf0xffBytesIsUnbounded(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	_, _, err := createTestTable(dbInstance, false)
+	require.NoError(t, err)
+	// no key greater than all the keys having the prefix exists, so the upper bound is unbounded
+	prefix := "\xff\xff"
+	rowKey := func(c3 string) string {
+		buf, err := appendTupleColumn([]byte(prefix), sqlparser.Int, c3)
+		require.NoError(t, err)
+		return string(buf)
+	}
+	rows := [][]string{{"k1", "a", "1", "0"}, {"k5", "b", "5", "1"}, {"k9", "c", "9", "0"}}
+	for _, row := range rows {
+		value, err := dbInstance.serialiseRowValues("t1", row, rowIntLength)
+		require.NoError(t, err)
+		require.NoError(t, dbInstance.Put(rowKey(row[2]), string(value)))
+	}
+	scan := func(conditions ...sqlparser.QueryCondition) [][]string {
+		lower, upper, err := getRangeScanBounds(prefix, sqlparser.Int, conditions)
+		require.NoError(t, err)
+		snapshot := dbInstance.NewSnapshot()
+		defer snapshot.Release()
+		scannedRows := [][]string{}
+		require.NoError(t, dbInstance.rowRangeScan("t1", lower, upper, nil, snapshot, func(row []string) error {
+			scannedRows = append(scannedRows, row)
+			return nil
+		}))
+		return scannedRows
+	}
+
+	lower, upper, err := getRangeScanBounds(prefix, sqlparser.Int, nil)
+	require.NoError(t, err)
+	assert.Equal(t, prefix, lower)
+	assert.Equal(t, "", upper)
+	assert.Equal(t, rows, scan())
+	assert.Equal(t, rows[1:], scan(sqlparser.QueryCondition{QueryType: sqlparser.Gte, Value: "5"}))
+	assert.Equal(t, rows[2:], scan(sqlparser.QueryCondition{QueryType: sqlparser.Gt, Value: "5"}))
+	assert.Equal(t, rows[:2], scan(sqlparser.QueryCondition{QueryType: sqlparser.Lte, Value: "5"}))
+	assert.Equal(t, rows[1:2], scan(
+		sqlparser.QueryCondition{QueryType: sqlparser.Gt, Value: "1"},
+		sqlparser.QueryCondition{QueryType: sqlparser.Lt, Value: "9"},
+	))
+}
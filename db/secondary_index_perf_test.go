@@ -25,7 +25,7 @@ func newDBForTestForDir(dirNum int) (*DB, func(), error) {
 	})
 	cleanupFunc := func() {
 		defer os.RemoveAll(dataFilesDirectory)
-		defer os.Remove(walFilePath)
+		defer removeWalSegments(walFilePath)
 	}
 	return dbInstance, cleanupFunc, err
 }
@@ -73,7 +73,7 @@ func benchmarkSecondaryIndexPerformance(b *testing.B, useIndex bool, lowCardinal
 					QueryType:  sqlparser.Equals,
 					Value:      fmt.Sprintf("%d", i),
 				}},
-			})
+			}, nil)
 			assert.NoError(b, err)
 			actualRowsCount += len(queryRes)
 		}
@@ -105,7 +105,7 @@ func TestSecondaryIndexBasedQueries(t *testing.T) {
 					Value:      fmt.Sprintf(valueTemplate, arrIdx),
 				},
 			},
-		})
+		}, nil)
 		assert.NoError(t, err)
 		assert.Len(t, queryRes, 1)
 		assert.Equal(t, []string{
@@ -130,7 +130,7 @@ func TestSecondaryIndexBasedQueries(t *testing.T) {
 					Value:      fmt.Sprintf("%d", i%2),
 				},
 			},
-		})
+		}, nil)
 		assert.NoError(t, err)
 		assert.Len(t, queryRes, 1)
 		assert.Equal(t, []string{
@@ -150,7 +150,7 @@ func TestSecondaryIndexBasedQueries(t *testing.T) {
 					Value:      fmt.Sprintf("%d", i),
 				},
 			},
-		})
+		}, nil)
 		assert.NoError(t, err)
 		assert.ElementsMatch(t, [][]string{
 			{fmt.Sprintf("val1_%d", i), fmt.Sprintf("val2_%d", i), fmt.Sprintf("%d", i), fmt.Sprintf("%d", i%2)},
@@ -168,7 +168,7 @@ func TestSecondaryIndexBasedQueries(t *testing.T) {
 					Value:      fmt.Sprintf("%d", i),
 				},
 			},
-		})
+		}, nil)
 		expectedList := [][]string{
 			{"val1_0", "val2_0", "0", "0"},
 			{"val1_2", "val2_2", "2", "0"},
@@ -1,6 +1,7 @@
 package db
 
 import (
+	"cmp"
 	"encoding/binary"
 	"errors"
 	"fmt"
@@ -20,147 +21,482 @@ func isFullTableScanQuery(selectFromTableInput sqlparser.SelectFromTable) bool {
 	return len(selectFromTableInput.QueryConditions) == 0
 }
 
-func (db *DB) getRowForPrimaryKey(tableName, primaryKeyId string) ([]string, error) {
-	key := fmt.Sprintf("%s:%s", tableName, primaryKeyId)
-	value, err := db.Get(key)
+// returns nil if no row has the primary key.
+func (db *DB) getRowForPrimaryKey(tableName, primaryKeyId string, neededColumns []bool, reader rowReader) ([]string, error) {
+	key, err := db.getRowKey(tableName, primaryKeyId)
 	if err != nil {
 		return nil, err
 	}
-	rowValues, err := db.deserializeRowValues(tableName, value)
+	value, err := reader.get(key)
+	if err != nil {
+		return nil, err
+	}
+	if value == "" {
+		return nil, nil
+	}
+	rowValues, err := db.deserializeRowValues(tableName, value, neededColumns)
 	if err != nil {
 		return nil, err
 	}
 	return rowValues, nil
 }
 
-// go through each secondary index. check if any of the secondary index can independently cover all WHERE conditions
-// if not ALL conditions, check if some of the conditions from the prefix of the WHERE condition can be covered.
+func isRangeQueryType(queryType sqlparser.QueryType) bool {
+	return queryType == sqlparser.Lt || queryType == sqlparser.Lte || queryType == sqlparser.Gt || queryType == sqlparser.Gte
+}
+
+func getQueryConditionsOnColumn(queryConditions []sqlparser.QueryCondition, colName string) []sqlparser.QueryCondition {
+	conditions := []sqlparser.QueryCondition{}
+	for _, qc := range queryConditions {
+		if qc.ColumnName == colName {
+			conditions = append(conditions, qc)
+		}
+	}
+	return conditions
+}
+
+// go through each secondary index and find the prefix of its columns having equality conditions. the column
+// after the prefix can be scanned as a range if it has range conditions (<, <=, >, >=).
+// the index covering all its columns with equality conditions is chosen, else the one covering the most columns.
 // returns nil if no secondary index is applicable
-func getSecondaryIndexForQueryIfApplicable(selectFromTableInput sqlparser.SelectFromTable, secondaryIndexes []sqlparser.SecondaryIndex) (*sqlparser.SecondaryIndex, []string) {
+func getSecondaryIndexForQueryIfApplicable(selectFromTableInput sqlparser.SelectFromTable, secondaryIndexes []sqlparser.SecondaryIndex) (
+	*sqlparser.SecondaryIndex, []string, string) {
 	var candidateSecondaryIndex *sqlparser.SecondaryIndex
 	colsCoveredInCandidateSecondaryIndex := []string{}
+	candidateRangeCol := ""
 	for _, secondaryIndex := range secondaryIndexes {
 		secIdxColsCoveredFromInputQuery := []string{}
+		rangeCol := ""
 		for _, secIdxCol := range secondaryIndex.Columns {
-			colFoundInInputQuery := false
-			for _, qc := range selectFromTableInput.QueryConditions {
-				if qc.ColumnName == secIdxCol {
-					colFoundInInputQuery = true
-					break
-				}
-			}
-			if colFoundInInputQuery {
+			conditions := getQueryConditionsOnColumn(selectFromTableInput.QueryConditions, secIdxCol)
+			hasEqualsCondition := slices.ContainsFunc(conditions, func(qc sqlparser.QueryCondition) bool {
+				return qc.QueryType == sqlparser.Equals
+			})
+			if hasEqualsCondition {
 				secIdxColsCoveredFromInputQuery = append(secIdxColsCoveredFromInputQuery, secIdxCol)
-			} else {
-				// we are going through each column in the secondary index sequentially
-				// and as soon as we find a secondary index column which is not
-				// part of the input SELECT query conditions, we break.
-				// this is crucial because composite index requires prefix match and even some of the
-				// prefix getting covered is good for choosing an index.
-				break
+				continue
 			}
-			if len(secIdxColsCoveredFromInputQuery) == len(secondaryIndex.Columns) {
-				return &secondaryIndex, secIdxColsCoveredFromInputQuery
+			// we are going through each column in the secondary index sequentially
+			// and as soon as we find a secondary index column which has no equality condition, we break.
+			// this is crucial because composite index requires prefix match and even some of the
+			// prefix getting covered is good for choosing an index. the range of the next column is
+			// contiguous within the prefix, so it can be scanned as well.
+			if len(conditions) > 0 {
+				rangeCol = secIdxCol
 			}
-			if len(secIdxColsCoveredFromInputQuery) > 0 {
-				candidateSecondaryIndex = &secondaryIndex
-				colsCoveredInCandidateSecondaryIndex = secIdxColsCoveredFromInputQuery
+			break
+		}
+		if len(secIdxColsCoveredFromInputQuery) == len(secondaryIndex.Columns) {
+			return &secondaryIndex, secIdxColsCoveredFromInputQuery, ""
+		}
+		if len(secIdxColsCoveredFromInputQuery) == 0 && rangeCol == "" {
+			continue
+		}
+		if candidateSecondaryIndex == nil || len(secIdxColsCoveredFromInputQuery) > len(colsCoveredInCandidateSecondaryIndex) ||
+			(len(secIdxColsCoveredFromInputQuery) == len(colsCoveredInCandidateSecondaryIndex) && candidateRangeCol == "" && rangeCol != "") {
+			candidateSecondaryIndex = &secondaryIndex
+			colsCoveredInCandidateSecondaryIndex = secIdxColsCoveredFromInputQuery
+			candidateRangeCol = rangeCol
+		}
+	}
+	return candidateSecondaryIndex, colsCoveredInCandidateSecondaryIndex, candidateRangeCol
+}
+
+// returns the bounds of the keys starting with the prefix which are followed by a column value satisfying
+// all the conditions. upper is exclusive, an empty upper is unbounded. the keys are tuple keys, so their order is
+// the SQL order of the values.
+func getRangeScanBounds(prefix string, dataType sqlparser.DataType, conditions []sqlparser.QueryCondition) (lower, upper string, err error) {
+	lower, upper = prefix, prefixUpperBound(prefix)
+	for _, qc := range conditions {
+		buf, err := appendTupleColumn([]byte(prefix), dataType, qc.Value)
+		if err != nil {
+			return "", "", err
+		}
+		// the column value is self delimiting, so the keys having it are the ones with the key as prefix
+		key := string(buf)
+		switch qc.QueryType {
+		case sqlparser.Equals:
+			lower = max(lower, key)
+			upper = minUpperBound(upper, prefixUpperBound(key))
+		case sqlparser.Lt:
+			upper = minUpperBound(upper, key)
+		case sqlparser.Lte:
+			upper = minUpperBound(upper, prefixUpperBound(key))
+		case sqlparser.Gt:
+			keyUpperBound := prefixUpperBound(key)
+			if keyUpperBound == "" {
+				// a key made only of 0xff bytes has no greater key with a different prefix
+				return key, key, nil
 			}
+			lower = max(lower, keyUpperBound)
+		case sqlparser.Gte:
+			lower = max(lower, key)
+		default:
+			return "", "", errors.New("query type not supported")
 		}
 	}
-	return candidateSecondaryIndex, colsCoveredInCandidateSecondaryIndex
+	return lower, upper, nil
 }
 
-func allColumnsCoveredBySecondaryIndex(secondaryIndex *sqlparser.SecondaryIndex, colsCoveredInSecIndex []string) bool {
-	return len(secondaryIndex.Columns) == len(colsCoveredInSecIndex)
+// compares the values as per the data type of the column.
+func compareColumnValues(dataType sqlparser.DataType, a, b string) (int, error) {
+	switch dataType {
+	case sqlparser.Int, sqlparser.Bool:
+		aInt, err := strconv.ParseInt(a, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		bInt, err := strconv.ParseInt(b, 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		return cmp.Compare(aInt, bInt), nil
+	case sqlparser.String:
+		return strings.Compare(a, b), nil
+	}
+	return 0, fmt.Errorf("unknown data type: %d", dataType)
 }
 
-func isQueryConditionApplicable(row []string, colPos int, qc sqlparser.QueryCondition) (bool, error) {
+func isQueryConditionApplicable(row []string, colPos int, dataType sqlparser.DataType, qc sqlparser.QueryCondition) (bool, error) {
+	result, err := compareColumnValues(dataType, row[colPos], qc.Value)
+	if err != nil {
+		return false, err
+	}
 	switch qc.QueryType {
 	case sqlparser.Equals:
-		return row[colPos] == qc.Value, nil
+		return result == 0, nil
 	case sqlparser.Lt:
-		return row[colPos] < qc.Value, nil
+		return result < 0, nil
 	case sqlparser.Lte:
-		return row[colPos] <= qc.Value, nil
+		return result <= 0, nil
 	case sqlparser.Gt:
-		return row[colPos] > qc.Value, nil
+		return result > 0, nil
 	case sqlparser.Gte:
-		return row[colPos] >= qc.Value, nil
+		return result >= 0, nil
 	}
 	return false, errors.New("query type not supported")
 }
 
-// filters on the basis of all applicable conditions in []sqlparser.QueryCondition.
-// if query result is already covered by secondary index, that filter is not applied.
-func (db *DB) filterQueryConditions(tableName string, queryConditions []sqlparser.QueryCondition,
-	colsCoveredInSecIndex []string, queryResult [][]string) ([][]string, error) {
-	for _, qc := range queryConditions {
-		colName := qc.ColumnName
-		if slices.Contains(colsCoveredInSecIndex, colName) {
+// errScanLimitReached stops a scan once the rowCollector has all the rows needed.
+var errScanLimitReached = errors.New("scan limit reached")
+
+// rowCollector filters the rows read by a scan one at a time on the basis of all applicable conditions in
+// []sqlparser.QueryCondition, so that the scan can stop as soon as enough rows have matched.
+// if a condition is already covered by the index scan, that filter is not applied.
+type rowCollector struct {
+	db              *DB
+	tableName       string
+	queryConditions []sqlparser.QueryCondition
+	colsNotToFilter []string
+	// -1 means all the matching rows are collected
+	maxRows int
+	rows    [][]string
+}
+
+// returns errScanLimitReached once maxRows rows are collected.
+func (c *rowCollector) add(row []string) error {
+	for _, qc := range c.queryConditions {
+		if slices.Contains(c.colsNotToFilter, qc.ColumnName) {
 			continue
 		}
-		colPos := db.getColPositionFromColName(tableName, colName)
+		colPos := c.db.getColPositionFromColName(c.tableName, qc.ColumnName)
 		if colPos == -1 {
-			return nil, errors.New("unable to apply all query conditions")
+			return errors.New("unable to apply all query conditions")
 		}
-		filteredQueryResult := [][]string{}
-		for _, row := range queryResult {
-			applicable, err := isQueryConditionApplicable(row, colPos, qc)
-			if err != nil {
-				return nil, err
-			}
-			if applicable {
-				filteredQueryResult = append(filteredQueryResult, row)
-			}
+		dataType := c.db.tableNameVsSchemaMap[c.tableName].ColumnDetails[colPos].DataType
+		applicable, err := isQueryConditionApplicable(row, colPos, dataType, qc)
+		if err != nil {
+			return err
+		}
+		if !applicable {
+			return nil
 		}
-		queryResult = filteredQueryResult
 	}
-	return queryResult, nil
+	c.rows = append(c.rows, row)
+	if c.maxRows != -1 && len(c.rows) >= c.maxRows {
+		return errScanLimitReached
+	}
+	return nil
 }
 
-func (db *DB) runFullTableScanAndFilterConditions(tableName string, selectFromTableInput sqlparser.SelectFromTable) ([][]string, error) {
-	queryResult, err := db.fullTableScan(tableName)
-	if err != nil {
-		return nil, err
-	}
-	return db.filterQueryConditions(tableName, selectFromTableInput.QueryConditions,
-		[]string{}, queryResult)
+// queryPlan is how the rows of a query are read.
+type queryPlan struct {
+	// the row is read with a point lookup of the primary key
+	isPointLookup   bool
+	primaryKeyValue string
+	// the keys within [lower, upper) of the secondary index are scanned if it is set, else the row keys are
+	secondaryIndex *sqlparser.SecondaryIndex
+	lower, upper   string
+	// the conditions on these columns are satisfied by all the keys scanned
+	colsNotToFilter []string
+	// the rows are read in the order of these columns
+	orderedBy []string
 }
 
-// todo: not solving for RANGE queries within secondary index or primary key right now.
-func (db *DB) getQueryResultFromSecondaryIndexIfApplicable(tableName string, selectFromTableInput sqlparser.SelectFromTable, schema sqlparser.CreateTable) ([][]string, error) {
-	secondaryIndex, colsCoveredInSecIndex := getSecondaryIndexForQueryIfApplicable(selectFromTableInput, schema.SecondaryIndexes)
+// uses a point lookup for a single equality condition on the primary key. otherwise uses a secondary index
+// having equality conditions on its leading columns, or else the primary key if it has conditions, or else
+// a secondary index having range conditions on its first column. the whole table is scanned only if none of
+// them can bound the scan.
+func (db *DB) getQueryPlan(tableName string, selectFromTableInput sqlparser.SelectFromTable,
+	schema sqlparser.CreateTable, pkColumnName string) (*queryPlan, error) {
+	if isPointedPrimaryKeyQuery(selectFromTableInput, pkColumnName) {
+		return &queryPlan{
+			isPointLookup:   true,
+			primaryKeyValue: selectFromTableInput.QueryConditions[0].Value,
+			colsNotToFilter: []string{pkColumnName},
+		}, nil
+	}
+	rowKeyPrefix := db.getRowKeyPrefix(tableName)
+	fullTableScanPlan := &queryPlan{
+		lower:           rowKeyPrefix,
+		upper:           prefixUpperBound(rowKeyPrefix),
+		colsNotToFilter: []string{},
+		orderedBy:       []string{pkColumnName},
+	}
+	if isFullTableScanQuery(selectFromTableInput) {
+		return fullTableScanPlan, nil
+	}
+	secondaryIndex, colsCoveredInSecIndex, rangeCol := getSecondaryIndexForQueryIfApplicable(selectFromTableInput, schema.SecondaryIndexes)
+	hasPrimaryKeyConditions := len(getQueryConditionsOnColumn(selectFromTableInput.QueryConditions, pkColumnName)) > 0
+	if hasPrimaryKeyConditions && (secondaryIndex == nil || len(colsCoveredInSecIndex) == 0) {
+		// reads only the rows whose primary key satisfies the conditions on the primary key column, the rest
+		// of the conditions are filtered after.
+		dataTypes, err := db.getColumnDataTypes(tableName, []string{pkColumnName})
+		if err != nil {
+			return nil, err
+		}
+		lower, upper, err := getRangeScanBounds(rowKeyPrefix, dataTypes[0],
+			getQueryConditionsOnColumn(selectFromTableInput.QueryConditions, pkColumnName))
+		if err != nil {
+			return nil, err
+		}
+		return &queryPlan{
+			lower:           lower,
+			upper:           upper,
+			colsNotToFilter: []string{pkColumnName},
+			orderedBy:       []string{pkColumnName},
+		}, nil
+	}
 	if secondaryIndex == nil {
-		return db.runFullTableScanAndFilterConditions(tableName, selectFromTableInput)
+		return fullTableScanPlan, nil
 	}
+	// the values of the covered columns in the order of the index columns
 	columnValues := []string{}
-	for _, condition := range selectFromTableInput.QueryConditions {
-		columnValues = append(columnValues, condition.Value)
+	// the covered columns having other conditions apart from the one in the prefix are filtered again
+	colsNotToFilter := []string{}
+	for _, colName := range colsCoveredInSecIndex {
+		conditions := getQueryConditionsOnColumn(selectFromTableInput.QueryConditions, colName)
+		for _, condition := range conditions {
+			if condition.QueryType == sqlparser.Equals {
+				columnValues = append(columnValues, condition.Value)
+				break
+			}
+		}
+		if len(conditions) == 1 {
+			colsNotToFilter = append(colsNotToFilter, colName)
+		}
 	}
-	prefixKey := getSecondaryIndexKeyOrPrefix(tableName, secondaryIndex.IndexName, columnValues, "")
-	primaryKeyIds, err := db.secondaryIndexPrefixScan(prefixKey)
+	prefixKey, err := db.getSecondaryIndexPrefix(tableName, *secondaryIndex, columnValues)
 	if err != nil {
 		return nil, err
 	}
-	// Run GET query for each primary key id separately and combine the result of each.
-	queryResult := [][]string{}
-	for _, pkId := range primaryKeyIds {
-		rowValues, err := db.getRowForPrimaryKey(tableName, pkId)
+	lower, upper := prefixKey, prefixUpperBound(prefixKey)
+	if rangeCol != "" {
+		dataTypes, err := db.getColumnDataTypes(tableName, []string{rangeCol})
+		if err != nil {
+			return nil, err
+		}
+		lower, upper, err = getRangeScanBounds(prefixKey, dataTypes[0],
+			getQueryConditionsOnColumn(selectFromTableInput.QueryConditions, rangeCol))
 		if err != nil {
 			return nil, err
 		}
-		queryResult = append(queryResult, rowValues)
+		colsNotToFilter = append(colsNotToFilter, rangeCol)
+	}
+	// the index keys within the prefix are in the order of the rest of the index columns, and then of the
+	// primary key which every index key ends with.
+	orderedBy := append(slices.Clone(secondaryIndex.Columns[len(colsCoveredInSecIndex):]), pkColumnName)
+	return &queryPlan{
+		secondaryIndex:  secondaryIndex,
+		lower:           lower,
+		upper:           upper,
+		colsNotToFilter: colsNotToFilter,
+		orderedBy:       orderedBy,
+	}, nil
+}
+
+// reads the rows of the plan into the collector, until it has all the rows needed.
+func (db *DB) executeQueryPlan(tableName string, plan *queryPlan, neededColumns []bool, reader rowReader, collector *rowCollector) error {
+	var err error
+	switch {
+	case plan.isPointLookup:
+		var rowValues []string
+		rowValues, err = db.getRowForPrimaryKey(tableName, plan.primaryKeyValue, neededColumns, reader)
+		if err == nil && rowValues != nil {
+			err = collector.add(rowValues)
+		}
+	case plan.secondaryIndex != nil:
+		err = db.secondaryIndexRangeScan(tableName, *plan.secondaryIndex, plan.lower, plan.upper, neededColumns, reader, collector.add)
+	default:
+		err = db.rowRangeScan(tableName, plan.lower, plan.upper, neededColumns, reader, collector.add)
+	}
+	if errors.Is(err, errScanLimitReached) {
+		return nil
+	}
+	return err
+}
+
+// returns true if the rows read by the plan are already in the order of the ORDER BY columns. a column having
+// an equality condition has the same value in all the rows, so it doesn't change the order. the primary key
+// is unique, so the columns after it don't change the order either. the keys are only scanned in ascending
+// order, so a DESC column is never satisfied by the plan and its rows are always read in full and sorted.
+func isOrderSatisfiedByPlan(plan *queryPlan, selectFromTableInput sqlparser.SelectFromTable, pkColumnName string) bool {
+	if plan.isPointLookup {
+		return true
+	}
+	hasEqualsCondition := func(colName string) bool {
+		return slices.ContainsFunc(selectFromTableInput.QueryConditions, func(qc sqlparser.QueryCondition) bool {
+			return qc.ColumnName == colName && qc.QueryType == sqlparser.Equals
+		})
+	}
+	orderedBy := slices.DeleteFunc(slices.Clone(plan.orderedBy), hasEqualsCondition)
+	i := 0
+	for _, col := range selectFromTableInput.OrderBy {
+		if hasEqualsCondition(col.ColumnName) {
+			continue
+		}
+		// todo: DESC can be served by scanning the keys in reverse, which the iterators don't support yet.
+		if col.Descending || i >= len(orderedBy) || orderedBy[i] != col.ColumnName {
+			return false
+		}
+		if col.ColumnName == pkColumnName {
+			return true
+		}
+		i++
+	}
+	return true
+}
+
+// sorts the rows by the ORDER BY columns, comparing the values as per the data type of the column.
+func (db *DB) sortRows(tableName string, rows [][]string, orderBy []sqlparser.OrderByColumn) error {
+	colPositions := make([]int, 0, len(orderBy))
+	for _, col := range orderBy {
+		colPos := db.getColPositionFromColName(tableName, col.ColumnName)
+		if colPos == -1 {
+			return fmt.Errorf("column: '%s' not found", col.ColumnName)
+		}
+		colPositions = append(colPositions, colPos)
+	}
+	schema := db.tableNameVsSchemaMap[tableName]
+	var sortErr error
+	slices.SortStableFunc(rows, func(a, b []string) int {
+		for i, col := range orderBy {
+			colPos := colPositions[i]
+			result, err := compareColumnValues(schema.ColumnDetails[colPos].DataType, a[colPos], b[colPos])
+			if err != nil {
+				sortErr = err
+				return 0
+			}
+			if result != 0 {
+				if col.Descending {
+					return -result
+				}
+				return result
+			}
+		}
+		return 0
+	})
+	return sortErr
+}
+
+// selectFromTable reads the rows as of the snapshot. A nil snapshot reads the newest committed rows, a
+// snapshot is taken for the query then, so that all its rows and index entries are read at the same point.
+func (db *DB) selectFromTable(selectFromTableInput sqlparser.SelectFromTable, snapshot *Snapshot) ([][]string, error) {
+	if snapshot == nil {
+		snapshot = db.NewSnapshot()
+		defer snapshot.Release()
+	}
+	return db.selectRows(selectFromTableInput, snapshot)
+}
+
+// rowReader reads the rows and the index entries of a query, either from a snapshot or within a transaction.
+type rowReader interface {
+	get(key string) (string, error)
+	// calls fn for each live key, value pair within [lower, upper) in sorted key order, stopping at the first error returned by fn
+	rangeScan(lower, upper string, fn func(key, value string) error) error
+}
+
+// returns the positions of the columns of the projection list in the order of the list, `*` is expanded to all
+// the columns of the table. all the columns are returned if the list is empty.
+func (db *DB) getProjectedColumnPositions(tableName string, columnsRequired []string) ([]int, error) {
+	schema, ok := db.tableNameVsSchemaMap[tableName]
+	if !ok {
+		return nil, fmt.Errorf("table with name %q not found", tableName)
+	}
+	if len(columnsRequired) == 0 {
+		columnsRequired = []string{sqlparser.SymbolStar}
 	}
-	if allColumnsCoveredBySecondaryIndex(secondaryIndex, colsCoveredInSecIndex) {
-		return queryResult, nil
+	colPositions := []int{}
+	for _, colName := range columnsRequired {
+		if colName == sqlparser.SymbolStar {
+			for i := range schema.ColumnDetails {
+				colPositions = append(colPositions, i)
+			}
+			continue
+		}
+		colPos := db.getColPositionFromColName(tableName, colName)
+		if colPos == -1 {
+			return nil, fmt.Errorf("column: '%s' not found", colName)
+		}
+		colPositions = append(colPositions, colPos)
 	}
-	return db.filterQueryConditions(tableName, selectFromTableInput.QueryConditions,
-		colsCoveredInSecIndex, queryResult)
+	return colPositions, nil
 }
 
+// returns the rows matching the query conditions with the columns of the projection list, in the order of the list.
+func (db *DB) selectRows(selectFromTableInput sqlparser.SelectFromTable, reader rowReader) ([][]string, error) {
+	tableName := selectFromTableInput.TableName
+	colPositions, err := db.getProjectedColumnPositions(tableName, selectFromTableInput.ColumnsRequired)
+	if err != nil {
+		return nil, err
+	}
+	// only the columns projected, filtered on or sorted by are decoded
+	neededColumns := make([]bool, len(db.tableNameVsSchemaMap[tableName].ColumnDetails))
+	for _, colPos := range colPositions {
+		neededColumns[colPos] = true
+	}
+	for _, qc := range selectFromTableInput.QueryConditions {
+		if colPos := db.getColPositionFromColName(tableName, qc.ColumnName); colPos != -1 {
+			neededColumns[colPos] = true
+		}
+	}
+	for _, col := range selectFromTableInput.OrderBy {
+		colPos := db.getColPositionFromColName(tableName, col.ColumnName)
+		if colPos == -1 {
+			return nil, fmt.Errorf("column: '%s' not found", col.ColumnName)
+		}
+		neededColumns[colPos] = true
+	}
+	rows, err := db.selectMatchingRows(selectFromTableInput, neededColumns, reader)
+	if err != nil {
+		return nil, err
+	}
+	projectedRows := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		projectedRow := make([]string, 0, len(colPositions))
+		for _, colPos := range colPositions {
+			projectedRow = append(projectedRow, row[colPos])
+		}
+		projectedRows = append(projectedRows, projectedRow)
+	}
+	return projectedRows, nil
+}
+
+// returns the rows matching the query conditions in the ORDER BY order, skipping OFFSET rows and returning at
+// most LIMIT rows. if the rows are read in the ORDER BY order, the scan stops once it has read enough rows,
+// within a transaction too. otherwise, as for any DESC column, all the matching rows are read and sorted.
 // todo: without index scan, AND queries support to be added.
-func (db *DB) selectFromTable(selectFromTableInput sqlparser.SelectFromTable) ([][]string, error) {
+func (db *DB) selectMatchingRows(selectFromTableInput sqlparser.SelectFromTable, neededColumns []bool, reader rowReader) ([][]string, error) {
 	tableName := selectFromTableInput.TableName
 	schema, ok := db.tableNameVsSchemaMap[selectFromTableInput.TableName]
 	pkPos := schema.PrimaryKeyColumnPosition
@@ -177,104 +513,133 @@ func (db *DB) selectFromTable(selectFromTableInput sqlparser.SelectFromTable) ([
 	if pkColumnName == "" {
 		return nil, errors.New("primary key column position is incorrect")
 	}
-	// todo: not solving for returning limited columns right now
-	if isPointedPrimaryKeyQuery(selectFromTableInput, pkColumnName) {
-		rowValues, err := db.getRowForPrimaryKey(tableName, selectFromTableInput.QueryConditions[0].Value)
-		if err != nil {
+	limit := selectFromTableInput.Limit
+	if limit != nil && *limit == 0 {
+		return [][]string{}, nil
+	}
+	plan, err := db.getQueryPlan(tableName, selectFromTableInput, schema, pkColumnName)
+	if err != nil {
+		return nil, err
+	}
+	isOrderSatisfied := isOrderSatisfiedByPlan(plan, selectFromTableInput, pkColumnName)
+	collector := &rowCollector{
+		db:              db,
+		tableName:       tableName,
+		queryConditions: selectFromTableInput.QueryConditions,
+		colsNotToFilter: plan.colsNotToFilter,
+		maxRows:         -1,
+		rows:            [][]string{},
+	}
+	if isOrderSatisfied && limit != nil {
+		collector.maxRows = selectFromTableInput.Offset + *limit
+	}
+	if err := db.executeQueryPlan(tableName, plan, neededColumns, reader, collector); err != nil {
+		return nil, err
+	}
+	rows := collector.rows
+	if !isOrderSatisfied {
+		if err := db.sortRows(tableName, rows, selectFromTableInput.OrderBy); err != nil {
 			return nil, err
 		}
-		return [][]string{rowValues}, nil
 	}
-	if isFullTableScanQuery(selectFromTableInput) {
-		return db.fullTableScan(tableName)
+	rows = rows[min(selectFromTableInput.Offset, len(rows)):]
+	if limit != nil && len(rows) > *limit {
+		rows = rows[:*limit]
 	}
-
-	return db.getQueryResultFromSecondaryIndexIfApplicable(tableName, selectFromTableInput, schema)
+	return rows, nil
 }
 
 // value: [value1][size_of_value2][value2][value3]
-func (db *DB) deserializeRowValues(tableName, value string) ([]string, error) {
+// only the needed columns are decoded, nil means all of them. the values of the other columns are left empty.
+// the values are stored one after the other, so the columns before a needed one are skipped over and the
+// columns after the last needed one are not read.
+func (db *DB) deserializeRowValues(tableName, value string, neededColumns []bool) ([]string, error) {
+	return db.deserializeRowValuesWithIntLength(tableName, value, neededColumns, rowIntLength)
+}
+
+// decodes all the columns of a row stored by a table created before the tables had ids.
+func (db *DB) deserializeLegacyRowValues(tableName, value string) ([]string, error) {
+	return db.deserializeRowValuesWithIntLength(tableName, value, nil, legacyRowIntLength)
+}
+
+func (db *DB) deserializeRowValuesWithIntLength(tableName, value string, neededColumns []bool, intLength int) ([]string, error) {
 	// read byte inputs
 	schema := db.tableNameVsSchemaMap[tableName]
 	valueBuf := []byte(value)
+	lastNeededColPos := len(schema.ColumnDetails) - 1
+	if neededColumns != nil {
+		lastNeededColPos = -1
+		for colPos, needed := range neededColumns {
+			if needed {
+				lastNeededColPos = colPos
+			}
+		}
+	}
 	i := 0
-	rowValues := []string{}
-	for _, col := range schema.ColumnDetails {
+	rowValues := make([]string, len(schema.ColumnDetails))
+	for colPos, col := range schema.ColumnDetails[:lastNeededColPos+1] {
+		needed := neededColumns == nil || neededColumns[colPos]
 		switch col.DataType {
 		case sqlparser.Int:
-			val := strconv.FormatUint(uint64(binary.BigEndian.Uint32(valueBuf[i:i+4])), 10)
-			rowValues = append(rowValues, val)
-			i += 4
+			if needed {
+				if intLength == legacyRowIntLength {
+					rowValues[colPos] = strconv.FormatUint(uint64(binary.BigEndian.Uint32(valueBuf[i:i+4])), 10)
+				} else {
+					rowValues[colPos] = strconv.FormatInt(int64(binary.BigEndian.Uint64(valueBuf[i:i+8])), 10)
+				}
+			}
+			i += intLength
 		case sqlparser.String:
 			len := int(binary.BigEndian.Uint32(valueBuf[i : i+4]))
 			i += 4
-			val := string(valueBuf[i : i+len])
-			rowValues = append(rowValues, val)
+			if needed {
+				rowValues[colPos] = string(valueBuf[i : i+len])
+			}
 			i += len
 
 		case sqlparser.Bool:
-			val := strconv.FormatUint(uint64(valueBuf[i]), 2)
-			rowValues = append(rowValues, val)
+			if needed {
+				rowValues[colPos] = strconv.FormatUint(uint64(valueBuf[i]), 2)
+			}
 			i++
 		}
 	}
 	return rowValues, nil
 }
 
-func (db *DB) fullTableScan(tableName string) ([][]string, error) {
-	key := fmt.Sprintf("%s:", tableName)
-	memTableMap := db.memTable.PrefixScan(key)
-	ssTableMap, err := db.ssTable.PrefixScan(key)
-	if err != nil {
-		return nil, err
+// calls fn for each row with the row key within [lower, upper) in the order of the primary key.
+func (db *DB) rowRangeScan(tableName, lower, upper string, neededColumns []bool, reader rowReader, fn func(row []string) error) error {
+	if isEmptyRange(lower, upper) {
+		return nil
 	}
-
-	scanOutput := [][]string{}
-	for _, value := range memTableMap {
-		values, err := db.deserializeRowValues(tableName, value)
+	return reader.rangeScan(lower, upper, func(_, value string) error {
+		values, err := db.deserializeRowValues(tableName, value, neededColumns)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		scanOutput = append(scanOutput, values)
-	}
+		return fn(values)
+	})
+}
 
-	for key, value := range ssTableMap {
-		if _, ok := memTableMap[key]; ok {
-			// memtable would have the most up-to date value. no need to rely on sstable value when key is found in memtable
-			continue
+// calls fn for the row of each index key within [lower, upper) in the order of the index.
+func (db *DB) secondaryIndexRangeScan(tableName string, secondaryIndex sqlparser.SecondaryIndex, lower, upper string,
+	neededColumns []bool, reader rowReader, fn func(row []string) error) error {
+	if isEmptyRange(lower, upper) {
+		return nil
+	}
+	return reader.rangeScan(lower, upper, func(key, _ string) error {
+		pk, err := db.getPrimaryKeyFromSecondaryIndexKey(tableName, secondaryIndex, key)
+		if err != nil {
+			return err
 		}
-		values, err := db.deserializeRowValues(tableName, value)
+		// Run GET query for each primary key id separately.
+		rowValues, err := db.getRowForPrimaryKey(tableName, pk, neededColumns, reader)
 		if err != nil {
-			return nil, err
+			return err
 		}
-		scanOutput = append(scanOutput, values)
-	}
-	return scanOutput, nil
-}
-
-// returns an array of primary key IDs which satisfy the index.
-func (db *DB) secondaryIndexPrefixScan(prefixKey string) ([]string, error) {
-	memTableMap := db.memTable.PrefixScan(prefixKey)
-	ssTableMap, err := db.ssTable.PrefixScan(prefixKey)
-	if err != nil {
-		return nil, err
-	}
-
-	pkSet := make(map[string]bool)
-
-	primaryKeyIds := []string{}
-	for key, _ := range ssTableMap {
-		keyElements := strings.Split(key, ":")
-		pk := keyElements[len(keyElements)-1]
-		pkSet[pk] = true
-	}
-	for key, _ := range memTableMap {
-		keyElements := strings.Split(key, ":")
-		pk := keyElements[len(keyElements)-1]
-		pkSet[pk] = true
-	}
-	for pk := range pkSet {
-		primaryKeyIds = append(primaryKeyIds, pk)
-	}
-	return primaryKeyIds, nil
+		if rowValues == nil {
+			return nil
+		}
+		return fn(rowValues)
+	})
 }
@@ -0,0 +1,97 @@
+package db
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	SnapshotReleasedError  = "snapshot is already released"
+	SnapshotOfOtherDBError = "snapshot belongs to another db"
+)
+
+// snapshotList tracks the sequence numbers read by the open transactions. compaction keeps the
+// versions of the keys which any of them can still read.
+type snapshotList struct {
+	mu sync.Mutex
+	// sequence number vs number of open transactions reading it
+	refCounts map[uint64]int
+}
+
+// acquireSnapshot returns the sequence number of the newest committed write and keeps the versions
+// visible at it till releaseSnapshot is called.
+func (db *DB) acquireSnapshot() uint64 {
+	db.snapshots.mu.Lock()
+	defer db.snapshots.mu.Unlock()
+	// read under the lock: a compaction reads the live snapshots once it has picked its files, a
+	// snapshot acquired after that is newer than every version in those files.
+	sequence := db.lastSequence.Load()
+	db.snapshots.refCounts[sequence]++
+	return sequence
+}
+
+func (db *DB) releaseSnapshot(sequence uint64) {
+	db.snapshots.mu.Lock()
+	defer db.snapshots.mu.Unlock()
+	db.snapshots.refCounts[sequence]--
+	if db.snapshots.refCounts[sequence] <= 0 {
+		delete(db.snapshots.refCounts, sequence)
+	}
+}
+
+// liveSnapshots returns the sequence numbers of the open snapshots, it is called by compaction.
+func (db *DB) liveSnapshots() []uint64 {
+	db.snapshots.mu.Lock()
+	defer db.snapshots.mu.Unlock()
+	sequences := make([]uint64, 0, len(db.snapshots.refCounts))
+	for sequence := range db.snapshots.refCounts {
+		sequences = append(sequences, sequence)
+	}
+	return sequences
+}
+
+// Snapshot is a point-in-time view of the DB. the reads made with it see the writes committed before
+// it was created and none of the later ones, across the memtables and the sstable files.
+// Release must be called once the snapshot is no longer needed, compaction keeps every version the
+// snapshot can read till then.
+type Snapshot struct {
+	db       *DB
+	sequence uint64
+	released atomic.Bool
+}
+
+// NewSnapshot returns a view of the DB as of the newest committed write.
+func (db *DB) NewSnapshot() *Snapshot {
+	return &Snapshot{db: db, sequence: db.acquireSnapshot()}
+}
+
+// Release lets compaction drop the versions read only by the snapshot. It is safe to call more than once.
+func (s *Snapshot) Release() {
+	if s.released.CompareAndSwap(false, true) {
+		s.db.releaseSnapshot(s.sequence)
+	}
+}
+
+// returns the sequence number the reads made with the snapshot are served at.
+// a nil snapshot reads the newest committed writes.
+func (s *Snapshot) readSequence(db *DB) (uint64, error) {
+	if s == nil {
+		return db.lastSequence.Load(), nil
+	}
+	if s.released.Load() {
+		return 0, errors.New(SnapshotReleasedError)
+	}
+	if s.db != db {
+		return 0, errors.New(SnapshotOfOtherDBError)
+	}
+	return s.sequence, nil
+}
+
+func (s *Snapshot) get(key string) (string, error) {
+	return s.db.GetFromSnapshot(key, s)
+}
+
+func (s *Snapshot) rangeScan(lower, upper string, fn func(key, value string) error) error {
+	return s.db.rangeScan(lower, upper, s, fn)
+}
@@ -0,0 +1,262 @@
+package db
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	sqlparser "github.com/golang-db/sql_parser"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTransactionReadsItsSnapshotAcrossFlushAndCompaction(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	require.NoError(t, dbInstance.Put("key", "old value"))
+	require.NoError(t, dbInstance.Put("deleted_key", "old value"))
+	txn, err := dbInstance.Begin()
+	require.NoError(t, err)
+	defer txn.Rollback()
+
+	require.NoError(t, dbInstance.Delete("deleted_key"))
+	require.NoError(t, dbInstance.Put("new_key", "new value"))
+	// every overwrite is flushed to its own file, so that compaction merges all the versions
+	for i := 0; i < 6; i++ {
+		require.NoError(t, dbInstance.Put("key", fmt.Sprintf("new value %d", i)))
+		putKeysUntilFlush(t, dbInstance, fmt.Sprintf("filler_%d", i))
+	}
+	require.NoError(t, dbInstance.waitForPendingFlushes())
+	require.NoError(t, dbInstance.ssTable.RunCompaction())
+
+	for key, expected := range map[string]string{"key": "old value", "deleted_key": "old value", "new_key": ""} {
+		value, err := txn.Get(key)
+		require.NoError(t, err)
+		assert.Equal(t, expected, value, key)
+	}
+	value, err := dbInstance.Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "new value 5", value)
+	value, err = dbInstance.Get("deleted_key")
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+}
+
+func TestTransactionPutFailsIfKeyWasUpdatedAfterItsSnapshot(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	txn, err := dbInstance.Begin()
+	require.NoError(t, err)
+	otherTxn, err := dbInstance.Begin()
+	require.NoError(t, err)
+	require.NoError(t, otherTxn.Put("key", "value by other transaction"))
+	require.NoError(t, otherTxn.Commit())
+
+	assert.EqualError(t, txn.Put("key", "lost update"), WriteConflictError)
+	assert.NoError(t, txn.Put("other_key", "value"))
+	require.NoError(t, txn.Commit())
+
+	value, err := dbInstance.Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "value by other transaction", value)
+}
+
+func TestCommittedSnapshotIsReleased(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	txn, err := dbInstance.Begin()
+	require.NoError(t, err)
+	rolledBackTxn, err := dbInstance.Begin()
+	require.NoError(t, err)
+	assert.Len(t, dbInstance.liveSnapshots(), 1)
+
+	require.NoError(t, txn.Put("key", "value"))
+	require.NoError(t, txn.Commit())
+	rolledBackTxn.Rollback()
+	rolledBackTxn.Rollback()
+	assert.Empty(t, dbInstance.liveSnapshots())
+}
+
+// the sequence numbers must continue after the last flushed write, else the writes after a restart
+// would be older than the writes in the files.
+func TestReadOnlyTransactionCommitsWithoutWritingTheWal(t *testing.T) {
+	dbInstance, config := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	segmentFilePath := fmt.Sprintf("%s.%d", config.WalFilePath, dbInstance.wal.ActiveSegmentId())
+	walSize := func() int64 {
+		fileInfo, err := os.Stat(segmentFilePath)
+		require.NoError(t, err)
+		return fileInfo.Size()
+	}
+
+	require.NoError(t, dbInstance.Put("key", "value"))
+	for _, isolationLevel := range []IsolationLevel{SnapshotIsolation, Serializable} {
+		txn, err := dbInstance.BeginWithIsolation(isolationLevel)
+		require.NoError(t, err)
+		value, err := txn.Get("key")
+		require.NoError(t, err)
+		assert.Equal(t, "value", value)
+		// a transaction whose writes are rolled back to a savepoint has no writes either
+		require.NoError(t, txn.Savepoint("before_write"))
+		require.NoError(t, txn.Put("other key", "value"))
+		require.NoError(t, txn.RollbackTo("before_write"))
+		sizeBeforeCommit := walSize()
+
+		require.NoError(t, txn.Commit())
+		assert.Equal(t, sizeBeforeCommit, walSize())
+		assert.Empty(t, dbInstance.liveSnapshots())
+		assert.Empty(t, dbInstance.transactionManager.keyVsLocksAcquiredMap)
+		assert.EqualError(t, txn.Commit(), TransactionFinishedError)
+	}
+}
+
+// run with -race: the validation of the scanned ranges clones the memtables
+func TestConcurrentReadOnlySerializableCommits(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	_, _, err := createTestTable(dbInstance, true)
+	require.NoError(t, err)
+	for i := 0; i < 10; i++ {
+		require.NoError(t, dbInstance.InsertIntoTable(fmt.Sprintf("INSERT INTO t1 VALUES (k%d, v, %d, 1)", i, i)))
+	}
+
+	var wg sync.WaitGroup
+	for range 32 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 10 {
+				txn, err := dbInstance.BeginWithIsolation(Serializable)
+				if !assert.NoError(t, err) {
+					return
+				}
+				rows, err := txn.SelectFromTable("SELECT * FROM t1 WHERE c3 >= 0;")
+				assert.NoError(t, err)
+				assert.Len(t, rows, 10)
+				assert.NoError(t, txn.Commit())
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Empty(t, dbInstance.liveSnapshots())
+}
+
+func TestSequenceNumbersContinueAfterRestart(t *testing.T) {
+	dbInstance, config := newDBForWalCommandTest(t)
+	require.NoError(t, dbInstance.Put("key", "before restart"))
+	putKeysUntilFlush(t, dbInstance, "filler")
+	require.NoError(t, dbInstance.waitForPendingFlushes())
+	lastSequence := dbInstance.lastSequence.Load()
+	dbInstance.Close()
+	removeWalSegments(config.WalFilePath)
+
+	dbAfterRestart, err := NewDB(config)
+	require.NoError(t, err)
+	defer dbAfterRestart.Close()
+	assert.GreaterOrEqual(t, dbAfterRestart.lastSequence.Load(), dbAfterRestart.ssTable.LastSequence())
+	assert.LessOrEqual(t, dbAfterRestart.ssTable.LastSequence(), lastSequence)
+	assert.NotZero(t, dbAfterRestart.ssTable.LastSequence())
+
+	require.NoError(t, dbAfterRestart.Put("key", "after restart"))
+	putKeysUntilFlush(t, dbAfterRestart, "filler")
+	require.NoError(t, dbAfterRestart.waitForPendingFlushes())
+	value, err := dbAfterRestart.Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "after restart", value)
+}
+
+func TestSnapshotReadsArePointInTime(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	require.NoError(t, dbInstance.Put("key_1", "old value"))
+	require.NoError(t, dbInstance.Put("key_2", "old value"))
+	snapshot := dbInstance.NewSnapshot()
+	defer snapshot.Release()
+
+	require.NoError(t, dbInstance.Put("key_1", "new value"))
+	require.NoError(t, dbInstance.Delete("key_2"))
+	require.NoError(t, dbInstance.Put("key_3", "new value"))
+	for i := 0; i < 5; i++ {
+		putKeysUntilFlush(t, dbInstance, fmt.Sprintf("filler_%d", i))
+	}
+	require.NoError(t, dbInstance.ssTable.RunCompaction())
+
+	value, err := dbInstance.GetFromSnapshot("key_1", snapshot)
+	require.NoError(t, err)
+	assert.Equal(t, "old value", value)
+	value, err = dbInstance.Get("key_1")
+	require.NoError(t, err)
+	assert.Equal(t, "new value", value)
+
+	it, err := dbInstance.NewIteratorFromSnapshot("key_", "key_~", snapshot)
+	require.NoError(t, err)
+	defer it.Close()
+	keyValues := map[string]string{}
+	for ; it.Valid(); it.Next() {
+		keyValues[it.Key()] = it.Value()
+	}
+	require.NoError(t, it.Error())
+	assert.Equal(t, map[string]string{"key_1": "old value", "key_2": "old value"}, keyValues)
+}
+
+func TestSelectFromSnapshotSkipsLaterRows(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	_, _, err := createTestTable(dbInstance, false)
+	require.NoError(t, err)
+	require.NoError(t, dbInstance.InsertIntoTable("INSERT INTO t1 VALUES (a, x, 5, 1)"))
+	snapshot := dbInstance.NewSnapshot()
+	defer snapshot.Release()
+	require.NoError(t, dbInstance.InsertIntoTable("INSERT INTO t1 VALUES (b, x, 5, 1)"))
+	putKeysUntilFlush(t, dbInstance, "filler")
+
+	for _, queryConditions := range [][]sqlparser.QueryCondition{
+		nil,
+		// secondary index scan
+		{{ColumnName: "c3", QueryType: sqlparser.Equals, Value: "5"}},
+		// full table scan and filter
+		{{ColumnName: "c2", QueryType: sqlparser.Equals, Value: "x"}},
+	} {
+		rows, err := dbInstance.selectFromTable(sqlparser.SelectFromTable{
+			TableName:       "t1",
+			ColumnsRequired: []string{"*"},
+			QueryConditions: queryConditions,
+		}, snapshot)
+		require.NoError(t, err)
+		assert.Equal(t, [][]string{{"a", "x", "5", "1"}}, rows)
+
+		rows, err = dbInstance.selectFromTable(sqlparser.SelectFromTable{
+			TableName:       "t1",
+			ColumnsRequired: []string{"*"},
+			QueryConditions: queryConditions,
+		}, nil)
+		require.NoError(t, err)
+		assert.Len(t, rows, 2)
+	}
+}
+
+func TestReleasedSnapshotCantBeRead(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	snapshot := dbInstance.NewSnapshot()
+	otherSnapshot := dbInstance.NewSnapshot()
+	assert.Len(t, dbInstance.liveSnapshots(), 1)
+	snapshot.Release()
+	snapshot.Release()
+	assert.Len(t, dbInstance.liveSnapshots(), 1)
+	otherSnapshot.Release()
+	assert.Empty(t, dbInstance.liveSnapshots())
+
+	_, err := dbInstance.GetFromSnapshot("key", snapshot)
+	assert.EqualError(t, err, SnapshotReleasedError)
+	_, err = dbInstance.NewIteratorFromSnapshot("", "", snapshot)
+	assert.EqualError(t, err, SnapshotReleasedError)
+}
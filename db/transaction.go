@@ -3,20 +3,80 @@ package db
 import (
 	"encoding/binary"
 	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"time"
 
 	"errors"
+
+	"github.com/golang-db/internalkey"
+	"github.com/golang-db/memtable"
+	sqlparser "github.com/golang-db/sql_parser"
+)
+
+const (
+	CmdTransaction           = "TRANSACTION"
+	WriteConflictError       = "cannot write key as it was updated after the transaction started"
+	TransactionFinishedError = "transaction is already committed or rolled back"
 )
 
+// ErrConflict is returned by the commit of an optimistic or a serializable transaction when a key it
+// read or wrote was updated, or a key was written into a range it scanned, by a write committed after the
+// transaction read it. the transaction is rolled back.
+var ErrConflict = errors.New("transaction conflicts with a concurrent write")
+
+type IsolationLevel int
+
 const (
-	WriteLockNotAcquiredDueToReadLocksError = "cannot acquire write lock as read lock acquired by one or more transactions"
-	CmdTransaction                          = "TRANSACTION"
+	// SnapshotIsolation reads every key from the snapshot taken when the transaction started. two
+	// transactions can't update the same key, but a transaction can miss the rows inserted by a concurrent
+	// one into the range it scanned.
+	SnapshotIsolation IsolationLevel = iota
+	// Serializable also records the keys read and the key ranges scanned by the transaction, including
+	// the ranges of the SQL table and index scans. the commit fails with ErrConflict if any of them was
+	// written after the snapshot, so the result is as if the transactions ran one after the other.
+	Serializable
 )
 
+// keyRange is the range [lower, upper) of keys, an empty upper means that the range is unbounded.
+type keyRange struct {
+	lower string
+	upper string
+}
+
+func (r keyRange) contains(key string) bool {
+	return key >= r.lower && (r.upper == "" || key < r.upper)
+}
+
 type Transaction struct {
-	id               uint64
-	db               *DB
+	id uint64
+	db *DB
+	// sequence number of the snapshot read by the transaction
+	snapshot uint64
+	finished bool
+	// optimistic transactions take no locks, their reads and writes are validated on commit instead
+	optimistic     bool
+	isolationLevel IsolationLevel
+	// key vs sequence number of the version read, 0 if the key wasn't found. only recorded by the
+	// transactions whose reads are validated on commit.
+	readVersionMap map[string]uint64
+	// key ranges scanned by the transactions whose reads are validated on commit
+	readRanges       []keyRange
 	bufferedWriteMap map[string]string
-	lockAcquiredKeys []string
+	// keys of bufferedWriteMap whose buffered write is a delete
+	bufferedDeleteKeys map[string]bool
+	lockAcquiredKeys   []string
+	// from the oldest to the newest savepoint
+	savepoints []savepoint
+}
+
+// savepoint is a copy of the buffered writes of the transaction when the savepoint was created.
+type savepoint struct {
+	name               string
+	bufferedWriteMap   map[string]string
+	bufferedDeleteKeys map[string]bool
 }
 
 type walPutCommand struct {
@@ -24,153 +84,370 @@ type walPutCommand struct {
 	value string
 }
 
-func (txn *Transaction) tryAcquireWriteLock(key string) error {
-	locksAcquired, ok := txn.db.transactionManager.keyVsLocksAcquiredMap[key]
-	readLockAlreadyAcquired := false
+// acquireWriteLock takes the write lock of the key. if another transaction holds it, the transaction
+// is queued for the lock and waits till it is handed over or the lock wait timeout expires.
+// ErrDeadlock is returned without waiting if the wait would close a cycle in the wait-for graph.
+func (txn *Transaction) acquireWriteLock(key string) error {
+	tm := &txn.db.transactionManager
+	tm.mu.Lock()
+	locksAcquired, ok := tm.keyVsLocksAcquiredMap[key]
 	if !ok {
-		locksAcquired = &LocksAcquired{}
-	} else {
-		writerTxnId := locksAcquired.writerTxnId
-		if writerTxnId != 0 && writerTxnId != txn.id {
-			// todo: can we have a wait feature where we wait for lock to be released instead of error?
-			return fmt.Errorf("cannot acquire write lock as write lock acquired by transaction '%d'", writerTxnId)
-		}
-		if writerTxnId == txn.id {
-			return nil
-		}
-
-		readerTxnIds := locksAcquired.readerTxnIds
-		if len(readerTxnIds) > 1 {
-			return errors.New(WriteLockNotAcquiredDueToReadLocksError)
-		}
-		if len(readerTxnIds) == 1 {
-			if readerTxnIds[0] == txn.id {
-				readLockAlreadyAcquired = true
-				locksAcquired.readerTxnIds = []uint64{}
-			} else {
-				return errors.New(WriteLockNotAcquiredDueToReadLocksError)
-			}
-		}
-	}
-	locksAcquired.writerTxnId = txn.id
-	if txn.lockAcquiredKeys == nil {
-		txn.lockAcquiredKeys = []string{}
-	}
-	if !readLockAlreadyAcquired {
+		tm.keyVsLocksAcquiredMap[key] = &LocksAcquired{writerTxnId: txn.id}
 		txn.lockAcquiredKeys = append(txn.lockAcquiredKeys, key)
+		tm.mu.Unlock()
+		return nil
 	}
-	txn.db.transactionManager.keyVsLocksAcquiredMap[key] = locksAcquired
-	return nil
-}
-
-func (txn *Transaction) tryAcquireReadLock(key string) error {
-	locksAcquired, ok := txn.db.transactionManager.keyVsLocksAcquiredMap[key]
-	writeLockAlreadyAcquired := false
-	if !ok {
-		locksAcquired = &LocksAcquired{}
-	} else {
-		writerTxnId := locksAcquired.writerTxnId
-		if writerTxnId != 0 {
-			if writerTxnId != txn.id {
-				return fmt.Errorf("cannot acquire read lock as write lock acquired by transaction '%d'", writerTxnId)
-			} else {
-				writeLockAlreadyAcquired = true
-			}
-		}
+	if locksAcquired.writerTxnId == txn.id {
+		tm.mu.Unlock()
+		return nil
 	}
-	for _, txnId := range locksAcquired.readerTxnIds {
-		if txnId == txn.id {
-			return nil
-		}
+	waiter := &lockWaiter{txn: txn, granted: make(chan struct{})}
+	locksAcquired.waiters = append(locksAcquired.waiters, waiter)
+	tm.txnIdVsAwaitedKeyMap[txn.id] = key
+	if tm.isDeadlocked(txn.id) {
+		tm.removeWaiter(key, waiter)
+		tm.mu.Unlock()
+		slog.Warn("DEADLOCK_DETECTED", "transaction_id", txn.id, "key", key)
+		return ErrDeadlock
 	}
-	locksAcquired.readerTxnIds = append(locksAcquired.readerTxnIds, txn.id)
-	if txn.lockAcquiredKeys == nil {
-		txn.lockAcquiredKeys = []string{}
+	tm.mu.Unlock()
+
+	timer := time.NewTimer(tm.lockWaitTimeout)
+	defer timer.Stop()
+	select {
+	case <-waiter.granted:
+		return nil
+	case <-timer.C:
 	}
-	if !writeLockAlreadyAcquired {
-		txn.lockAcquiredKeys = append(txn.lockAcquiredKeys, key)
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	select {
+	case <-waiter.granted:
+		// handed over while the timer fired
+		return nil
+	default:
 	}
-	txn.db.transactionManager.keyVsLocksAcquiredMap[key] = locksAcquired
-	return nil
+	tm.removeWaiter(key, waiter)
+	return fmt.Errorf("%w: cannot acquire write lock as write lock acquired by transaction '%d'",
+		ErrLockWaitTimeout, locksAcquired.writerTxnId)
 }
 
+// Put takes the write lock of the key, which is held till the transaction commits or rolls back.
+// the write fails with WriteConflictError if the key was updated after the snapshot of the transaction, the
+// update would be lost otherwise. hence a Put which waited for the lock usually fails once the holder commits,
+// it only succeeds if the holder rolled back or didn't write the key.
+// the transaction is rolled back if it is picked as the victim of a deadlock.
 // todo: optimisation for later: sharded locks
 func (txn *Transaction) Put(key, value string) error {
-	txn.db.transactionManager.mu.Lock()
-	err := txn.tryAcquireWriteLock(key)
-	txn.db.transactionManager.mu.Unlock()
+	return txn.write(key, value, false)
+}
+
+// Delete takes the write lock of the key like Put, the key is deleted when the transaction commits.
+func (txn *Transaction) Delete(key string) error {
+	return txn.write(key, "", true)
+}
+
+func (txn *Transaction) write(key, value string, isDelete bool) error {
+	if txn.finished {
+		return errors.New(TransactionFinishedError)
+	}
+	if txn.optimistic {
+		// the conflicts are found on commit
+		txn.bufferWrite(key, value, isDelete)
+		return nil
+	}
+	wasLockHeld := slices.Contains(txn.lockAcquiredKeys, key)
+	err := txn.acquireWriteLock(key)
+	if errors.Is(err, ErrDeadlock) {
+		txn.Rollback()
+	}
 	if err != nil {
 		return err
 	}
+	// no other transaction can commit the key while the write lock is held
+	txn.db.mu.RLock()
+	newestVersion, found, err := txn.db.getVersion(key, internalkey.MaxSequence)
+	txn.db.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	if found && newestVersion.Sequence > txn.snapshot {
+		// a lock acquired by this write is handed over right away, the transactions queued for it
+		// don't wait for one which can't write the key. after a lock wait this is the common outcome,
+		// the holder which committed has updated the key after the snapshot of every transaction
+		// queued for it, so they all fail in turn as soon as it commits.
+		if !wasLockHeld {
+			txn.releaseLock(key)
+		}
+		return errors.New(WriteConflictError)
+	}
+	txn.bufferWrite(key, value, isDelete)
+	return nil
+}
 
+func (txn *Transaction) bufferWrite(key, value string, isDelete bool) {
 	if txn.bufferedWriteMap == nil {
 		txn.bufferedWriteMap = map[string]string{}
 	}
+	if txn.bufferedDeleteKeys == nil {
+		txn.bufferedDeleteKeys = map[string]bool{}
+	}
 	txn.bufferedWriteMap[key] = value
-	return nil
+	if isDelete {
+		txn.bufferedDeleteKeys[key] = true
+	} else {
+		delete(txn.bufferedDeleteKeys, key)
+	}
 }
 
+// Get returns the buffered write of the key if any, else the value of the key in the snapshot of the
+// transaction. no lock is taken, so the reads never block or fail due to other transactions.
+// an optimistic or a serializable transaction records the version it read, to be validated on commit.
 func (txn *Transaction) Get(key string) (string, error) {
-	txn.db.transactionManager.mu.Lock()
-	err := txn.tryAcquireReadLock(key)
-	txn.db.transactionManager.mu.Unlock()
+	if value, ok := txn.bufferedWriteMap[key]; ok {
+		return value, nil
+	}
+	txn.db.mu.RLock()
+	defer txn.db.mu.RUnlock()
+	version, found, err := txn.db.getVersion(key, txn.snapshot)
 	if err != nil {
 		return "", err
 	}
-	if value, ok := txn.bufferedWriteMap[key]; ok {
-		return value, nil
+	if txn.validatesReads() {
+		if txn.readVersionMap == nil {
+			txn.readVersionMap = map[string]uint64{}
+		}
+		txn.readVersionMap[key] = version.Sequence
+	}
+	if !found || version.Tombstone {
+		return "", nil
+	}
+	return version.Value, nil
+}
+
+// returns true if the reads of the transaction are recorded and validated on commit.
+func (txn *Transaction) validatesReads() bool {
+	return txn.optimistic || txn.isolationLevel == Serializable
+}
+
+// get and rangeScan let the SQL queries run within the transaction.
+func (txn *Transaction) get(key string) (string, error) {
+	return txn.Get(key)
+}
+
+// rangeScan reads the keys within [lower, upper) from the snapshot of the transaction merged with its
+// buffered writes, in the order of the keys. the keys are read as fn asks for them, so a LIMIT stops the
+// scan early. the whole scanned range is recorded even then, so that a key written into it by a concurrent
+// transaction fails the commit of a serializable one.
+func (txn *Transaction) rangeScan(lower, upper string, fn func(key, value string) error) error {
+	scannedRange := keyRange{lower: lower, upper: upper}
+	var bufferedKeys []string
+	for key := range txn.bufferedWriteMap {
+		if scannedRange.contains(key) {
+			bufferedKeys = append(bufferedKeys, key)
+		}
+	}
+	slices.Sort(bufferedKeys)
+	txn.db.mu.Lock()
+	it, err := txn.db.newIteratorAtSequence(scannedRange.lower, scannedRange.upper, txn.snapshot)
+	txn.db.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	defer it.Close()
+	if txn.validatesReads() {
+		txn.readRanges = append(txn.readRanges, scannedRange)
+	}
+	// emits the buffered keys before the given key, all the remaining ones if all is set.
+	emitBufferedKeysBefore := func(key string, all bool) error {
+		for len(bufferedKeys) > 0 && (all || bufferedKeys[0] < key) {
+			bufferedKey := bufferedKeys[0]
+			bufferedKeys = bufferedKeys[1:]
+			if txn.bufferedDeleteKeys[bufferedKey] {
+				continue
+			}
+			if err := fn(bufferedKey, txn.bufferedWriteMap[bufferedKey]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for ; it.Valid(); it.Next() {
+		if err := emitBufferedKeysBefore(it.Key(), false); err != nil {
+			return err
+		}
+		if len(bufferedKeys) > 0 && bufferedKeys[0] == it.Key() {
+			// the buffered write of the key is emitted in place of the value in the snapshot.
+			continue
+		}
+		if err := fn(it.Key(), it.Value()); err != nil {
+			return err
+		}
+	}
+	if err := it.Error(); err != nil {
+		return err
+	}
+	return emitBufferedKeysBefore("", true)
+}
+
+// validateCommit returns ErrConflict if a key read or written by the transaction has a version newer
+// than the one the transaction saw, or if a range it scanned has a key written after its snapshot.
+// it is called with db.mu held exclusively, by the leader of the group commit or by the commit of a
+// transaction without writes.
+func (txn *Transaction) validateCommit(keysWrittenInGroup map[string]bool) error {
+	// the version seen by a write without a read is the one in the snapshot
+	seenSequences := map[string]uint64{}
+	for key := range txn.bufferedWriteMap {
+		seenSequences[key] = txn.snapshot
+	}
+	maps.Copy(seenSequences, txn.readVersionMap)
+	for key, seenSequence := range seenSequences {
+		if keysWrittenInGroup[key] {
+			return ErrConflict
+		}
+		// every version committed after the key was seen has a greater sequence number. a tombstone
+		// dropped by compaction is not a change, hence a missing version is not a conflict.
+		newestVersion, found, err := txn.db.getVersion(key, internalkey.MaxSequence)
+		if err != nil {
+			return err
+		}
+		if found && newestVersion.Sequence > seenSequence {
+			return ErrConflict
+		}
+	}
+	for _, scannedRange := range txn.readRanges {
+		for key := range keysWrittenInGroup {
+			if scannedRange.contains(key) {
+				return ErrConflict
+			}
+		}
+		// a phantom: a key written into the range after the snapshot
+		written, err := txn.db.hasVersionsNewerThan(scannedRange.lower, scannedRange.upper, txn.snapshot)
+		if err != nil {
+			return err
+		}
+		if written {
+			return ErrConflict
+		}
 	}
-	return txn.db.Get(key)
+	return nil
 }
 
+// releases the locks and hands each of them over to the transaction waiting for it the longest.
 func (txn *Transaction) releaseAllLocks() {
+	// commits of different transactions release their locks concurrently
+	txn.db.transactionManager.mu.Lock()
+	defer txn.db.transactionManager.mu.Unlock()
 	for _, key := range txn.lockAcquiredKeys {
 		locksAcquired := txn.db.transactionManager.keyVsLocksAcquiredMap[key]
-		if locksAcquired.writerTxnId == txn.id {
-			locksAcquired.writerTxnId = 0
-		} else {
-			currentTxnIdFound := false
-			updatedReaderTxnIds := []uint64{}
-			for _, readerTxnId := range locksAcquired.readerTxnIds {
-				if readerTxnId == txn.id {
-					currentTxnIdFound = true
-					continue
-				}
-				updatedReaderTxnIds = append(updatedReaderTxnIds, readerTxnId)
-			}
-			if !currentTxnIdFound {
-				fmt.Println("INCONSISTENCY_OBSERVED_lockAcquiredKeys_AND_keyVsLocksAcquiredMap", map[string]interface{}{
-					"lockAcquiredKeys":      txn.lockAcquiredKeys,
-					"keyVsLocksAcquiredMap": txn.db.transactionManager.keyVsLocksAcquiredMap[key],
-					"key":                   key,
-				})
-			}
-			locksAcquired.readerTxnIds = updatedReaderTxnIds
+		if locksAcquired == nil || locksAcquired.writerTxnId != txn.id {
+			fmt.Println("INCONSISTENCY_OBSERVED_lockAcquiredKeys_AND_keyVsLocksAcquiredMap", map[string]interface{}{
+				"lockAcquiredKeys":      txn.lockAcquiredKeys,
+				"keyVsLocksAcquiredMap": txn.db.transactionManager.keyVsLocksAcquiredMap[key],
+				"key":                   key,
+			})
+			continue
 		}
+		txn.db.transactionManager.grantToNextWaiter(key, locksAcquired)
 	}
 	txn.lockAcquiredKeys = []string{}
 }
 
+// hands the write lock of the key over to the next transaction queued for it, or frees it.
+func (txn *Transaction) releaseLock(key string) {
+	tm := &txn.db.transactionManager
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	txn.lockAcquiredKeys = slices.DeleteFunc(txn.lockAcquiredKeys, func(k string) bool {
+		return k == key
+	})
+	if locksAcquired := tm.keyVsLocksAcquiredMap[key]; locksAcquired != nil && locksAcquired.writerTxnId == txn.id {
+		tm.grantToNextWaiter(key, locksAcquired)
+	}
+}
+
+// releases the snapshot of the transaction, so that compaction can drop the versions only it reads.
+func (txn *Transaction) releaseSnapshot() {
+	if !txn.finished {
+		txn.finished = true
+		txn.db.releaseSnapshot(txn.snapshot)
+	}
+}
+
 func (txn *Transaction) cleanupBufferedWriteMap() {
 	txn.bufferedWriteMap = map[string]string{}
+	txn.bufferedDeleteKeys = map[string]bool{}
+	txn.savepoints = nil
+}
+
+// Savepoint marks the current state of the buffered writes, RollbackTo restores it.
+// a savepoint with the name of an older one hides the older one till it is released.
+func (txn *Transaction) Savepoint(name string) error {
+	if txn.finished {
+		return errors.New(TransactionFinishedError)
+	}
+	txn.savepoints = append(txn.savepoints, savepoint{
+		name:               name,
+		bufferedWriteMap:   maps.Clone(txn.bufferedWriteMap),
+		bufferedDeleteKeys: maps.Clone(txn.bufferedDeleteKeys),
+	})
+	return nil
+}
+
+// returns the position of the newest savepoint with the name.
+func (txn *Transaction) findSavepoint(name string) (int, error) {
+	for i := len(txn.savepoints) - 1; i >= 0; i-- {
+		if txn.savepoints[i].name == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("savepoint %q not found", name)
+}
+
+// RollbackTo discards the writes buffered after the savepoint and the savepoints created after it.
+// the savepoint itself is kept, so it can be rolled back to again.
+// the locks taken after the savepoint are kept till the transaction ends, as in two-phase locking a lock
+// is never released before the transaction commits or rolls back. the reads made after the savepoint are
+// still validated on commit by the optimistic and the serializable transactions.
+func (txn *Transaction) RollbackTo(name string) error {
+	i, err := txn.findSavepoint(name)
+	if err != nil {
+		return err
+	}
+	txn.bufferedWriteMap = maps.Clone(txn.savepoints[i].bufferedWriteMap)
+	txn.bufferedDeleteKeys = maps.Clone(txn.savepoints[i].bufferedDeleteKeys)
+	txn.savepoints = txn.savepoints[:i+1]
+	return nil
+}
+
+// Release removes the savepoint and the savepoints created after it, the buffered writes are kept.
+func (txn *Transaction) Release(name string) error {
+	i, err := txn.findSavepoint(name)
+	if err != nil {
+		return err
+	}
+	txn.savepoints = txn.savepoints[:i]
+	return nil
 }
 
 func (txn *Transaction) Rollback() {
 	txn.releaseAllLocks()
+	txn.releaseSnapshot()
 	txn.cleanupBufferedWriteMap()
 }
 
 // payload structure:
 // [length_of_command][command="TRANSACTION"][number_of_writes]
 // [key_length_for_1st][key_for_1st][value_length_for_1st][value_for_1st]...
+// the writes are in sorted key order, which is also the order of their sequence numbers.
 func serialiseTransactionCommitPayload(writeMap map[string]string) []byte {
 	buf := []byte{}
 	buf = appendLengthPrefixedString(buf, CmdTransaction)
 	buf = binary.BigEndian.AppendUint32(buf, uint32(len(writeMap)))
 
-	for key, value := range writeMap {
+	for _, key := range slices.Sorted(maps.Keys(writeMap)) {
 		buf = appendLengthPrefixedString(buf, key)
-		buf = appendLengthPrefixedString(buf, value)
+		buf = appendLengthPrefixedString(buf, writeMap[key])
 	}
 	return buf
 }
@@ -203,30 +480,147 @@ func deserialiseTransactionCommand(buf []byte) ([]walPutCommand, error) {
 	return putCmds, nil
 }
 
-// necessary to do in a single WAL write for atomicity
+// necessary to do in a single WAL write for atomicity. both the pessimistic and the optimistic
+// transactions commit through it, the reads of the optimistic and the serializable ones are validated
+// by the group commit leader.
 func (txn *Transaction) writeSingleWalEntryForCommit() error {
+	keys := slices.Sorted(maps.Keys(txn.bufferedWriteMap))
+	ops := make([]batchOp, 0, len(keys))
+	for _, key := range keys {
+		if txn.bufferedDeleteKeys[key] {
+			ops = append(ops, batchOp{cmd: CmdDelete, key: key})
+		} else {
+			ops = append(ops, batchOp{cmd: CmdPut, key: key, value: txn.bufferedWriteMap[key]})
+		}
+	}
+	// the TRANSACTION record only holds puts, a transaction with deletes is written as a BATCH record.
+	// both use consecutive sequence numbers in sorted key order.
 	buf := serialiseTransactionCommitPayload(txn.bufferedWriteMap)
-	return txn.db.wal.WriteEntry(buf)
+	if len(txn.bufferedDeleteKeys) > 0 {
+		buf = serialiseBatchCommand(ops)
+	}
+	var validate func(keysWrittenInGroup map[string]bool) error
+	if txn.validatesReads() {
+		validate = txn.validateCommit
+	}
+	// put in memtable done separately instead of db.Put as that would lead to separate writes in WAL
+	return txn.db.writeValidated(buf, keys, func(memTable *memtable.Memtable, sequence uint64) {
+		applyBatch(memTable, ops, sequence)
+	}, validate)
 }
 
+// Commit writes the buffered writes with a single wal record. the transaction is rolled back if the commit
+// fails. an optimistic or a serializable transaction which conflicts with a concurrent write fails with
+// ErrConflict. a transaction whose writes don't fit in a single wal record can never commit, it fails with
+// ErrWriteTooLarge.
+// a transaction without writes has nothing to write to the wal, only its reads are validated if it validates them.
 func (txn *Transaction) Commit() error {
+	if txn.finished {
+		return errors.New(TransactionFinishedError)
+	}
+	if len(txn.bufferedWriteMap) == 0 {
+		var err error
+		if txn.validatesReads() {
+			// the scans of the ranges clone the memtables, which needs the exclusive lock
+			txn.db.mu.Lock()
+			err = txn.validateCommit(nil)
+			txn.db.mu.Unlock()
+		}
+		txn.Rollback()
+		return err
+	}
 	if err := txn.writeSingleWalEntryForCommit(); err != nil {
+		// the transaction is finished on every error, a failed wal write included. otherwise its locks
+		// would block the other writers of its keys and its snapshot would pin the old versions.
+		txn.Rollback()
 		return err
 	}
 
-	// put in memtable done separately instead of db.Put as that would lead to separate writes in WAL
-	for key, value := range txn.bufferedWriteMap {
-		txn.db.memTable.Put(key, value)
+	txn.releaseAllLocks()
+	txn.releaseSnapshot()
+	txn.cleanupBufferedWriteMap()
+
+	return nil
+}
+
+// InsertIntoTable runs the INSERT INTO query, the row and its index entries are written by the transaction.
+func (txn *Transaction) InsertIntoTable(query string) error {
+	input, err := sqlparser.NewParser(query).ParseInsertIntoTable()
+	if err != nil {
+		return err
+	}
+	return txn.db.insertIntoTableInTxn(*input, txn)
+}
+
+// UpdateTable runs the UPDATE query, the updated rows and their index entries are written by the transaction.
+// returns the number of rows updated.
+func (txn *Transaction) UpdateTable(query string) (int, error) {
+	if txn.finished {
+		return 0, errors.New(TransactionFinishedError)
+	}
+	input, err := sqlparser.NewParser(query).ParseUpdateTable()
+	if err != nil {
+		return 0, err
+	}
+	return txn.db.updateTableInTxn(*input, txn)
+}
+
+// DeleteFromTable runs the DELETE FROM query, the rows and their index entries are deleted by the transaction.
+// returns the number of rows deleted.
+func (txn *Transaction) DeleteFromTable(query string) (int, error) {
+	if txn.finished {
+		return 0, errors.New(TransactionFinishedError)
+	}
+	input, err := sqlparser.NewParser(query).ParseDeleteFromTable()
+	if err != nil {
+		return 0, err
 	}
+	return txn.db.deleteFromTableInTxn(*input, txn)
+}
 
-	if txn.db.memTable.ShouldFlush() {
-		if err := txn.db.createSsTableAndClearWalAndMemTable(); err != nil {
+// Exec runs an INSERT INTO, UPDATE, DELETE FROM, SAVEPOINT, ROLLBACK TO or RELEASE statement within the transaction.
+func (txn *Transaction) Exec(query string) error {
+	parser := sqlparser.NewParser(query)
+	switch strings.ToUpper(strings.SplitN(strings.TrimSpace(query), " ", 2)[0]) {
+	case sqlparser.KeywordInsert:
+		return txn.InsertIntoTable(query)
+	case sqlparser.KeywordUpdate:
+		_, err := txn.UpdateTable(query)
+		return err
+	case sqlparser.KeywordDelete:
+		_, err := txn.DeleteFromTable(query)
+		return err
+	case sqlparser.KeywordSavepoint:
+		input, err := parser.ParseSavepoint()
+		if err != nil {
+			return err
+		}
+		return txn.Savepoint(input.Name)
+	case sqlparser.KeywordRollback:
+		input, err := parser.ParseRollbackToSavepoint()
+		if err != nil {
+			return err
+		}
+		return txn.RollbackTo(input.Name)
+	case sqlparser.KeywordRelease:
+		input, err := parser.ParseReleaseSavepoint()
+		if err != nil {
 			return err
 		}
+		return txn.Release(input.Name)
 	}
+	return fmt.Errorf("statement not supported within a transaction: %q", query)
+}
 
-	txn.releaseAllLocks()
-	txn.cleanupBufferedWriteMap()
-
-	return nil
+// SelectFromTable runs the SELECT query on the snapshot of the transaction, its own writes included.
+// a serializable transaction records the rows and the table and index ranges the query read.
+func (txn *Transaction) SelectFromTable(query string) ([][]string, error) {
+	if txn.finished {
+		return nil, errors.New(TransactionFinishedError)
+	}
+	input, err := sqlparser.NewParser(query).ParseSelectFromTable()
+	if err != nil {
+		return nil, err
+	}
+	return txn.db.selectRows(*input, txn)
 }
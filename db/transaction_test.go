@@ -3,13 +3,16 @@ package db
 import (
 	"fmt"
 	"os"
-	"strings"
+	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
+	sqlparser "github.com/golang-db/sql_parser"
 	"github.com/golang-db/sstable"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func newDBForTest() (*DB, func(), error) {
@@ -18,14 +21,27 @@ func newDBForTest() (*DB, func(), error) {
 			DataFilesDirectory: "temp",
 		},
 		WalFilePath: "temp_wal.log",
+		// the tests expecting a write lock to be unavailable wait for the whole timeout
+		LockWaitTimeout: 20 * time.Millisecond,
 	})
 	cleanupFunc := func() {
 		defer os.RemoveAll("temp")
-		defer os.Remove("temp_wal.log")
+		defer removeWalSegments("temp_wal.log")
+		// the flush loop must not write to the files once they are removed
+		if dbInstance != nil {
+			dbInstance.Close()
+		}
 	}
 	return dbInstance, cleanupFunc, err
 }
 
+func removeWalSegments(walFilePath string) {
+	segmentFilePaths, _ := filepath.Glob(walFilePath + ".*")
+	for _, segmentFilePath := range segmentFilePaths {
+		os.Remove(segmentFilePath)
+	}
+}
+
 // same transaction get -> put -> get should read from buffered writes
 func TestSameTransactionPutAndGet(t *testing.T) {
 	dbInstance, cleanupFunc, err := newDBForTest()
@@ -50,7 +66,8 @@ func TestSameTransactionPutAndGet(t *testing.T) {
 	assert.Equal(t, expectedValue, val)
 }
 
-// t1 acquires read lock first. t1 upgrades to write lock. t2 will not be able to acquire read lock after that.
+// t1 acquires write lock. t2 doesn't take any lock to read, it reads the value from its snapshot
+// instead of the buffered write of t1.
 func TestDifferentTransactionPutAndGetWithPutAcquiringLock(t *testing.T) {
 	dbInstance, cleanupFunc, err := newDBForTest()
 	defer cleanupFunc()
@@ -71,11 +88,12 @@ func TestDifferentTransactionPutAndGetWithPutAcquiringLock(t *testing.T) {
 	txn2, err := dbInstance.Begin()
 	assert.Nil(t, err)
 
-	_, err = txn2.Get(testKey)
-	assert.Equal(t, "cannot acquire read lock as write lock acquired by transaction '1'", err.Error())
+	val, err := txn2.Get(testKey)
+	assert.Nil(t, err)
+	assert.Equal(t, "", val)
 }
 
-// t1 acquires read lock first, hence t2 will not be able to acquire write lock
+// reads don't take locks, hence t1 reading a key doesn't stop t2 from writing it
 func TestDifferentTransactionPutAndGetWithGetAcquiringLock(t *testing.T) {
 	dbInstance, cleanupFunc, err := newDBForTest()
 	defer cleanupFunc()
@@ -93,7 +111,7 @@ func TestDifferentTransactionPutAndGetWithGetAcquiringLock(t *testing.T) {
 	assert.Nil(t, err)
 
 	err = txn2.Put(testKey, "value")
-	assert.Equal(t, "cannot acquire write lock as read lock acquired by one or more transactions", err.Error())
+	assert.Nil(t, err)
 }
 
 // multiple transactions should be able to acquire read lock for a key at the same time
@@ -144,7 +162,7 @@ func TestDifferentOpenTransactionPutWithDifferentKeys(t *testing.T) {
 }
 
 // if t1 and t2 are calling put on the same key, t2 (which tried acquiring later)
-// should get an error
+// should get an error once it times out waiting for the lock
 func TestDifferentOpenTransactionPutWithSameKey(t *testing.T) {
 	dbInstance, cleanupFunc, err := newDBForTest()
 	defer cleanupFunc()
@@ -167,11 +185,12 @@ func TestDifferentOpenTransactionPutWithSameKey(t *testing.T) {
 	assert.Nil(t, err)
 
 	err = txn2.Put(testKey, expectedValue)
-	assert.Equal(t, "cannot acquire write lock as write lock acquired by transaction '1'", err.Error())
+	assert.ErrorIs(t, err, ErrLockWaitTimeout)
+	assert.EqualError(t, err, "lock wait timed out: cannot acquire write lock as write lock acquired by transaction '1'")
 }
 
-// t1 acquires write lock, t2 will not be able to acquire read lock
-// t2 rollsback, t2 will be able to read and reads an old value
+// t1 acquires write lock, t2 will not be able to acquire write lock
+// t1 rollsback, t2 will be able to write and reads an old value
 func TestRollbackReleasesLockAndCleansUpBufferedWrite(t *testing.T) {
 	dbInstance, cleanupFunc, err := newDBForTest()
 	defer cleanupFunc()
@@ -193,18 +212,20 @@ func TestRollbackReleasesLockAndCleansUpBufferedWrite(t *testing.T) {
 	txn2, err := dbInstance.Begin()
 	assert.Nil(t, err)
 
-	_, err = txn2.Get(testKey)
-	assert.Equal(t, "cannot acquire read lock as write lock acquired by transaction '1'", err.Error())
+	err = txn2.Put(testKey, "value_by_txn2")
+	assert.ErrorIs(t, err, ErrLockWaitTimeout)
 
 	txn.Rollback()
 
-	val, err = txn2.Get(testKey)
+	err = txn2.Put(testKey, "value_by_txn2")
+	assert.Nil(t, err)
+	val, err = dbInstance.Get(testKey)
 	assert.Nil(t, err)
 	assert.Equal(t, "", val)
 }
 
 // t1 acquires write lock and does multiple write operations
-// t2 will not be able to acquire read lock on any of the keys
+// t2 reads none of the writes, neither before nor after t1 commits as they are not part of its snapshot
 // t1 commits
 // t3 starts in a new db instance requiring to build memtable from wal during init
 // reads from t3 return all updated values as per updates by t1
@@ -224,12 +245,17 @@ func TestCommitReleasesLockAndPersistsAllWrites(t *testing.T) {
 	txn2, err := dbInstance.Begin()
 	assert.Nil(t, err)
 
-	for i := 200; i <= 210; i++ {
-		_, err := txn2.Get(fmt.Sprintf("key_%d", i))
-		assert.Equal(t, "cannot acquire read lock as write lock acquired by transaction '1'", err.Error())
+	assertTxn2ReadsNoWrite := func() {
+		for i := 200; i <= 210; i++ {
+			val, err := txn2.Get(fmt.Sprintf("key_%d", i))
+			assert.Nil(t, err)
+			assert.Equal(t, "", val)
+		}
 	}
+	assertTxn2ReadsNoWrite()
 
 	txn.Commit()
+	assertTxn2ReadsNoWrite()
 
 	// create a new db instance after commit. this will also test the deserialisation logic during
 	// application init (buildMemtableFromWal) specifically for deserialiseTransactionCommand.
@@ -244,9 +270,10 @@ func TestCommitReleasesLockAndPersistsAllWrites(t *testing.T) {
 	}
 }
 
-// t1 to t11: 11 transactions parallely try to acquire write lock, only 1 should succeed.
-// when all of them try to read, only 1 should succeed which is the transaction which acquired the
-// write lock.
+// t1 to t11: 11 transactions parallely try to acquire write lock, only 1 should succeed. the holder
+// doesn't commit till every transaction has attempted the put, so the others time out waiting.
+// when all of them try to read, only the transaction which acquired the write lock reads its write,
+// the others read the empty value from their snapshot.
 // after commit, also assert the value with db.Get.
 func TestPutAndGetRaceConditionOnlyOneShouldAcquireWriteLock(t *testing.T) {
 	dbInstance, cleanupFunc, err := newDBForTest()
@@ -265,9 +292,14 @@ func TestPutAndGetRaceConditionOnlyOneShouldAcquireWriteLock(t *testing.T) {
 
 	var wg sync.WaitGroup
 	wg.Add(11)
+	// commits only start after every transaction has attempted the put and get. the puts which don't
+	// get the write lock wait for it, the first commit would hand it over to them and they would fail
+	// with WriteConflictError instead of timing out.
+	var attemptsWg sync.WaitGroup
+	attemptsWg.Add(11)
 
 	var putErrCount atomic.Int32
-	var getErrCount atomic.Int32
+	var emptyReadCount atomic.Int32
 
 	expectedValue := ""
 
@@ -275,20 +307,21 @@ func TestPutAndGetRaceConditionOnlyOneShouldAcquireWriteLock(t *testing.T) {
 		go func() {
 			putErr := txns[i].Put(commonKey, fmt.Sprintf("value_%d", i))
 			if putErr != nil {
-				hasExpectedErrorPrefix := strings.HasPrefix(putErr.Error(), "cannot acquire write lock as write lock acquired by transaction")
-				assert.True(t, hasExpectedErrorPrefix)
+				assert.ErrorIs(t, putErr, ErrLockWaitTimeout)
 				putErrCount.Add(1)
 			}
 
 			val, getErr := txns[i].Get(commonKey)
-			if getErr != nil {
-				hasExpectedErrorPrefix := strings.HasPrefix(getErr.Error(), "cannot acquire read lock as write lock acquired by transaction")
-				assert.True(t, hasExpectedErrorPrefix)
-				getErrCount.Add(1)
-			} else {
+			assert.Nil(t, getErr)
+			if putErr == nil {
 				expectedValue = val
 				assert.Equal(t, fmt.Sprintf("value_%d", i), val)
+			} else {
+				assert.Equal(t, "", val)
+				emptyReadCount.Add(1)
 			}
+			attemptsWg.Done()
+			attemptsWg.Wait()
 			txns[i].Commit()
 			wg.Done()
 		}()
@@ -296,9 +329,230 @@ func TestPutAndGetRaceConditionOnlyOneShouldAcquireWriteLock(t *testing.T) {
 	wg.Wait()
 
 	assert.Equal(t, int32(10), putErrCount.Load())
-	assert.Equal(t, int32(10), getErrCount.Load())
+	assert.Equal(t, int32(10), emptyReadCount.Load())
 
 	val, err := dbInstance.Get(commonKey)
 	assert.Nil(t, err)
 	assert.Equal(t, expectedValue, val)
 }
+
+// t1 scans the rows with c2 = x and writes a row based on what it read, meanwhile a row with c2 = x is
+// inserted. at snapshot isolation t1 commits without having seen the phantom row, at serializable the
+// commit fails.
+func TestSerializableTransactionFailsCommitOnPhantomInsertIntoScannedTable(t *testing.T) {
+	for _, isolationLevel := range []IsolationLevel{SnapshotIsolation, Serializable} {
+		dbInstance, _ := newDBForWalCommandTest(t)
+		_, _, err := createTestTable(dbInstance, false)
+		require.NoError(t, err)
+		require.NoError(t, dbInstance.InsertIntoTable("INSERT INTO t1 VALUES (a, x, 5, 1)"))
+
+		txn, err := dbInstance.BeginWithIsolation(isolationLevel)
+		require.NoError(t, err)
+		rows, err := txn.SelectFromTable("SELECT * FROM t1 WHERE c2 = x;")
+		require.NoError(t, err)
+		assert.Len(t, rows, 1)
+
+		require.NoError(t, dbInstance.InsertIntoTable("INSERT INTO t1 VALUES (b, x, 6, 1)"))
+		rows, err = txn.SelectFromTable("SELECT * FROM t1 WHERE c2 = x;")
+		require.NoError(t, err)
+		assert.Len(t, rows, 1, "the phantom is never visible to the snapshot")
+		require.NoError(t, txn.InsertIntoTable("INSERT INTO t1 VALUES (c, y, 1, 0)"))
+
+		if isolationLevel == Serializable {
+			assert.ErrorIs(t, txn.Commit(), ErrConflict)
+		} else {
+			assert.NoError(t, txn.Commit())
+		}
+		dbInstance.Close()
+	}
+}
+
+// the rows are read through the index on (c3, c4), so only an insert into the scanned index range is a phantom
+func TestSerializableTransactionConflictsOnlyWithInsertsIntoScannedIndexRange(t *testing.T) {
+	for _, test := range []struct {
+		concurrentInsert string
+		expectedErr      error
+	}{
+		{concurrentInsert: "INSERT INTO t1 VALUES (b, x, 6, 1)", expectedErr: nil},
+		{concurrentInsert: "INSERT INTO t1 VALUES (b, x, 5, 0)", expectedErr: ErrConflict},
+	} {
+		dbInstance, _ := newDBForWalCommandTest(t)
+		_, _, err := createTestTable(dbInstance, false)
+		require.NoError(t, err)
+		require.NoError(t, dbInstance.InsertIntoTable("INSERT INTO t1 VALUES (a, x, 5, 1)"))
+
+		txn, err := dbInstance.BeginWithIsolation(Serializable)
+		require.NoError(t, err)
+		rows, err := txn.SelectFromTable("SELECT * FROM t1 WHERE c3 = 5;")
+		require.NoError(t, err)
+		assert.Equal(t, [][]string{{"a", "x", "5", "1"}}, rows)
+		require.NoError(t, txn.InsertIntoTable("INSERT INTO t1 VALUES (c, y, 1, 0)"))
+
+		require.NoError(t, dbInstance.InsertIntoTable(test.concurrentInsert))
+		err = txn.Commit()
+		if test.expectedErr == nil {
+			assert.NoError(t, err, test.concurrentInsert)
+		} else {
+			assert.ErrorIs(t, err, test.expectedErr, test.concurrentInsert)
+		}
+		dbInstance.Close()
+	}
+}
+
+func TestTransactionSelectReadsItsOwnInserts(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	_, _, err := createTestTable(dbInstance, false)
+	require.NoError(t, err)
+	require.NoError(t, dbInstance.InsertIntoTable("INSERT INTO t1 VALUES (a, x, 5, 1)"))
+
+	txn, err := dbInstance.BeginWithIsolation(Serializable)
+	require.NoError(t, err)
+	require.NoError(t, txn.InsertIntoTable("INSERT INTO t1 VALUES (b, x, 5, 0)"))
+	rows, err := txn.SelectFromTable("SELECT * FROM t1 WHERE c3 = 5;")
+	require.NoError(t, err)
+	// in the order of the index keys
+	assert.Equal(t, [][]string{{"b", "x", "5", "0"}, {"a", "x", "5", "1"}}, rows)
+	require.NoError(t, txn.Commit())
+
+	rows, err = dbInstance.selectFromTable(sqlparser.SelectFromTable{
+		TableName:       "t1",
+		ColumnsRequired: []string{"*"},
+	}, nil)
+	require.NoError(t, err)
+	assert.Len(t, rows, 2)
+}
+
+// the writes after the savepoint are undone, the locks taken after it are kept till the transaction ends
+func TestRollbackToSavepointRestoresBufferedWrites(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	txn, err := dbInstance.Begin()
+	require.NoError(t, err)
+	require.NoError(t, txn.Put("key_1", "value before savepoint"))
+	require.NoError(t, txn.Savepoint("step1"))
+	require.NoError(t, txn.Put("key_1", "value after savepoint"))
+	require.NoError(t, txn.Put("key_2", "value after savepoint"))
+
+	require.NoError(t, txn.RollbackTo("step1"))
+	for key, expected := range map[string]string{"key_1": "value before savepoint", "key_2": ""} {
+		value, err := txn.Get(key)
+		require.NoError(t, err)
+		assert.Equal(t, expected, value, key)
+	}
+	assert.Equal(t, txn.id, dbInstance.transactionManager.keyVsLocksAcquiredMap["key_2"].writerTxnId)
+
+	// the savepoint is kept after rolling back to it
+	require.NoError(t, txn.Put("key_1", "value after second savepoint"))
+	require.NoError(t, txn.RollbackTo("step1"))
+	require.NoError(t, txn.Commit())
+
+	for key, expected := range map[string]string{"key_1": "value before savepoint", "key_2": ""} {
+		value, err := dbInstance.Get(key)
+		require.NoError(t, err)
+		assert.Equal(t, expected, value, key)
+	}
+	assert.Empty(t, dbInstance.transactionManager.keyVsLocksAcquiredMap)
+}
+
+func TestReleaseSavepointRemovesItAndTheNewerOnes(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	txn, err := dbInstance.Begin()
+	require.NoError(t, err)
+	defer txn.Rollback()
+	require.NoError(t, txn.Savepoint("step1"))
+	require.NoError(t, txn.Put("key", "value 1"))
+	require.NoError(t, txn.Savepoint("step2"))
+	require.NoError(t, txn.Put("key", "value 2"))
+	require.NoError(t, txn.Savepoint("step1"))
+	require.NoError(t, txn.Put("key", "value 3"))
+
+	// the newest savepoint with the name is used
+	require.NoError(t, txn.RollbackTo("step1"))
+	value, err := txn.Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "value 2", value)
+
+	require.NoError(t, txn.Release("step2"))
+	assert.EqualError(t, txn.RollbackTo("step2"), `savepoint "step2" not found`)
+	require.NoError(t, txn.RollbackTo("step1"))
+	value, err = txn.Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+}
+
+func TestSavepointStatementsWithinTransaction(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	_, _, err := createTestTable(dbInstance, false)
+	require.NoError(t, err)
+
+	txn, err := dbInstance.Begin()
+	require.NoError(t, err)
+	for _, query := range []string{
+		"INSERT INTO t1 VALUES (a, x, 5, 1)",
+		"SAVEPOINT step1;",
+		"INSERT INTO t1 VALUES (b, x, 5, 0)",
+		"ROLLBACK TO step1;",
+		"INSERT INTO t1 VALUES (c, x, 6, 0)",
+		"RELEASE SAVEPOINT step1;",
+	} {
+		require.NoError(t, txn.Exec(query), query)
+	}
+	assert.Error(t, txn.Exec("ROLLBACK TO step1;"))
+	require.NoError(t, txn.Commit())
+
+	rows, err := dbInstance.selectFromTable(sqlparser.SelectFromTable{
+		TableName:       "t1",
+		ColumnsRequired: []string{"*"},
+		QueryConditions: []sqlparser.QueryCondition{{ColumnName: "c2", QueryType: sqlparser.Equals, Value: "x"}},
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"a", "x", "5", "1"}, {"c", "x", "6", "0"}}, rows)
+	// the index entry of the rolled back row is undone as well
+	rows, err = dbInstance.selectFromTable(sqlparser.SelectFromTable{
+		TableName:       "t1",
+		ColumnsRequired: []string{"*"},
+		QueryConditions: []sqlparser.QueryCondition{{ColumnName: "c3", QueryType: sqlparser.Equals, Value: "5"}},
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"a", "x", "5", "1"}}, rows)
+}
+
+func TestTransactionDeleteIsSeenByItsReadsAndUndoneByRollbackTo(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	require.NoError(t, dbInstance.Put("key_1", "value"))
+	require.NoError(t, dbInstance.Put("key_2", "value"))
+
+	txn, err := dbInstance.Begin()
+	require.NoError(t, err)
+	require.NoError(t, txn.Savepoint("before_delete"))
+	require.NoError(t, txn.Delete("key_1"))
+	value, err := txn.Get("key_1")
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+	scannedKeys := []string{}
+	require.NoError(t, txn.rangeScan("key_", prefixUpperBound("key_"), func(key, _ string) error {
+		scannedKeys = append(scannedKeys, key)
+		return nil
+	}))
+	assert.Equal(t, []string{"key_2"}, scannedKeys)
+
+	require.NoError(t, txn.RollbackTo("before_delete"))
+	value, err = txn.Get("key_1")
+	require.NoError(t, err)
+	assert.Equal(t, "value", value)
+
+	require.NoError(t, txn.Delete("key_2"))
+	require.NoError(t, txn.Commit())
+	value, err = dbInstance.Get("key_1")
+	require.NoError(t, err)
+	assert.Equal(t, "value", value)
+	value, err = dbInstance.Get("key_2")
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+}
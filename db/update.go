@@ -0,0 +1,106 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	sqlparser "github.com/golang-db/sql_parser"
+)
+
+// UpdateTable runs the UPDATE query within a transaction and returns the number of rows updated.
+func (db *DB) UpdateTable(query string) (int, error) {
+	parser := sqlparser.NewParser(query)
+	input, err := parser.ParseUpdateTable()
+	if err != nil {
+		return 0, err
+	}
+	return db.updateTable(*input)
+}
+
+func (db *DB) updateTable(updateTableInput sqlparser.UpdateTable) (int, error) {
+	txn, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	rowsUpdated, err := db.updateTableInTxn(updateTableInput, txn)
+	if err != nil {
+		txn.Rollback()
+		return 0, err
+	}
+	if err := txn.Commit(); err != nil {
+		return 0, err
+	}
+	return rowsUpdated, nil
+}
+
+// reads the rows matching the query conditions within the transaction and writes every updated row with
+// its secondary index entries. the index entries of the old values are deleted, otherwise the index lookups
+// of the old values would still find the row.
+// todo: updating the primary key column needs the row to be moved to a new key.
+func (db *DB) updateTableInTxn(updateTableInput sqlparser.UpdateTable, txn *Transaction) (int, error) {
+	tableName := updateTableInput.TableName
+	table, ok := db.tableNameVsSchemaMap[tableName]
+	if !ok {
+		return 0, fmt.Errorf("table with name %q not found", tableName)
+	}
+	colPosVsValueMap := map[int]string{}
+	for _, assignment := range updateTableInput.Assignments {
+		colPos := db.getColPositionFromColName(tableName, assignment.ColumnName)
+		if colPos == -1 {
+			return 0, fmt.Errorf("column: '%s' not found", assignment.ColumnName)
+		}
+		if colPos == table.PrimaryKeyColumnPosition {
+			return 0, errors.New("updating the primary key column is not supported")
+		}
+		colPosVsValueMap[colPos] = assignment.Value
+	}
+
+	rows, err := db.selectRows(sqlparser.SelectFromTable{
+		TableName:       tableName,
+		ColumnsRequired: []string{sqlparser.SymbolStar},
+		QueryConditions: updateTableInput.QueryConditions,
+	}, txn)
+	if err != nil {
+		return 0, err
+	}
+	for _, row := range rows {
+		updatedRow := slices.Clone(row)
+		for colPos, value := range colPosVsValueMap {
+			updatedRow[colPos] = value
+		}
+		oldIndexKeys, err := db.getSecondaryIndexKeys(sqlparser.InsertIntoTable{TableName: tableName, ColumnValues: row})
+		if err != nil {
+			return 0, err
+		}
+		updatedRowInput := sqlparser.InsertIntoTable{TableName: tableName, ColumnValues: updatedRow}
+		newIndexKeys, err := db.getSecondaryIndexKeys(updatedRowInput)
+		if err != nil {
+			return 0, err
+		}
+		for _, key := range oldIndexKeys {
+			if slices.Contains(newIndexKeys, key) {
+				continue
+			}
+			if err := txn.Delete(key); err != nil {
+				return 0, err
+			}
+		}
+		key, valueSchemaBuf, err := db.serialiseInsertIntoTableInput(updatedRowInput)
+		if err != nil {
+			return 0, err
+		}
+		if err := txn.Put(key, string(valueSchemaBuf)); err != nil {
+			return 0, err
+		}
+		for _, key := range newIndexKeys {
+			if slices.Contains(oldIndexKeys, key) {
+				continue
+			}
+			if err := txn.Put(key, ""); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return len(rows), nil
+}
@@ -0,0 +1,141 @@
+package db
+
+import (
+	"testing"
+
+	sqlparser "github.com/golang-db/sql_parser"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func selectT1Rows(t *testing.T, dbInstance *DB, queryConditions ...sqlparser.QueryCondition) [][]string {
+	t.Helper()
+	rows, err := dbInstance.selectFromTable(sqlparser.SelectFromTable{
+		TableName:       "t1",
+		ColumnsRequired: []string{"*"},
+		QueryConditions: queryConditions,
+	}, nil)
+	require.NoError(t, err)
+	return rows
+}
+
+func insertT1Rows(t *testing.T, dbInstance *DB, rows ...[]string) {
+	t.Helper()
+	for _, row := range rows {
+		require.NoError(t, dbInstance.insertIntoTable(sqlparser.InsertIntoTable{TableName: "t1", ColumnValues: row}))
+	}
+}
+
+func TestUpdateRewritesTheRowAndItsIndexEntries(t *testing.T) {
+	dbInstance, config := newDBForWalCommandTest(t)
+	_, _, err := createTestTable(dbInstance, true)
+	require.NoError(t, err)
+	insertT1Rows(t, dbInstance, []string{"k1", "old", "1", "0"}, []string{"k2", "old", "2", "0"})
+
+	rowsUpdated, err := dbInstance.UpdateTable("UPDATE t1 SET c2 = new, c3 = 5 WHERE c1 = k1;")
+	require.NoError(t, err)
+	assert.Equal(t, 1, rowsUpdated)
+
+	assertRows := func(dbInstance *DB) {
+		assert.Equal(t, [][]string{{"k1", "new", "5", "0"}}, selectT1Rows(t, dbInstance,
+			sqlparser.QueryCondition{ColumnName: "c2", QueryType: sqlparser.Equals, Value: "new"}))
+		assert.Equal(t, [][]string{{"k2", "old", "2", "0"}}, selectT1Rows(t, dbInstance,
+			sqlparser.QueryCondition{ColumnName: "c2", QueryType: sqlparser.Equals, Value: "old"}))
+		assert.Empty(t, selectT1Rows(t, dbInstance,
+			sqlparser.QueryCondition{ColumnName: "c3", QueryType: sqlparser.Equals, Value: "1"}))
+		assert.Equal(t, [][]string{{"k1", "new", "5", "0"}}, selectT1Rows(t, dbInstance,
+			sqlparser.QueryCondition{ColumnName: "c3", QueryType: sqlparser.Equals, Value: "5"},
+			sqlparser.QueryCondition{ColumnName: "c4", QueryType: sqlparser.Equals, Value: "0"}))
+	}
+	assertRows(dbInstance)
+
+	// the deletes of the old index entries are replayed from the wal
+	dbInstance.Close()
+	dbInstance, err = NewDB(config)
+	require.NoError(t, err)
+	defer dbInstance.Close()
+	assertRows(dbInstance)
+}
+
+func TestUpdateWithoutConditionsUpdatesAllRows(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	_, _, err := createTestTable(dbInstance, true)
+	require.NoError(t, err)
+	insertT1Rows(t, dbInstance, []string{"k1", "a", "1", "0"}, []string{"k2", "b", "2", "0"})
+
+	rowsUpdated, err := dbInstance.UpdateTable("UPDATE t1 SET c4 = 1;")
+	require.NoError(t, err)
+	assert.Equal(t, 2, rowsUpdated)
+	assert.Equal(t, [][]string{{"k1", "a", "1", "1"}, {"k2", "b", "2", "1"}}, selectT1Rows(t, dbInstance))
+	assert.Empty(t, selectT1Rows(t, dbInstance,
+		sqlparser.QueryCondition{ColumnName: "c3", QueryType: sqlparser.Gte, Value: "1"},
+		sqlparser.QueryCondition{ColumnName: "c4", QueryType: sqlparser.Equals, Value: "0"}))
+
+	rowsUpdated, err = dbInstance.UpdateTable("UPDATE t1 SET c2 = x WHERE c3 > 5;")
+	require.NoError(t, err)
+	assert.Equal(t, 0, rowsUpdated)
+}
+
+func TestFailedUpdateWritesNothing(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	_, _, err := createTestTable(dbInstance, true)
+	require.NoError(t, err)
+	insertT1Rows(t, dbInstance, []string{"k1", "a", "1", "0"}, []string{"k2", "b", "2", "0"})
+
+	_, err = dbInstance.UpdateTable("UPDATE t1 SET c2 = x, c3 = abc;")
+	assert.Error(t, err)
+	_, err = dbInstance.UpdateTable("UPDATE t1 SET c1 = k3 WHERE c1 = k1;")
+	assert.EqualError(t, err, "updating the primary key column is not supported")
+	_, err = dbInstance.UpdateTable("UPDATE t1 SET c5 = 1;")
+	assert.EqualError(t, err, "column: 'c5' not found")
+
+	assert.Equal(t, [][]string{{"k1", "a", "1", "0"}, {"k2", "b", "2", "0"}}, selectT1Rows(t, dbInstance))
+	assert.Empty(t, selectT1Rows(t, dbInstance,
+		sqlparser.QueryCondition{ColumnName: "c2", QueryType: sqlparser.Equals, Value: "x"}))
+	assert.Empty(t, dbInstance.transactionManager.keyVsLocksAcquiredMap)
+}
+
+func TestUpdateWhoseCommitFailsReleasesItsLocksAndSnapshot(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	_, _, err := createTestTable(dbInstance, true)
+	require.NoError(t, err)
+	insertT1Rows(t, dbInstance, []string{"k1", "old", "1", "0"})
+
+	// the wal write of the commit fails
+	dbInstance.wal.Close()
+	_, err = dbInstance.UpdateTable("UPDATE t1 SET c2 = new WHERE c1 = k1;")
+	require.Error(t, err)
+	assert.Empty(t, dbInstance.transactionManager.keyVsLocksAcquiredMap)
+	assert.Empty(t, dbInstance.liveSnapshots())
+	assert.Equal(t, [][]string{{"k1", "old", "1", "0"}}, selectT1Rows(t, dbInstance))
+
+	// the same goes for the transaction of an INSERT
+	require.Error(t, dbInstance.InsertIntoTable("INSERT INTO t1 VALUES (k2, new, 2, 0)"))
+	assert.Empty(t, dbInstance.transactionManager.keyVsLocksAcquiredMap)
+	assert.Empty(t, dbInstance.liveSnapshots())
+}
+
+func TestUpdateWithinTransactionIsSeenByItsQueriesAndRolledBack(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+	_, _, err := createTestTable(dbInstance, true)
+	require.NoError(t, err)
+	insertT1Rows(t, dbInstance, []string{"k1", "a", "1", "0"})
+
+	txn, err := dbInstance.Begin()
+	require.NoError(t, err)
+	require.NoError(t, txn.Exec("UPDATE t1 SET c2 = b WHERE c1 = k1;"))
+	rows, err := txn.SelectFromTable("SELECT * FROM t1 WHERE c2 = a;")
+	require.NoError(t, err)
+	assert.Empty(t, rows)
+	rows, err = txn.SelectFromTable("SELECT * FROM t1 WHERE c2 = b;")
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"k1", "b", "1", "0"}}, rows)
+
+	txn.Rollback()
+	assert.Equal(t, [][]string{{"k1", "a", "1", "0"}}, selectT1Rows(t, dbInstance,
+		sqlparser.QueryCondition{ColumnName: "c2", QueryType: sqlparser.Equals, Value: "a"}))
+}
@@ -1,10 +1,14 @@
 package db
 
 import (
+	"fmt"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/golang-db/sstable"
+	"github.com/golang-db/wal"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -188,3 +192,69 @@ func TestDBRecoversTransactionValuesWithSpacesAndNewlines(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, "txn value\nwith newline", value)
 }
+
+func TestDBStartsAfterTornWalTailOnlyIfTolerated(t *testing.T) {
+	dbInstance, config := newDBForWalCommandTest(t)
+	closeDB := closeDBOnce(dbInstance)
+	defer closeDB()
+
+	require.NoError(t, dbInstance.Put("key", "value"))
+	segmentFilePath := fmt.Sprintf("%s.%d", config.WalFilePath, dbInstance.wal.ActiveSegmentId())
+	fileInfo, err := os.Stat(segmentFilePath)
+	require.NoError(t, err)
+	sizeBeforeTornWrite := fileInfo.Size()
+	require.NoError(t, dbInstance.Put("torn key", "torn value"))
+	segmentId := dbInstance.wal.ActiveSegmentId()
+	closeDB()
+	// a power loss in the middle of the last write
+	fileInfo, err = os.Stat(segmentFilePath)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(segmentFilePath, fileInfo.Size()-3))
+
+	_, err = NewDB(config)
+	assert.EqualError(t, err, "partial write: incomplete checksum")
+
+	config.WalRecoveryMode = wal.RecoveryTolerateTail
+	dbAfterRestart, err := NewDB(config)
+	require.NoError(t, err)
+	defer dbAfterRestart.Close()
+	value, err := dbAfterRestart.Get("key")
+	require.NoError(t, err)
+	assert.Equal(t, "value", value)
+	value, err = dbAfterRestart.Get("torn key")
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+	assert.Equal(t, map[int]wal.RecoveryReport{
+		segmentId: {DroppedTailBytes: int(fileInfo.Size() - 3 - sizeBeforeTornWrite)},
+	}, dbAfterRestart.WalRecoveryReports())
+}
+
+func TestPutAndDeleteReturnTheErrorOfTheWrite(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	largeKey := strings.Repeat("k", wal.MaxPayloadLength)
+	assert.ErrorIs(t, dbInstance.Put(largeKey, "value"), ErrWriteTooLarge)
+	assert.ErrorIs(t, dbInstance.Delete(largeKey), ErrWriteTooLarge)
+}
+
+func TestSerialiseBatchCommandRoundTrip(t *testing.T) {
+	ops := []batchOp{
+		{cmd: CmdPut, key: "batch key", value: "batch value\nwith newline"},
+		{cmd: CmdDelete, key: "deleted key"},
+		{cmd: CmdPut, key: "batch key", value: ""},
+	}
+	payload := serialiseBatchCommand(ops)
+
+	offset := 0
+	cmd, err := readLengthPrefixedString(payload, &offset)
+	require.NoError(t, err)
+	assert.Equal(t, CmdBatch, cmd)
+
+	actual, err := deserialiseBatchCommand(payload[offset:])
+	require.NoError(t, err)
+	assert.Equal(t, ops, actual)
+
+	_, err = deserialiseBatchCommand(append(payload[offset:], 'x'))
+	assert.EqualError(t, err, "malformed WAL command: unexpected trailing bytes")
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/golang-db/memtable"
+)
+
+const CmdBatch = "BATCH"
+
+// WriteBatch collects puts and deletes which DB.Write applies atomically. the zero value is an empty batch.
+type WriteBatch struct {
+	ops []batchOp
+}
+
+type batchOp struct {
+	// CmdPut or CmdDelete
+	cmd   string
+	key   string
+	value string
+}
+
+// returns the number of bytes the op takes in the BATCH record.
+func (op batchOp) encodedLength() int {
+	length := 4 + len(op.cmd) + 4 + len(op.key)
+	if op.cmd == CmdPut {
+		length += 4 + len(op.value)
+	}
+	return length
+}
+
+func (b *WriteBatch) Put(key, value string) {
+	b.ops = append(b.ops, batchOp{cmd: CmdPut, key: key, value: value})
+}
+
+func (b *WriteBatch) Delete(key string) {
+	b.ops = append(b.ops, batchOp{cmd: CmdDelete, key: key})
+}
+
+// Len returns the number of puts and deletes in the batch.
+func (b *WriteBatch) Len() int {
+	return len(b.ops)
+}
+
+// Reset empties the batch so that it can be reused.
+func (b *WriteBatch) Reset() {
+	b.ops = b.ops[:0]
+}
+
+// Write applies the writes of the batch with a single wal record, either all of them or none survive a
+// crash and the reads see either all of them or none. the writes are applied in the order they were
+// added to the batch, so the last write of a key wins.
+// no lock is taken, like with Put a transaction holding the lock of a key doesn't stop the batch from
+// writing it. the transaction then fails to write the key with WriteConflictError.
+// a batch whose wal record would be longer than wal.MaxPayloadLength is rejected with ErrWriteTooLarge.
+func (db *DB) Write(batch *WriteBatch) error {
+	if batch.Len() == 0 {
+		return nil
+	}
+	// the ops are copied, so the batch can be reused as soon as Write returns
+	ops := append([]batchOp{}, batch.ops...)
+	keys := make([]string, 0, len(ops))
+	for _, op := range ops {
+		keys = append(keys, op.key)
+	}
+	return db.write(serialiseBatchCommand(ops), keys, func(memTable *memtable.Memtable, sequence uint64) {
+		applyBatch(memTable, ops, sequence)
+	})
+}
+
+// the ops use consecutive sequence numbers starting at sequence, in the order of the batch.
+func applyBatch(memTable *memtable.Memtable, ops []batchOp, sequence uint64) {
+	for i, op := range ops {
+		if op.cmd == CmdDelete {
+			memTable.Delete(op.key, sequence+uint64(i))
+		} else {
+			memTable.Put(op.key, op.value, sequence+uint64(i))
+		}
+	}
+}
+
+// payload structure:
+// [length_of_command][command="BATCH"][number_of_ops]
+// [length_of_op][op="PUT"][key_length][key][value_length][value]
+// [length_of_op][op="DELETE"][key_length][key]...
+func serialiseBatchCommand(ops []batchOp) []byte {
+	buf := []byte{}
+	buf = appendLengthPrefixedString(buf, CmdBatch)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(ops)))
+	for _, op := range ops {
+		buf = appendLengthPrefixedString(buf, op.cmd)
+		buf = appendLengthPrefixedString(buf, op.key)
+		if op.cmd == CmdPut {
+			buf = appendLengthPrefixedString(buf, op.value)
+		}
+	}
+	return buf
+}
+
+// [number_of_ops][length_of_op][op][key_length][key]...
+func deserialiseBatchCommand(buf []byte) ([]batchOp, error) {
+	offset := 0
+	numOps, err := readUint32(buf, &offset)
+	if err != nil {
+		return nil, err
+	}
+	ops := []batchOp{}
+	for i := 0; i < int(numOps); i++ {
+		op := batchOp{}
+		if op.cmd, err = readLengthPrefixedString(buf, &offset); err != nil {
+			return nil, err
+		}
+		if op.cmd != CmdPut && op.cmd != CmdDelete {
+			return nil, fmt.Errorf("malformed WAL command: unknown batch op %q", op.cmd)
+		}
+		if op.key, err = readLengthPrefixedString(buf, &offset); err != nil {
+			return nil, err
+		}
+		if op.cmd == CmdPut {
+			if op.value, err = readLengthPrefixedString(buf, &offset); err != nil {
+				return nil, err
+			}
+		}
+		ops = append(ops, op)
+	}
+	if offset != len(buf) {
+		return nil, errors.New("malformed WAL command: unexpected trailing bytes")
+	}
+	return ops, nil
+}
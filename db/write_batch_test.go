@@ -0,0 +1,133 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/golang-db/wal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteAppliesBatchInOrderAndSurvivesRestart(t *testing.T) {
+	dbInstance, config := newDBForWalCommandTest(t)
+	closeDB := closeDBOnce(dbInstance)
+	defer closeDB()
+	require.NoError(t, dbInstance.Put("deleted_key", "value"))
+
+	batch := &WriteBatch{}
+	for i := 0; i < 100; i++ {
+		batch.Put(fmt.Sprintf("key_%03d", i), fmt.Sprintf("value_%d", i))
+	}
+	batch.Delete("deleted_key")
+	batch.Put("key_000", "overwritten in the same batch")
+	lastSequence := dbInstance.lastSequence.Load()
+	require.NoError(t, dbInstance.Write(batch))
+	// the batch can be reused once it is written
+	batch.Reset()
+	batch.Put("key_001", "written by the next batch")
+
+	assertBatchApplied := func(dbInstance *DB) {
+		for key, expected := range map[string]string{
+			"key_000":     "overwritten in the same batch",
+			"key_001":     "value_1",
+			"key_099":     "value_99",
+			"deleted_key": "",
+		} {
+			value, err := dbInstance.Get(key)
+			require.NoError(t, err)
+			assert.Equal(t, expected, value, key)
+		}
+	}
+	assertBatchApplied(dbInstance)
+	assert.Equal(t, lastSequence+102, dbInstance.lastSequence.Load())
+	assert.Empty(t, dbInstance.transactionManager.keyVsLocksAcquiredMap)
+
+	closeDB()
+	dbAfterRestart, err := NewDB(config)
+	require.NoError(t, err)
+	defer dbAfterRestart.Close()
+	assertBatchApplied(dbAfterRestart)
+	assert.Equal(t, lastSequence+102, dbAfterRestart.lastSequence.Load())
+}
+
+func TestWriteOfEmptyBatchWritesNothing(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	lastSequence := dbInstance.lastSequence.Load()
+	require.NoError(t, dbInstance.Write(&WriteBatch{}))
+	assert.Equal(t, lastSequence, dbInstance.lastSequence.Load())
+}
+
+func TestTransactionCantWriteKeyWrittenByBatchAfterItStarted(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	txn, err := dbInstance.Begin()
+	require.NoError(t, err)
+	defer txn.Rollback()
+	batch := &WriteBatch{}
+	batch.Put("key", "value by batch")
+	require.NoError(t, dbInstance.Write(batch))
+
+	assert.EqualError(t, txn.Put("key", "value by transaction"), WriteConflictError)
+}
+
+// returns a batch with a single put whose wal record is recordLength bytes long.
+func newBatchWithRecordLength(recordLength int) *WriteBatch {
+	batch := &WriteBatch{}
+	batch.Put("large_key", "")
+	overhead := len(serialiseSequencedCommand(0, serialiseBatchCommand(batch.ops)))
+	batch.Reset()
+	batch.Put("large_key", strings.Repeat("v", recordLength-overhead))
+	return batch
+}
+
+func TestWriteRejectsBatchLongerThanTheWalCanReplay(t *testing.T) {
+	dbInstance, config := newDBForWalCommandTest(t)
+	closeDB := closeDBOnce(dbInstance)
+	defer closeDB()
+	require.NoError(t, dbInstance.Put("key_before", "value"))
+
+	err := dbInstance.Write(newBatchWithRecordLength(wal.MaxPayloadLength + 1))
+	assert.ErrorIs(t, err, ErrWriteTooLarge)
+	value, err := dbInstance.Get("large_key")
+	require.NoError(t, err)
+	assert.Empty(t, value)
+	largestBatch := newBatchWithRecordLength(wal.MaxPayloadLength)
+	largestValue := largestBatch.ops[0].value
+	require.NoError(t, dbInstance.Write(largestBatch))
+	require.NoError(t, dbInstance.Put("key_after", "value"))
+
+	// every acknowledged write is replayed, also in strict recovery mode
+	closeDB()
+	dbAfterRestart, err := NewDB(config)
+	require.NoError(t, err)
+	defer dbAfterRestart.Close()
+	for _, key := range []string{"key_before", "key_after"} {
+		value, err := dbAfterRestart.Get(key)
+		require.NoError(t, err)
+		assert.Equal(t, "value", value, key)
+	}
+	value, err = dbAfterRestart.Get("large_key")
+	require.NoError(t, err)
+	assert.Equal(t, largestValue, value)
+}
+
+func TestCommitOfTransactionLongerThanTheWalCanReplayRollsItBack(t *testing.T) {
+	dbInstance, _ := newDBForWalCommandTest(t)
+	defer dbInstance.Close()
+
+	txn, err := dbInstance.Begin()
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		require.NoError(t, txn.Put(fmt.Sprintf("key_%d", i), strings.Repeat("v", wal.MaxPayloadLength/2)))
+	}
+	assert.ErrorIs(t, txn.Commit(), ErrWriteTooLarge)
+	assert.Empty(t, dbInstance.transactionManager.keyVsLocksAcquiredMap)
+	value, err := dbInstance.Get("key_0")
+	require.NoError(t, err)
+	assert.Empty(t, value)
+}
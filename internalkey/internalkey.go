@@ -0,0 +1,65 @@
+// Package internalkey encodes a user key along with the sequence number of the write which produced it.
+// every write of a key is a separate version, and the encoded keys order the versions by the user key
+// ascending and then by the sequence number descending, so the newest version of a key comes first.
+package internalkey
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"strings"
+)
+
+// MaxSequence is greater than any sequence number assigned to a write. Make(key, MaxSequence) sorts
+// before every version of the key, hence it is used to seek to the newest version of a key.
+const MaxSequence uint64 = math.MaxUint64
+
+const (
+	escapeByte = 0xff
+	// the separator sorts before an escaped 0x00 byte, so a user key sorts before the longer user keys
+	// it is a prefix of.
+	separator      = "\x00\x01"
+	sequenceLength = 8
+	trailerLength  = len(separator) + sequenceLength
+)
+
+var ErrMalformed = errors.New("malformed internal key")
+
+// Make encodes the key as [escaped user key][0x00 0x01][^sequence as 8 big endian bytes].
+// every 0x00 byte of the user key is escaped as 0x00 0xff.
+func Make(userKey string, sequence uint64) string {
+	buf := make([]byte, 0, len(userKey)+trailerLength)
+	for i := 0; i < len(userKey); i++ {
+		buf = append(buf, userKey[i])
+		if userKey[i] == 0x00 {
+			buf = append(buf, escapeByte)
+		}
+	}
+	buf = append(buf, separator...)
+	// the sequence is inverted so that newer versions sort first
+	buf = binary.BigEndian.AppendUint64(buf, ^sequence)
+	return string(buf)
+}
+
+// Parse returns the user key and the sequence number encoded by Make.
+func Parse(key string) (userKey string, sequence uint64, err error) {
+	if len(key) < trailerLength || key[len(key)-trailerLength:len(key)-sequenceLength] != separator {
+		return "", 0, ErrMalformed
+	}
+	escapedUserKey := key[:len(key)-trailerLength]
+	sequence = ^binary.BigEndian.Uint64([]byte(key[len(key)-sequenceLength:]))
+	if strings.IndexByte(escapedUserKey, 0x00) == -1 {
+		return escapedUserKey, sequence, nil
+	}
+	buf := make([]byte, 0, len(escapedUserKey))
+	for i := 0; i < len(escapedUserKey); i++ {
+		buf = append(buf, escapedUserKey[i])
+		if escapedUserKey[i] == 0x00 {
+			if i+1 == len(escapedUserKey) || escapedUserKey[i+1] != escapeByte {
+				return "", 0, ErrMalformed
+			}
+			i++
+		}
+	}
+	return string(buf), sequence, nil
+}
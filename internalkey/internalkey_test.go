@@ -0,0 +1,42 @@
+package internalkey
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMakeAndParseRoundTrip(t *testing.T) {
+	for _, userKey := range []string{"", "key", "a\x00b", "\x00", "a\x00\x01", "\xff\x00\xff"} {
+		for _, sequence := range []uint64{0, 1, 42, MaxSequence} {
+			parsedUserKey, parsedSequence, err := Parse(Make(userKey, sequence))
+			require.NoError(t, err)
+			assert.Equal(t, userKey, parsedUserKey)
+			assert.Equal(t, sequence, parsedSequence)
+		}
+	}
+}
+
+func TestOrderIsUserKeyAscendingThenSequenceDescending(t *testing.T) {
+	expected := []string{
+		Make("a", 9), Make("a", 2),
+		Make("a\x00", 5),
+		Make("a\x00b", 1),
+		Make("a\x01", 7),
+		Make("ab", 3),
+		Make("b", MaxSequence), Make("b", 0),
+	}
+	keys := append([]string{}, expected...)
+	sort.Sort(sort.Reverse(sort.StringSlice(keys)))
+	sort.Strings(keys)
+	assert.Equal(t, expected, keys)
+}
+
+func TestParseRejectsMalformedKeys(t *testing.T) {
+	for _, key := range []string{"", "key", "key\x00\x02\x00\x00\x00\x00\x00\x00\x00\x00", "a\x00" + Make("b", 1)[1:]} {
+		_, _, err := Parse(key)
+		assert.ErrorIs(t, err, ErrMalformed, "%q", key)
+	}
+}
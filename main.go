@@ -6,6 +6,8 @@ import (
 	"log"
 	"os"
 	"strings"
+	"time"
+	"unicode/utf8"
 
 	"errors"
 
@@ -46,6 +48,13 @@ func main() {
 			} else {
 				fmt.Println("PUT operation performed successfully")
 			}
+		case "DEL":
+			err := cmdDelete(db, args)
+			if err != nil {
+				fmt.Printf("Error while performing DEL operation: '%s'\n", err.Error())
+			} else {
+				fmt.Println("DEL operation performed successfully")
+			}
 		case "CREATE":
 			if len(args) > 1 && args[1] == "TABLE" {
 				if err := cmdCreateTable(db, line); err != nil {
@@ -63,14 +72,13 @@ func main() {
 				fmt.Println("INSERT INTO performed successfully")
 			}
 		case "SELECT":
-			if len(args) > 1 && args[1] == "TABLE" {
-				if err := cmdSelectFromTable(db, line); err != nil {
-					fmt.Printf("Error while running SELECT FROM command: '%s'\n", err.Error())
-				} else {
-					fmt.Println("SELECT performed successfully")
-				}
+			start := time.Now()
+			resultSet, err := cmdSelectFromTable(db, line)
+			if err != nil {
+				fmt.Printf("Error while running SELECT command: '%s'\n", err.Error())
 			} else {
-				fmt.Println(CommandNotSupported)
+				fmt.Print(formatResultSet(resultSet))
+				fmt.Printf("Time: %s\n", time.Since(start).Round(time.Microsecond))
 			}
 
 		case "EXIT":
@@ -111,6 +119,16 @@ func cmdPut(db *db.DB, args []string) error {
 	return nil
 }
 
+func cmdDelete(db *db.DB, args []string) error {
+	if len(args) != 2 {
+		return errors.New("Expected exactly 1 argument for DEL command\n")
+	}
+	if err := db.Delete(args[1]); err != nil {
+		return fmt.Errorf("Something went wrong: %s", err.Error())
+	}
+	return nil
+}
+
 func cmdCreateTable(db *db.DB, query string) error {
 	return db.CreateTable(query)
 }
@@ -119,7 +137,50 @@ func cmdInsertIntoTable(db *db.DB, query string) error {
 	return db.InsertIntoTable(query)
 }
 
-func cmdSelectFromTable(db *db.DB, query string) error {
-	// return db.SelectFromTable(query)
-	return errors.New("yet to be implemented")
+func cmdSelectFromTable(db *db.DB, query string) (*db.ResultSet, error) {
+	return db.Query(query)
+}
+
+// renders the rows as a table with a header of the column names, followed by the number of rows:
+//
+//	 id | name
+//	----+-------
+//	 1  | alice
+//	(1 row)
+func formatResultSet(resultSet *db.ResultSet) string {
+	widths := make([]int, len(resultSet.Columns))
+	for i, col := range resultSet.Columns {
+		widths[i] = utf8.RuneCountInString(col.Name)
+	}
+	for _, row := range resultSet.Rows {
+		for i, value := range row {
+			widths[i] = max(widths[i], utf8.RuneCountInString(value))
+		}
+	}
+	formatLine := func(values []string) string {
+		cells := make([]string, len(values))
+		for i, value := range values {
+			cells[i] = " " + value + strings.Repeat(" ", widths[i]-utf8.RuneCountInString(value)) + " "
+		}
+		return strings.TrimRight(strings.Join(cells, "|"), " ") + "\n"
+	}
+
+	var sb strings.Builder
+	columnNames := []string{}
+	separators := []string{}
+	for i, col := range resultSet.Columns {
+		columnNames = append(columnNames, col.Name)
+		separators = append(separators, strings.Repeat("-", widths[i]+2))
+	}
+	sb.WriteString(formatLine(columnNames))
+	sb.WriteString(strings.Join(separators, "+") + "\n")
+	for _, row := range resultSet.Rows {
+		sb.WriteString(formatLine(row))
+	}
+	if len(resultSet.Rows) == 1 {
+		sb.WriteString("(1 row)\n")
+	} else {
+		sb.WriteString(fmt.Sprintf("(%d rows)\n", len(resultSet.Rows)))
+	}
+	return sb.String()
 }
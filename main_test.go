@@ -0,0 +1,38 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/golang-db/db"
+	sqlparser "github.com/golang-db/sql_parser"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatResultSetAlignsTheColumns(t *testing.T) {
+	resultSet := &db.ResultSet{
+		Columns: []db.ResultColumn{
+			{Name: "id", DataType: sqlparser.Int},
+			{Name: "name", DataType: sqlparser.String},
+		},
+		Rows: [][]string{{"1", "alice"}, {"100", "bo"}},
+	}
+	assert.Equal(t, ""+
+		" id  | name\n"+
+		"-----+-------\n"+
+		" 1   | alice\n"+
+		" 100 | bo\n"+
+		"(2 rows)\n", formatResultSet(resultSet))
+
+	resultSet.Rows = resultSet.Rows[:1]
+	assert.Equal(t, ""+
+		" id | name\n"+
+		"----+-------\n"+
+		" 1  | alice\n"+
+		"(1 row)\n", formatResultSet(resultSet))
+
+	resultSet.Rows = nil
+	assert.Equal(t, ""+
+		" id | name\n"+
+		"----+------\n"+
+		"(0 rows)\n", formatResultSet(resultSet))
+}
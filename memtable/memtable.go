@@ -1,8 +1,7 @@
 package memtable
 
 import (
-	"strings"
-
+	"github.com/golang-db/internalkey"
 	"github.com/google/btree"
 )
 
@@ -13,15 +12,29 @@ const (
 type Memtable struct {
 	tree *btree.BTree
 	size int
+	// sequence number of the newest write in the memtable
+	lastSequence uint64
 }
 
+// Entry is a single version of a key. every write adds a new version instead of replacing the older one,
+// so that a read at an older sequence number still finds the version which was visible to it.
 type Entry struct {
 	Key   string
 	Value string
+	// Tombstone marks the key as deleted. A tombstone hides older values of the key
+	// present in the sstable files until compaction drops it.
+	Tombstone bool
+	// Sequence is the sequence number of the write which produced this version.
+	Sequence uint64
 }
 
+// entries are ordered by key and then from the newest version to the oldest one, same as the internal keys.
 func (e *Entry) Less(than btree.Item) bool {
-	return e.Key < than.(*Entry).Key
+	other := than.(*Entry)
+	if e.Key != other.Key {
+		return e.Key < other.Key
+	}
+	return e.Sequence > other.Sequence
 }
 
 func NewMemtable() Memtable {
@@ -30,50 +43,56 @@ func NewMemtable() Memtable {
 	}
 }
 
-func (m *Memtable) Get(key string) (string, bool) {
-	item := m.tree.Get(&Entry{Key: key})
-	if item == nil {
-		return "", false
+// Get returns the newest version of the key written at or before the sequence. The returned entry can
+// be a tombstone, in which case the caller should treat the key as deleted instead of searching older data.
+func (m *Memtable) Get(key string, sequence uint64) (Entry, bool) {
+	var found *Entry
+	m.tree.AscendGreaterOrEqual(&Entry{Key: key, Sequence: sequence}, func(item btree.Item) bool {
+		if e := item.(*Entry); e.Key == key {
+			found = e
+		}
+		return false
+	})
+	if found == nil {
+		return Entry{}, false
 	}
-	return item.(*Entry).Value, true
+	return *found, true
 }
 
-// Iterate loops through each of the key, value pair in the memTable
-func (m *Memtable) Iterate(fn func(key, value string)) {
+// Iterate loops through every version in the memTable in the internal key order.
+// tombstones are also passed so that they can be persisted in the sstable.
+func (m *Memtable) Iterate(fn func(key, value string, tombstone bool)) {
 	m.tree.Ascend(func(item btree.Item) bool {
 		e := item.(*Entry)
-		fn(e.Key, e.Value)
+		fn(internalkey.Make(e.Key, e.Sequence), e.Value, e.Tombstone)
 		return true
 	})
 }
 
-func (m *Memtable) Put(key, value string) {
-	entry := Entry{
-		Key:   key,
-		Value: value,
-	}
-	if old := m.tree.ReplaceOrInsert(&entry); old != nil {
-		m.size += (len(value))
-		m.size -= (len(old.(*Entry).Value))
-	} else {
-		m.size += (len(key) + len(value))
-	}
+func (m *Memtable) Put(key, value string, sequence uint64) {
+	m.insert(&Entry{
+		Key:      key,
+		Value:    value,
+		Sequence: sequence,
+	})
 }
 
-// given the prefix key, PrefixScan returns the serialised key
-// and value in a map for all keys which match that prefix in the memtable.
-func (m *Memtable) PrefixScan(prefixKey string) map[string]string {
-	tableMap := map[string]string{}
-	m.tree.AscendGreaterOrEqual(&Entry{Key: prefixKey}, func(item btree.Item) bool {
-		e := item.(*Entry)
-		key := e.Key
-		if !strings.HasPrefix(key, prefixKey) {
-			return false
-		}
-		tableMap[key] = e.Value
-		return true
+// Delete stores a tombstone for the key.
+func (m *Memtable) Delete(key string, sequence uint64) {
+	m.insert(&Entry{
+		Key:       key,
+		Tombstone: true,
+		Sequence:  sequence,
 	})
-	return tableMap
+}
+
+func (m *Memtable) insert(entry *Entry) {
+	// a sequence number is never reused, hence the older versions are kept along with the new one
+	if old := m.tree.ReplaceOrInsert(entry); old != nil {
+		m.size -= (len(old.(*Entry).Key) + len(old.(*Entry).Value))
+	}
+	m.size += (len(entry.Key) + len(entry.Value))
+	m.lastSequence = max(m.lastSequence, entry.Sequence)
 }
 
 func (m *Memtable) ShouldFlush() bool {
@@ -84,7 +103,83 @@ func (m *Memtable) GetSize() int {
 	return m.size
 }
 
+// LastSequence returns the sequence number of the newest write in the memtable, 0 if it is empty.
+func (m *Memtable) LastSequence() uint64 {
+	return m.lastSequence
+}
+
 func (m *Memtable) Clear() {
 	m.tree.Clear(false)
 	m.size = 0
+	m.lastSequence = 0
+}
+
+// Iterator iterates over the versions of a point-in-time copy of the memtable in the internal key order.
+// tombstones are also returned so that the caller can hide older values.
+type Iterator struct {
+	tree    *btree.BTree
+	current *Entry
+}
+
+// NewIterator returns an iterator over a lazy copy-on-write clone of the memtable. Writes to the
+// memtable after this call are not visible to the iterator.
+// Clone must not be called concurrently, hence the caller should hold an exclusive lock.
+func (m *Memtable) NewIterator() *Iterator {
+	return &Iterator{tree: m.tree.Clone()}
+}
+
+// Seek positions the iterator at the first version with internal key >= the given internal key.
+// the iterator is exhausted if the key is not an internal key.
+func (it *Iterator) Seek(key string) {
+	it.current = nil
+	userKey, sequence, err := internalkey.Parse(key)
+	if err != nil {
+		return
+	}
+	it.ascendFrom(&Entry{Key: userKey, Sequence: sequence}, false)
+}
+
+// positions the iterator at the first entry >= pivot. the pivot itself is skipped if skipPivot is set.
+func (it *Iterator) ascendFrom(pivot *Entry, skipPivot bool) {
+	it.current = nil
+	it.tree.AscendGreaterOrEqual(pivot, func(item btree.Item) bool {
+		e := item.(*Entry)
+		if skipPivot && e.Key == pivot.Key && e.Sequence == pivot.Sequence {
+			return true
+		}
+		it.current = e
+		return false
+	})
+}
+
+func (it *Iterator) Valid() bool {
+	return it.current != nil
+}
+
+func (it *Iterator) Next() {
+	it.ascendFrom(it.current, true)
+}
+
+// Key returns the internal key of the current version.
+func (it *Iterator) Key() string {
+	return internalkey.Make(it.current.Key, it.current.Sequence)
+}
+
+func (it *Iterator) Value() string {
+	return it.current.Value
+}
+
+func (it *Iterator) Tombstone() bool {
+	return it.current.Tombstone
+}
+
+// Error always returns nil as the memtable iterator doesn't do any IO.
+func (it *Iterator) Error() error {
+	return nil
+}
+
+func (it *Iterator) Close() error {
+	it.tree = nil
+	it.current = nil
+	return nil
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"fmt"
+	"path/filepath"
 	"testing"
 
 	"github.com/golang-db/db"
@@ -73,3 +74,31 @@ func testGetInBulk(db *db.DB) {
 		db.Get(fmt.Sprintf("key_%d", i))
 	}
 }
+
+// lookups for keys which were never written. without the bloom filter, every file whose index
+// range covers the key costs a data block read.
+func benchmarkMissingKeyLookups(b *testing.B, skipBloomFilter bool) {
+	dir := b.TempDir()
+	db, _ := db.NewDB(db.Config{
+		SsTableConfig: sstable.Config{
+			DataFilesDirectory: filepath.Join(dir, "sstable"),
+			SkipBloomFilter:    skipBloomFilter,
+		},
+		WalFilePath: filepath.Join(dir, "wal.log"),
+	})
+	defer db.Close()
+	buildTestData(db)
+	for b.Loop() {
+		for i := 1000; i < 1400; i++ {
+			db.Get(fmt.Sprintf("key_%d", i))
+		}
+	}
+}
+
+func BenchmarkSSTableMissingKeysWithBloomFilter(b *testing.B) {
+	benchmarkMissingKeyLookups(b, false)
+}
+
+func BenchmarkSSTableMissingKeysWithoutBloomFilter(b *testing.B) {
+	benchmarkMissingKeyLookups(b, true)
+}
@@ -37,10 +37,40 @@ type QueryCondition struct {
 	Value      string
 }
 
+type OrderByColumn struct {
+	ColumnName string
+	Descending bool
+}
+
 type SelectFromTable struct {
 	TableName       string
 	ColumnsRequired []string
 	QueryConditions []QueryCondition
+	// the rows are sorted by the first column, then by the second one and so on
+	OrderBy []OrderByColumn
+	// the maximum number of rows returned, nil if there is no LIMIT
+	Limit *int
+	// the number of rows skipped before the returned ones
+	Offset int
+}
+
+type ColumnAssignment struct {
+	ColumnName string
+	Value      string
+}
+
+// UpdateTable sets the columns of the assignments in the rows matching all the query conditions.
+// all the rows are updated if there is no condition.
+type UpdateTable struct {
+	TableName       string
+	Assignments     []ColumnAssignment
+	QueryConditions []QueryCondition
+}
+
+// DeleteFromTable deletes the rows matching all the query conditions, all the rows if there is no condition.
+type DeleteFromTable struct {
+	TableName       string
+	QueryConditions []QueryCondition
 }
 
 type DataType uint8
@@ -55,3 +85,16 @@ type Column struct {
 	ColumnName string
 	DataType   DataType
 }
+
+// Savepoint marks the state of the writes of a transaction, which ROLLBACK TO can restore.
+type Savepoint struct {
+	Name string
+}
+
+type RollbackToSavepoint struct {
+	Name string
+}
+
+type ReleaseSavepoint struct {
+	Name string
+}
@@ -3,6 +3,7 @@ package sqlparser
 import (
 	"errors"
 	"fmt"
+	"strconv"
 )
 
 const (
@@ -17,6 +18,19 @@ const (
 	KeywordAnd               = "AND"
 	KeywordPrimary           = "PRIMARY"
 	KeywordKey               = "KEY"
+	KeywordSavepoint         = "SAVEPOINT"
+	KeywordRollback          = "ROLLBACK"
+	KeywordTo                = "TO"
+	KeywordRelease           = "RELEASE"
+	KeywordUpdate            = "UPDATE"
+	KeywordSet               = "SET"
+	KeywordDelete            = "DELETE"
+	KeywordOrder             = "ORDER"
+	KeywordBy                = "BY"
+	KeywordAsc               = "ASC"
+	KeywordDesc              = "DESC"
+	KeywordLimit             = "LIMIT"
+	KeywordOffset            = "OFFSET"
 	SymbolOpenRoundBracket   = "("
 	SymbolClosedRoundBracket = ")"
 	SymbolComma              = ","
@@ -28,6 +42,8 @@ const (
 	IdentifierColumnName     = "column name"
 	IdentifierQueryCondition = "query condition"
 	IdentifierQueryValue     = "query value"
+	IdentifierSavepointName  = "savepoint name"
+	IdentifierRowCount       = "row count"
 )
 
 const (
@@ -266,7 +282,9 @@ func (p *Parser) parseQueryConditionsFromSelectQuery() ([]QueryCondition, error)
 		return nil, err
 	}
 	queryConditions := []QueryCondition{}
-	for i := 0; p.currentToken.Value != SymbolSemiColon; i++ {
+	// the conditions end with the query or with the clauses following WHERE in a SELECT query
+	for i := 0; p.currentToken.Value != SymbolSemiColon && p.currentToken.Value != KeywordOrder &&
+		p.currentToken.Value != KeywordLimit && p.currentToken.Value != KeywordOffset; i++ {
 		if i > 0 {
 			if err := p.consume(KEYWORD, KeywordAnd, ""); err != nil {
 				return nil, err
@@ -296,8 +314,6 @@ func (p *Parser) parseQueryConditionsFromSelectQuery() ([]QueryCondition, error)
 			QueryType:  QueryType(queryType),
 			Value:      value,
 		})
-
-		fmt.Printf("queryConditions3333: %+v\n", queryConditions)
 	}
 	if len(queryConditions) == 0 {
 		return nil, errors.New("expected atleast 1 condition within WHERE clause of SELECT query")
@@ -305,7 +321,60 @@ func (p *Parser) parseQueryConditionsFromSelectQuery() ([]QueryCondition, error)
 	return queryConditions, nil
 }
 
+// ORDER BY <column_name> [ASC|DESC] [, <column_name> [ASC|DESC]]...
+func (p *Parser) parseOrderBy() ([]OrderByColumn, error) {
+	if err := p.consume(KEYWORD, KeywordOrder, ""); err != nil {
+		return nil, err
+	}
+	if err := p.consume(KEYWORD, KeywordBy, ""); err != nil {
+		return nil, err
+	}
+	orderBy := []OrderByColumn{}
+	for i := 0; i == 0 || p.currentToken.Value == SymbolComma; i++ {
+		if i > 0 {
+			if err := p.consume(SYMBOL, SymbolComma, ""); err != nil {
+				return nil, err
+			}
+		}
+		columnName := p.currentToken.Value
+		if err := p.consume(IDENTIFIER, "", IdentifierColumnName); err != nil {
+			return nil, err
+		}
+		descending := false
+		switch p.currentToken.Value {
+		case KeywordAsc:
+			if err := p.consume(KEYWORD, KeywordAsc, ""); err != nil {
+				return nil, err
+			}
+		case KeywordDesc:
+			if err := p.consume(KEYWORD, KeywordDesc, ""); err != nil {
+				return nil, err
+			}
+			descending = true
+		}
+		orderBy = append(orderBy, OrderByColumn{
+			ColumnName: columnName,
+			Descending: descending,
+		})
+	}
+	return orderBy, nil
+}
+
+// the row count of LIMIT and OFFSET
+func (p *Parser) parseRowCount() (int, error) {
+	value := p.currentToken.Value
+	if err := p.consume(IDENTIFIER, "", IdentifierRowCount); err != nil {
+		return 0, err
+	}
+	rowCount, err := strconv.Atoi(value)
+	if err != nil || rowCount < 0 {
+		return 0, fmt.Errorf("expected a non-negative row count, got %q", value)
+	}
+	return rowCount, nil
+}
+
 // todo: add a validation before calling Parser. The last character should be ;
+// SELECT <columns> FROM <table_name> [WHERE <conditions>] [ORDER BY <columns>] [LIMIT <count>] [OFFSET <count>];
 func (p *Parser) ParseSelectFromTable() (*SelectFromTable, error) {
 	if err := p.consume(KEYWORD, KeywordSelect, ""); err != nil {
 		return nil, err
@@ -328,6 +397,34 @@ func (p *Parser) ParseSelectFromTable() (*SelectFromTable, error) {
 			return nil, err
 		}
 	}
+	var orderBy []OrderByColumn
+	if p.currentToken.Value == KeywordOrder {
+		orderBy, err = p.parseOrderBy()
+		if err != nil {
+			return nil, err
+		}
+	}
+	var limit *int
+	if p.currentToken.Value == KeywordLimit {
+		if err := p.consume(KEYWORD, KeywordLimit, ""); err != nil {
+			return nil, err
+		}
+		rowCount, err := p.parseRowCount()
+		if err != nil {
+			return nil, err
+		}
+		limit = &rowCount
+	}
+	offset := 0
+	if p.currentToken.Value == KeywordOffset {
+		if err := p.consume(KEYWORD, KeywordOffset, ""); err != nil {
+			return nil, err
+		}
+		offset, err = p.parseRowCount()
+		if err != nil {
+			return nil, err
+		}
+	}
 	if err := p.consume(SYMBOL, SymbolSemiColon, ""); err != nil {
 		return nil, err
 	}
@@ -336,5 +433,158 @@ func (p *Parser) ParseSelectFromTable() (*SelectFromTable, error) {
 		TableName:       tableName,
 		ColumnsRequired: columnsRequired,
 		QueryConditions: queryConditions,
+		OrderBy:         orderBy,
+		Limit:           limit,
+		Offset:          offset,
+	}, nil
+}
+
+// UPDATE <table_name> SET <column_name> = <value> [, <column_name> = <value>]... [WHERE <conditions>];
+func (p *Parser) ParseUpdateTable() (*UpdateTable, error) {
+	if err := p.consume(KEYWORD, KeywordUpdate, ""); err != nil {
+		return nil, err
+	}
+	tableName := p.currentToken.Value
+	if err := p.consume(IDENTIFIER, "", ""); err != nil {
+		return nil, err
+	}
+	if err := p.consume(KEYWORD, KeywordSet, ""); err != nil {
+		return nil, err
+	}
+	assignments := []ColumnAssignment{}
+	for i := 0; i == 0 || p.currentToken.Value == SymbolComma; i++ {
+		if i > 0 {
+			if err := p.consume(SYMBOL, SymbolComma, ""); err != nil {
+				return nil, err
+			}
+		}
+		columnName := p.currentToken.Value
+		if err := p.consume(IDENTIFIER, "", IdentifierColumnName); err != nil {
+			return nil, err
+		}
+		if err := p.consume(CONDITIONAL_OPERATOR, Equals, ""); err != nil {
+			return nil, err
+		}
+		value := p.currentToken.Value
+		if err := p.consume(IDENTIFIER, "", IdentifierQueryValue); err != nil {
+			return nil, err
+		}
+		assignments = append(assignments, ColumnAssignment{
+			ColumnName: columnName,
+			Value:      value,
+		})
+	}
+	var queryConditions []QueryCondition
+	if p.currentToken.Value == KeywordWhere {
+		var err error
+		queryConditions, err = p.parseQueryConditionsFromSelectQuery()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := p.consume(SYMBOL, SymbolSemiColon, ""); err != nil {
+		return nil, err
+	}
+
+	return &UpdateTable{
+		TableName:       tableName,
+		Assignments:     assignments,
+		QueryConditions: queryConditions,
+	}, nil
+}
+
+// DELETE FROM <table_name> [WHERE <conditions>];
+func (p *Parser) ParseDeleteFromTable() (*DeleteFromTable, error) {
+	if err := p.consume(KEYWORD, KeywordDelete, ""); err != nil {
+		return nil, err
+	}
+	if err := p.consume(KEYWORD, KeywordFrom, ""); err != nil {
+		return nil, err
+	}
+	tableName := p.currentToken.Value
+	if err := p.consume(IDENTIFIER, "", ""); err != nil {
+		return nil, err
+	}
+	var queryConditions []QueryCondition
+	if p.currentToken.Value == KeywordWhere {
+		var err error
+		queryConditions, err = p.parseQueryConditionsFromSelectQuery()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if err := p.consume(SYMBOL, SymbolSemiColon, ""); err != nil {
+		return nil, err
+	}
+
+	return &DeleteFromTable{
+		TableName:       tableName,
+		QueryConditions: queryConditions,
 	}, nil
 }
+
+// savepoint name followed by an optional semicolon
+func (p *Parser) parseSavepointName() (string, error) {
+	name := p.currentToken.Value
+	if err := p.consume(IDENTIFIER, "", IdentifierSavepointName); err != nil {
+		return "", err
+	}
+	if p.currentToken.Value == SymbolSemiColon {
+		if err := p.consume(SYMBOL, SymbolSemiColon, ""); err != nil {
+			return "", err
+		}
+	}
+	if p.currentToken.Type != EOF {
+		return "", fmt.Errorf("syntax error: expected EOF, got %s %q", p.currentToken.Type, p.currentToken.Value)
+	}
+	return name, nil
+}
+
+// SAVEPOINT <name>;
+func (p *Parser) ParseSavepoint() (*Savepoint, error) {
+	if err := p.consume(KEYWORD, KeywordSavepoint, ""); err != nil {
+		return nil, err
+	}
+	name, err := p.parseSavepointName()
+	if err != nil {
+		return nil, err
+	}
+	return &Savepoint{Name: name}, nil
+}
+
+// ROLLBACK TO [SAVEPOINT] <name>;
+func (p *Parser) ParseRollbackToSavepoint() (*RollbackToSavepoint, error) {
+	if err := p.consume(KEYWORD, KeywordRollback, ""); err != nil {
+		return nil, err
+	}
+	if err := p.consume(KEYWORD, KeywordTo, ""); err != nil {
+		return nil, err
+	}
+	if p.currentToken.Value == KeywordSavepoint {
+		if err := p.consume(KEYWORD, KeywordSavepoint, ""); err != nil {
+			return nil, err
+		}
+	}
+	name, err := p.parseSavepointName()
+	if err != nil {
+		return nil, err
+	}
+	return &RollbackToSavepoint{Name: name}, nil
+}
+
+// RELEASE [SAVEPOINT] <name>;
+func (p *Parser) ParseReleaseSavepoint() (*ReleaseSavepoint, error) {
+	if err := p.consume(KEYWORD, KeywordRelease, ""); err != nil {
+		return nil, err
+	}
+	if p.currentToken.Value == KeywordSavepoint {
+		if err := p.consume(KEYWORD, KeywordSavepoint, ""); err != nil {
+			return nil, err
+		}
+	}
+	name, err := p.parseSavepointName()
+	if err != nil {
+		return nil, err
+	}
+	return &ReleaseSavepoint{Name: name}, nil
+}
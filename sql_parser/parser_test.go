@@ -269,6 +269,51 @@ func TestParseSelectFromTable(t *testing.T) {
 			},
 			expectedError: "",
 		},
+		{
+			name:       "Select with WHERE, ORDER BY, LIMIT and OFFSET",
+			inputQuery: "SELECT name FROM students WHERE age > 10 ORDER BY age DESC, name LIMIT 5 OFFSET 10;",
+			expectedSelectFromTable: SelectFromTable{
+				TableName:       "students",
+				ColumnsRequired: []string{"name"},
+				QueryConditions: []QueryCondition{{ColumnName: "age", QueryType: Gt, Value: "10"}},
+				OrderBy:         []OrderByColumn{{ColumnName: "age", Descending: true}, {ColumnName: "name"}},
+				Limit:           func() *int { limit := 5; return &limit }(),
+				Offset:          10,
+			},
+		},
+		{
+			name:       "Select with ORDER BY ASC",
+			inputQuery: "SELECT * FROM students ORDER BY name ASC;",
+			expectedSelectFromTable: SelectFromTable{
+				TableName:       "students",
+				ColumnsRequired: []string{"*"},
+				OrderBy:         []OrderByColumn{{ColumnName: "name"}},
+			},
+		},
+		{
+			name:       "Select with only OFFSET",
+			inputQuery: "SELECT * FROM students OFFSET 2;",
+			expectedSelectFromTable: SelectFromTable{
+				TableName:       "students",
+				ColumnsRequired: []string{"*"},
+				Offset:          2,
+			},
+		},
+		{
+			name:          "Select with ORDER without BY",
+			inputQuery:    "SELECT * FROM students ORDER name;",
+			expectedError: "syntax error: expected KEYWORD \"BY\", got IDENTIFIER \"name\"",
+		},
+		{
+			name:          "Select with LIMIT which isn't a number",
+			inputQuery:    "SELECT * FROM students LIMIT abc;",
+			expectedError: "expected a non-negative row count, got \"abc\"",
+		},
+		{
+			name:          "Select with OFFSET before LIMIT",
+			inputQuery:    "SELECT * FROM students OFFSET 2 LIMIT 3;",
+			expectedError: "syntax error: expected SYMBOL \";\", got KEYWORD \"LIMIT\"",
+		},
 		// todo: tests for AND condition
 	}
 
@@ -284,3 +329,175 @@ func TestParseSelectFromTable(t *testing.T) {
 		})
 	}
 }
+
+func TestParseSavepointStatements(t *testing.T) {
+	testCases := []struct {
+		name              string
+		inputQuery        string
+		parse             func(p *Parser) (any, error)
+		expectedStatement any
+		expectedError     string
+	}{
+		{
+			name:              "Savepoint",
+			inputQuery:        "SAVEPOINT step1;",
+			parse:             func(p *Parser) (any, error) { return p.ParseSavepoint() },
+			expectedStatement: &Savepoint{Name: "step1"},
+		},
+		{
+			name:          "Savepoint without name",
+			inputQuery:    "SAVEPOINT;",
+			parse:         func(p *Parser) (any, error) { return p.ParseSavepoint() },
+			expectedError: "syntax error: expected IDENTIFIER \"savepoint name\", got SYMBOL \";\"",
+		},
+		{
+			name:          "Savepoint with trailing tokens",
+			inputQuery:    "SAVEPOINT step1 step2;",
+			parse:         func(p *Parser) (any, error) { return p.ParseSavepoint() },
+			expectedError: "syntax error: expected EOF, got IDENTIFIER \"step2\"",
+		},
+		{
+			name:              "Rollback to",
+			inputQuery:        "ROLLBACK TO step1",
+			parse:             func(p *Parser) (any, error) { return p.ParseRollbackToSavepoint() },
+			expectedStatement: &RollbackToSavepoint{Name: "step1"},
+		},
+		{
+			name:              "Rollback to savepoint",
+			inputQuery:        "ROLLBACK TO SAVEPOINT step1;",
+			parse:             func(p *Parser) (any, error) { return p.ParseRollbackToSavepoint() },
+			expectedStatement: &RollbackToSavepoint{Name: "step1"},
+		},
+		{
+			name:          "Rollback without to",
+			inputQuery:    "ROLLBACK step1;",
+			parse:         func(p *Parser) (any, error) { return p.ParseRollbackToSavepoint() },
+			expectedError: "syntax error: expected KEYWORD \"TO\", got IDENTIFIER \"step1\"",
+		},
+		{
+			name:              "Release savepoint",
+			inputQuery:        "RELEASE SAVEPOINT step1;",
+			parse:             func(p *Parser) (any, error) { return p.ParseReleaseSavepoint() },
+			expectedStatement: &ReleaseSavepoint{Name: "step1"},
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			statement, err := tt.parse(NewParser(tt.inputQuery))
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedStatement, statement)
+			}
+		})
+	}
+}
+
+func TestParseUpdateTable(t *testing.T) {
+	testCases := []struct {
+		name                string
+		inputQuery          string
+		expectedUpdateTable *UpdateTable
+		expectedError       string
+	}{
+		{
+			name:       "Update with WHERE",
+			inputQuery: "UPDATE t1 SET c2 = abc WHERE c1 = k1;",
+			expectedUpdateTable: &UpdateTable{
+				TableName:       "t1",
+				Assignments:     []ColumnAssignment{{ColumnName: "c2", Value: "abc"}},
+				QueryConditions: []QueryCondition{{ColumnName: "c1", QueryType: Equals, Value: "k1"}},
+			},
+		},
+		{
+			name:       "Update multiple columns without WHERE",
+			inputQuery: "UPDATE t1 SET c2 = abc, c3 = 5;",
+			expectedUpdateTable: &UpdateTable{
+				TableName: "t1",
+				Assignments: []ColumnAssignment{
+					{ColumnName: "c2", Value: "abc"},
+					{ColumnName: "c3", Value: "5"},
+				},
+			},
+		},
+		{
+			name:          "Update without SET",
+			inputQuery:    "UPDATE t1 c2 = abc;",
+			expectedError: "syntax error: expected KEYWORD \"SET\", got IDENTIFIER \"c2\"",
+		},
+		{
+			name:          "Update without assignment",
+			inputQuery:    "UPDATE t1 SET;",
+			expectedError: "syntax error: expected IDENTIFIER \"column name\", got SYMBOL \";\"",
+		},
+		{
+			name:          "Update with comparison instead of assignment",
+			inputQuery:    "UPDATE t1 SET c3 > 5;",
+			expectedError: "syntax error: expected CONDITIONAL_OPERATOR \"=\", got CONDITIONAL_OPERATOR \">\"",
+		},
+		{
+			name:          "Update without semicolon",
+			inputQuery:    "UPDATE t1 SET c3 = 5",
+			expectedError: "syntax error: expected SYMBOL \";\", got EOF \"\"",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			updateTable, err := NewParser(tt.inputQuery).ParseUpdateTable()
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedUpdateTable, updateTable)
+			}
+		})
+	}
+}
+
+func TestParseDeleteFromTable(t *testing.T) {
+	testCases := []struct {
+		name                    string
+		inputQuery              string
+		expectedDeleteFromTable *DeleteFromTable
+		expectedError           string
+	}{
+		{
+			name:       "Delete with WHERE",
+			inputQuery: "DELETE FROM t1 WHERE c1 = k1 AND c3 > 5;",
+			expectedDeleteFromTable: &DeleteFromTable{
+				TableName: "t1",
+				QueryConditions: []QueryCondition{
+					{ColumnName: "c1", QueryType: Equals, Value: "k1"},
+					{ColumnName: "c3", QueryType: Gt, Value: "5"},
+				},
+			},
+		},
+		{
+			name:                    "Delete without WHERE",
+			inputQuery:              "DELETE FROM t1;",
+			expectedDeleteFromTable: &DeleteFromTable{TableName: "t1"},
+		},
+		{
+			name:          "Delete without FROM",
+			inputQuery:    "DELETE t1;",
+			expectedError: "syntax error: expected KEYWORD \"FROM\", got IDENTIFIER \"t1\"",
+		},
+		{
+			name:          "Delete with empty WHERE",
+			inputQuery:    "DELETE FROM t1 WHERE;",
+			expectedError: "expected atleast 1 condition within WHERE clause of SELECT query",
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			deleteFromTable, err := NewParser(tt.inputQuery).ParseDeleteFromTable()
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedDeleteFromTable, deleteFromTable)
+			}
+		})
+	}
+}
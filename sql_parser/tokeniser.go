@@ -27,17 +27,30 @@ var (
 )
 
 var keywords = map[string]bool{
-	KeywordCreate:  true,
-	KeywordTable:   true,
-	KeywordPrimary: true,
-	KeywordKey:     true,
-	KeywordInsert:  true,
-	KeywordInto:    true,
-	KeywordValues:  true,
-	KeywordSelect:  true,
-	KeywordFrom:    true,
-	KeywordWhere:   true,
-	KeywordAnd:     true,
+	KeywordCreate:    true,
+	KeywordTable:     true,
+	KeywordPrimary:   true,
+	KeywordKey:       true,
+	KeywordInsert:    true,
+	KeywordInto:      true,
+	KeywordValues:    true,
+	KeywordSelect:    true,
+	KeywordFrom:      true,
+	KeywordWhere:     true,
+	KeywordAnd:       true,
+	KeywordSavepoint: true,
+	KeywordRollback:  true,
+	KeywordTo:        true,
+	KeywordRelease:   true,
+	KeywordUpdate:    true,
+	KeywordSet:       true,
+	KeywordDelete:    true,
+	KeywordOrder:     true,
+	KeywordBy:        true,
+	KeywordAsc:       true,
+	KeywordDesc:      true,
+	KeywordLimit:     true,
+	KeywordOffset:    true,
 }
 
 type Token struct {
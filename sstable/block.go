@@ -0,0 +1,118 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+)
+
+const (
+	// footer: [index_block_offset][bloom_filter_block_offset][format_version][magic_number]
+	footerLength      = 16
+	footerMagicNumber = 0x53414152 // "SAAR"
+	// the keys of the entries and of the index block are internal keys carrying the sequence number.
+	footerFormatVersion = 2
+	// files written before sequence numbers were added store the user keys as is. their entries are
+	// read as versions with sequence number 0, which are older than every newer write.
+	footerFormatVersionUserKeys = 1
+
+	// every block is stored as [length][payload][checksum]
+	blockHeaderLength  = 4
+	blockTrailerLength = 4
+)
+
+// ErrCorruption is returned (wrapped in a CorruptionError) whenever an sstable file fails
+// checksum or format validation. Callers can check for it with errors.Is.
+var ErrCorruption = errors.New("sstable corruption")
+
+// CorruptionError describes where in an sstable file the corruption was detected.
+type CorruptionError struct {
+	FileName string
+	Offset   int64
+	Reason   string
+}
+
+func (e *CorruptionError) Error() string {
+	return fmt.Sprintf("%s: file %s at offset %d: %s", ErrCorruption, e.FileName, e.Offset, e.Reason)
+}
+
+func (e *CorruptionError) Is(target error) bool {
+	return target == ErrCorruption
+}
+
+func newCorruptionError(file *os.File, offset int64, reason string) error {
+	return &CorruptionError{FileName: file.Name(), Offset: offset, Reason: reason}
+}
+
+// encodeBlock frames the payload as [length][payload][checksum], similar to a WAL record.
+func encodeBlock(payload []byte) []byte {
+	buf := make([]byte, 0, blockHeaderLength+len(payload)+blockTrailerLength)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(payload)))
+	buf = append(buf, payload...)
+	buf = binary.BigEndian.AppendUint32(buf, crc32.ChecksumIEEE(payload))
+	return buf
+}
+
+// readBlock reads the block stored in [startOffset, endOffset) and returns its payload
+// after verifying the length and the checksum.
+func readBlock(file *os.File, startOffset, endOffset int64) ([]byte, error) {
+	if endOffset-startOffset < blockHeaderLength+blockTrailerLength {
+		return nil, newCorruptionError(file, startOffset, "block is smaller than its header and checksum")
+	}
+	buf := make([]byte, endOffset-startOffset)
+	if _, err := file.ReadAt(buf, startOffset); err != nil {
+		if err == io.EOF {
+			return nil, newCorruptionError(file, startOffset, "block extends beyond the end of the file")
+		}
+		return nil, err
+	}
+	payloadLength := binary.BigEndian.Uint32(buf[0:blockHeaderLength])
+	if int64(payloadLength) != int64(len(buf)-blockHeaderLength-blockTrailerLength) {
+		return nil, newCorruptionError(file, startOffset, "block length mismatch")
+	}
+	payload := buf[blockHeaderLength : blockHeaderLength+payloadLength]
+	storedChecksum := binary.BigEndian.Uint32(buf[blockHeaderLength+payloadLength:])
+	if storedChecksum != crc32.ChecksumIEEE(payload) {
+		return nil, newCorruptionError(file, startOffset, "checksum mismatch")
+	}
+	return payload, nil
+}
+
+// returns the end offset of the data block at blockIdx. the last data block ends where
+// the index block starts.
+func dataBlockEndOffset(indexBlock []indexBlockEntry, blockIdx int, indexOffset int) int {
+	if blockIdx < len(indexBlock)-1 {
+		return indexBlock[blockIdx+1].offset
+	}
+	return indexOffset
+}
+
+// readDataBlockEntries reads and verifies the data block at blockIdx and calls fn for each entry.
+// iteration stops early if fn returns false.
+func readDataBlockEntries(file *os.File, indexBlock []indexBlockEntry, blockIdx int, indexOffset int,
+	formatVersion int, fn func(e entry) bool) error {
+	startOffset := int64(indexBlock[blockIdx].offset)
+	endOffset := int64(dataBlockEndOffset(indexBlock, blockIdx, indexOffset))
+	return readBlockEntries(file, startOffset, endOffset, formatVersion, fn)
+}
+
+func readBlockEntries(file *os.File, startOffset, endOffset int64, formatVersion int, fn func(e entry) bool) error {
+	payload, err := readBlock(file, startOffset, endOffset)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(payload); {
+		e, next, err := readEntry(payload, i, formatVersion)
+		if err != nil {
+			return newCorruptionError(file, startOffset, err.Error())
+		}
+		i = next
+		if !fn(e) {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package sstable
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/golang-db/internalkey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writes count keys to a new file and returns the sstable along with the file name.
+func newSsTableWithFile(t *testing.T, count int) (*SsTable, string) {
+	st, err := NewSsTable(Config{DataFilesDirectory: t.TempDir()})
+	require.NoError(t, err)
+	return st, writeTestFile(t, st, "value", count)
+}
+
+// writes the keys key_000, key_001... with values valuePrefix_000, valuePrefix_001... to a new
+// level 0 file and returns the file name.
+func writeTestFile(t *testing.T, st *SsTable, valuePrefix string, count int) string {
+	return writeTestEntries(t, st, func(fn func(key, value string, tombstone bool)) {
+		for i := 0; i < count; i++ {
+			fn(fmt.Sprintf("key_%03d", i), fmt.Sprintf("%s_%03d", valuePrefix, i), false)
+		}
+	})
+}
+
+// sequence number of the entries of the last file written by writeTestEntries
+var lastTestSequence uint64
+
+// writes the entries of iteratorFunc to a new level 0 file and returns the file name. the user keys of
+// iteratorFunc are written as the versions of a single write, newer than the entries of earlier files.
+func writeTestEntries(t *testing.T, st *SsTable, iteratorFunc func(fn func(key, value string, tombstone bool))) string {
+	lastTestSequence++
+	sequence := lastTestSequence
+	file, err := st.NewFile()
+	require.NoError(t, err)
+	require.NoError(t, st.Write(file, func(fn func(key, value string, tombstone bool)) {
+		iteratorFunc(func(key, value string, tombstone bool) {
+			fn(internalkey.Make(key, sequence), value, tombstone)
+		})
+	}))
+	return file.Name()
+}
+
+// flips a single byte in the file at offset.
+func flipByte(t *testing.T, fileName string, offset int64) {
+	file, err := os.OpenFile(fileName, os.O_RDWR, 0644)
+	require.NoError(t, err)
+	defer file.Close()
+	buf := make([]byte, 1)
+	_, err = file.ReadAt(buf, offset)
+	require.NoError(t, err)
+	buf[0] ^= 0xff
+	_, err = file.WriteAt(buf, offset)
+	require.NoError(t, err)
+}
+
+func TestBlockEncodeAndReadRoundTrip(t *testing.T) {
+	file, err := os.CreateTemp(t.TempDir(), "block")
+	require.NoError(t, err)
+	defer file.Close()
+	block := encodeBlock([]byte("payload"))
+	_, err = file.Write(block)
+	require.NoError(t, err)
+
+	payload, err := readBlock(file, 0, int64(len(block)))
+	require.NoError(t, err)
+	assert.Equal(t, "payload", string(payload))
+}
+
+func TestGetReturnsCorruptionErrorForCorruptedDataBlock(t *testing.T) {
+	st, fileName := newSsTableWithFile(t, 50)
+	value, err := st.Get("key_000")
+	require.NoError(t, err)
+	assert.Equal(t, "value_000", value)
+
+	// the first data block starts at offset 0, the byte after its length header is part of the first key.
+	flipByte(t, fileName, blockHeaderLength)
+
+	_, err = st.Get("key_000")
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrCorruption))
+	var corruptionErr *CorruptionError
+	require.True(t, errors.As(err, &corruptionErr))
+	assert.Equal(t, fileName, corruptionErr.FileName)
+	assert.Equal(t, int64(0), corruptionErr.Offset)
+
+	// other data blocks are still readable
+	value, err = st.Get("key_049")
+	require.NoError(t, err)
+	assert.Equal(t, "value_049", value)
+}
+
+func TestIteratorReturnsCorruptionError(t *testing.T) {
+	st, fileName := newSsTableWithFile(t, 50)
+	flipByte(t, fileName, blockHeaderLength)
+
+	iterators, err := st.NewIterators()
+	require.NoError(t, err)
+	it := NewMergingIterator(iterators)
+	defer it.Close()
+	it.Seek("")
+	assert.False(t, it.Valid())
+	assert.True(t, errors.Is(it.Error(), ErrCorruption))
+}
+
+func TestOpenReturnsCorruptionErrorForBadFooterMagic(t *testing.T) {
+	st, fileName := newSsTableWithFile(t, 10)
+	info, err := os.Stat(fileName)
+	require.NoError(t, err)
+	flipByte(t, fileName, info.Size()-1)
+
+	_, err = NewSsTable(Config{DataFilesDirectory: st.dataFilesDirectory})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrCorruption))
+}
+
+func TestOpenReturnsCorruptionErrorForCorruptedIndexBlock(t *testing.T) {
+	st, fileName := newSsTableWithFile(t, 10)
+	flipByte(t, fileName, int64(st.levels[0][0].indexOffset+blockHeaderLength))
+
+	_, err := NewSsTable(Config{DataFilesDirectory: st.dataFilesDirectory})
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrCorruption))
+}
+
+func TestCompactionReturnsCorruptionError(t *testing.T) {
+	st, fileName := newSsTableWithFile(t, 50)
+	for i := 1; i < l0CompactionTrigger; i++ {
+		writeTestFile(t, st, fmt.Sprintf("file_%d", i), 10)
+	}
+	flipByte(t, fileName, blockHeaderLength)
+
+	err := st.RunCompaction()
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrCorruption))
+	// the corrupted file is kept as is
+	require.Len(t, st.levels[0], l0CompactionTrigger)
+	assert.Equal(t, fileName, st.levels[0][0].file.Name())
+	assert.Empty(t, st.levels[1])
+}
@@ -0,0 +1,66 @@
+package sstable
+
+import (
+	"hash/fnv"
+)
+
+const (
+	defaultBloomFilterBitsPerKey = 10
+	maxBloomFilterHashes         = 30
+)
+
+func bloomHash(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// buildBloomFilter builds the bloom filter from the hashes of all the keys in a file.
+// serialisation: [bit_array][number_of_hash_functions]
+// k hash functions are derived from a single hash using double hashing: h + i*delta.
+// with 10 bits per key, the false positive rate is ~1%.
+func buildBloomFilter(keyHashes []uint32, bitsPerKey int) []byte {
+	// k = bitsPerKey * ln(2) gives the lowest false positive rate
+	numHashes := int(float64(bitsPerKey) * 0.69)
+	numHashes = max(1, min(numHashes, maxBloomFilterHashes))
+
+	// very small filters have a high false positive rate, hence a lower limit of 64 bits
+	numBits := max(len(keyHashes)*bitsPerKey, 64)
+	numBytes := (numBits + 7) / 8
+	numBits = numBytes * 8
+
+	filter := make([]byte, numBytes+1)
+	for _, h := range keyHashes {
+		delta := (h >> 17) | (h << 15)
+		for i := 0; i < numHashes; i++ {
+			bitPosition := h % uint32(numBits)
+			filter[bitPosition/8] |= 1 << (bitPosition % 8)
+			h += delta
+		}
+	}
+	filter[numBytes] = byte(numHashes)
+	return filter
+}
+
+// bloomFilterMayContain returns false only if the key is definitely not present in the file.
+// an empty or malformed filter always returns true so that the file is still searched.
+func bloomFilterMayContain(filter []byte, key string) bool {
+	if len(filter) < 2 {
+		return true
+	}
+	numBits := uint32(len(filter)-1) * 8
+	numHashes := int(filter[len(filter)-1])
+	if numHashes > maxBloomFilterHashes {
+		return true
+	}
+	h := bloomHash(key)
+	delta := (h >> 17) | (h << 15)
+	for i := 0; i < numHashes; i++ {
+		bitPosition := h % numBits
+		if filter[bitPosition/8]&(1<<(bitPosition%8)) == 0 {
+			return false
+		}
+		h += delta
+	}
+	return true
+}
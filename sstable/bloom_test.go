@@ -0,0 +1,39 @@
+package sstable
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBloomFilterNoFalseNegatives(t *testing.T) {
+	keyHashes := []uint32{}
+	for i := 0; i < 1000; i++ {
+		keyHashes = append(keyHashes, bloomHash(fmt.Sprintf("key_%d", i)))
+	}
+	filter := buildBloomFilter(keyHashes, defaultBloomFilterBitsPerKey)
+	for i := 0; i < 1000; i++ {
+		assert.True(t, bloomFilterMayContain(filter, fmt.Sprintf("key_%d", i)))
+	}
+}
+
+func TestBloomFilterFalsePositiveRate(t *testing.T) {
+	keyHashes := []uint32{}
+	for i := 0; i < 1000; i++ {
+		keyHashes = append(keyHashes, bloomHash(fmt.Sprintf("key_%d", i)))
+	}
+	filter := buildBloomFilter(keyHashes, defaultBloomFilterBitsPerKey)
+	falsePositives := 0
+	for i := 1000; i < 11000; i++ {
+		if bloomFilterMayContain(filter, fmt.Sprintf("key_%d", i)) {
+			falsePositives++
+		}
+	}
+	// ~1% expected with 10 bits per key
+	assert.Less(t, falsePositives, 300)
+}
+
+func TestBloomFilterEmptyFilterMayContainEverything(t *testing.T) {
+	assert.True(t, bloomFilterMayContain(nil, "key"))
+}
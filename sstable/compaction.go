@@ -1,52 +1,94 @@
 package sstable
 
-// todo: handle concurrent reads and writes between Compaction and regular Get, Write
-// functions
 import (
+	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/golang-db/internalkey"
 )
 
+// compaction merges the input files of a level with the overlapping files of the next level.
+// the merged output is written to the next level as non-overlapping files of bounded size.
+type compaction struct {
+	level       int
+	inputs      []*fileMetadata // files from level, ordered from the oldest to the newest
+	overlapping []*fileMetadata // files from level + 1 which overlap the key range of inputs
+}
+
+// compaction needs the index of the files, hence it never runs when the index is skipped.
 func (st *SsTable) ShouldRunCompaction() bool {
 	st.mutex.RLock()
 	defer st.mutex.RUnlock()
-	return !st.compacting && len(st.firstLevelFiles) >= 4
+	return !st.skipIndex && !st.compacting && st.pickCompaction() != nil
 }
 
-// builds a compactedMap formed from all the key value pairs present in the files.
-// we go from the oldest file to the newest one to ensure that the key has the most up-to-date value.
-func (st *SsTable) buildCompactedMap(files []*os.File) (map[string]string, error) {
-	compactedMap := map[string]string{}
-	for _, file := range files {
-		indexOffset, err := st.getIndexOffset(file)
-		if err != nil {
-			return nil, err
+// pickCompaction picks the level with the highest score. nil is returned if no level has a score of 1 or above.
+// the last level is never compacted. must be called with the mutex held.
+func (st *SsTable) pickCompaction() *compaction {
+	bestLevel := -1
+	bestScore := 1.0
+	for level := 0; level < numLevels-1; level++ {
+		if score := st.levelScore(level); score >= bestScore {
+			bestLevel = level
+			bestScore = score
 		}
-		buf := make([]byte, indexOffset)
-		_, err = file.ReadAt(buf, 0)
-		if err != nil {
-			return nil, err
-		}
-		for i := 0; i < len(buf); {
-			key, err := extractValueFromSsTable(buf, i)
-			if err != nil {
-				return nil, err
-			}
-			i += (4 + len(key))
-			value, err := extractValueFromSsTable(buf, i)
-			if err != nil {
-				return nil, err
+	}
+	if bestLevel == -1 {
+		return nil
+	}
+
+	c := &compaction{level: bestLevel}
+	if bestLevel == 0 {
+		// level 0 files can overlap each other, hence all of them are compacted together.
+		c.inputs = append(c.inputs, st.levels[0]...)
+	} else {
+		// pick the first file after the compact pointer, wrapping around to the first file of the level.
+		files := st.levels[bestLevel]
+		picked := files[0]
+		for _, f := range files {
+			if f.minKey > st.compactPointers[bestLevel] {
+				picked = f
+				break
 			}
-			i += (4 + len(value))
-			compactedMap[key] = value
+		}
+		c.inputs = []*fileMetadata{picked}
+	}
+	minKey, maxKey := keyRange(c.inputs)
+	c.overlapping = overlappingFiles(st.levels[bestLevel+1], minKey, maxKey)
+	return c
+}
+
+// a tombstone can only be dropped if no level below the output level can have an older value for the key.
+// must be called with the mutex held.
+func (st *SsTable) isBaseLevelForKey(outputLevel int, key string) bool {
+	for level := outputLevel + 1; level < numLevels; level++ {
+		if findFileInLevel(st.levels[level], key) != nil {
+			return false
 		}
 	}
-	return compactedMap, nil
+	return true
+}
+
+func (st *SsTable) canDropTombstone(outputLevel int, key string) bool {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	return st.isBaseLevelForKey(outputLevel, key)
 }
 
-func (st *SsTable) RunCompaction() {
+// RunCompaction runs compactions till no level has a score of 1 or above.
+// a corrupted input file aborts the compaction and the error wraps ErrCorruption.
+func (st *SsTable) RunCompaction() error {
 	// 1. compacting flag set and unset
+	// only one compaction runs at a time. a compaction triggered while another one is
+	// running is skipped, the files will be picked by the running compaction.
 	st.mutex.Lock()
+	if st.compacting {
+		st.mutex.Unlock()
+		return nil
+	}
 	st.compacting = true
 	st.mutex.Unlock()
 
@@ -56,86 +98,203 @@ func (st *SsTable) RunCompaction() {
 		st.mutex.Unlock()
 	}()
 
-	// 2. build compacted map
-	st.mutex.RLock()
-	filesToCompact := make([]*os.File, len(st.firstLevelFiles))
-	copy(filesToCompact, st.firstLevelFiles)
-	st.mutex.RUnlock()
-	slog.Info("COMPACTION_STARTED", "files_to_be_compacted_count", len(filesToCompact))
-	compactedMap, err := st.buildCompactedMap(filesToCompact)
-	if err != nil {
-		slog.Error("COMPACTED_MAP_BUILD_FAILED", "error", err.Error())
+	for {
+		st.mutex.RLock()
+		c := st.pickCompaction()
+		liveSnapshots := st.liveSnapshots
+		st.mutex.RUnlock()
+		if c == nil {
+			return nil
+		}
+		// the snapshots are read after the files are picked. a snapshot opened later can read only the
+		// newest version of the keys in the picked files, which is always kept.
+		snapshots := []uint64{}
+		if liveSnapshots != nil {
+			snapshots = append(snapshots, liveSnapshots()...)
+		}
+		sort.Slice(snapshots, func(i, j int) bool { return snapshots[i] < snapshots[j] })
+		if err := st.runCompaction(c, snapshots); err != nil {
+			return err
+		}
 	}
-	// 3. get sorted keys
-	sortedKeys := sortedKeys(compactedMap)
+}
+
+// returns the number of snapshots older than the sequence. versions of a key with the same stripe are
+// read by the same snapshots, hence only the newest version of a stripe is needed.
+// stripe 0 has the versions which every snapshot can read.
+func snapshotStripe(snapshots []uint64, sequence uint64) int {
+	return sort.Search(len(snapshots), func(i int) bool {
+		return snapshots[i] >= sequence
+	})
+}
 
-	// 4. create iterator function which calls the callback for each key-value pair in sorted
-	// and compacted map
-	iterator := func(fn func(key, value string)) {
-		for _, key := range sortedKeys {
-			value := compactedMap[key]
-			fn(key, value)
+// snapshots are sorted in ascending order.
+func (st *SsTable) runCompaction(c *compaction, snapshots []uint64) error {
+	outputLevel := c.level + 1
+	slog.Info("COMPACTION_STARTED", "level", c.level, "input_files_count", len(c.inputs),
+		"overlapping_files_count", len(c.overlapping))
+
+	// a single file which doesn't overlap the next level can be moved without rewriting it.
+	if c.level > 0 && len(c.inputs) == 1 && len(c.overlapping) == 0 {
+		if err := st.installCompaction(c, c.inputs); err != nil {
+			return err
 		}
+		slog.Info("COMPACTION_TRIVIAL_MOVE_SUCCESSFUL", "file_name", c.inputs[0].file.Name(), "output_level", outputLevel)
+		return nil
 	}
 
-	// 5. write to the compacted file
-	compactedFile, err := st.NewFile()
-	if err != nil {
-		slog.Error("COMPACTED_FILE_CREATE_FAILED", "error", err.Error())
+	// 2. k-way merge of the files. only the current data block of each file is kept in-memory.
+	// the merging iterator returns the newest entry for a key, the files of the next level are
+	// older than the input files.
+	filesToCompact := append(append([]*fileMetadata{}, c.overlapping...), c.inputs...)
+	iterators := []Iterator{}
+	for i := len(filesToCompact) - 1; i >= 0; i-- {
+		it, err := newFileIterator(filesToCompact[i])
+		if err != nil {
+			for _, it := range iterators {
+				it.Close()
+			}
+			return err
+		}
+		iterators = append(iterators, it)
+	}
+	merged := NewMergingIterator(iterators)
+	defer merged.Close()
+
+	// 3. the versions which no snapshot can read are dropped: an older version is hidden by a newer version
+	// of the same stripe. a tombstone which every snapshot can read is dropped too if it doesn't hide
+	// any older value.
+	var keyErr error
+	userKey := ""
+	stripe := -1
+	skipDroppableEntries := func() {
+		for merged.Valid() {
+			currentUserKey, sequence, err := internalkey.Parse(merged.Key())
+			if err != nil {
+				keyErr = fmt.Errorf("%w: %s: %q", ErrCorruption, err.Error(), merged.Key())
+				return
+			}
+			currentStripe := snapshotStripe(snapshots, sequence)
+			if stripe != -1 && currentUserKey == userKey && currentStripe == stripe {
+				merged.Next()
+				continue
+			}
+			userKey, stripe = currentUserKey, currentStripe
+			if merged.Tombstone() && currentStripe == 0 && st.canDropTombstone(outputLevel, currentUserKey) {
+				merged.Next()
+				continue
+			}
+			return
+		}
+	}
+	merged.Seek("")
+	skipDroppableEntries()
+
+	// 4. stream the merged entries to the output files. a new file is started once the target file size is reached.
+	outputs := []*fileMetadata{}
+	removeOutputs := func() {
+		for _, output := range outputs {
+			output.file.Close()
+			os.Remove(output.file.Name())
+		}
+	}
+	for merged.Valid() && keyErr == nil {
+		iterator := func(fn func(key, value string, tombstone bool)) {
+			size := 0
+			fileLastUserKey := ""
+			// the versions of a key are kept in the same file, else a Get would have to read both the files.
+			for merged.Valid() && keyErr == nil && (size < st.targetFileSize || userKey == fileLastUserKey) {
+				// [length_of_key][key][length_of_value][value]
+				size += 8 + len(merged.Key()) + len(merged.Value())
+				fileLastUserKey = userKey
+				fn(merged.Key(), merged.Value(), merged.Tombstone())
+				merged.Next()
+				skipDroppableEntries()
+			}
+		}
+		output, err := st.writeCompactedFile(iterator)
+		if err != nil {
+			slog.Error("COMPACTED_FILE_WRITE_FAILED", "error", err.Error())
+			removeOutputs()
+			return err
+		}
+		outputs = append(outputs, output)
+	}
+	err := merged.Error()
+	if err == nil {
+		err = keyErr
 	}
-	compactedIndexOffset, compactedIndexBlock, err := st.writeToFile(compactedFile, iterator)
 	if err != nil {
-		slog.Error("COMPACTED_FILE_WRITE_FAILED", "error", err.Error())
+		slog.Error("COMPACTION_MERGE_FAILED", "error", err.Error())
+		removeOutputs()
+		return err
 	}
 
-	slog.Info("COMPACTED_FILE_WRITE_SUCCESSFUL", "file_name", compactedFile.Name())
+	slog.Info("COMPACTED_FILES_WRITE_SUCCESSFUL", "output_level", outputLevel, "output_files_count", len(outputs))
+
+	// 5. atomic swap of input files with output files
+	// the old files are kept if the edit could not be logged as the manifest still lists them.
+	if err := st.installCompaction(c, outputs); err != nil {
+		return err
+	}
 
-	// 6. atomic swap of files array and indexes array
-	st.atomicSwap(compactedFile, filesToCompact, compactedIndexBlock, compactedIndexOffset)
+	slog.Info("COMPACTED_FILES_ATOMIC_SWAP_SUCCESSFUL", "files_to_compact_count", len(filesToCompact))
 
-	slog.Info("COMPACTED_FILE_ATOMIC_SWAP_SUCCESSFUL", "files_to_compact_count", len(filesToCompact))
+	// 6. delete old files
+	for _, fileMetadata := range filesToCompact {
+		fileMetadata.file.Close()
+		os.Remove(fileMetadata.file.Name())
+	}
+	return nil
+}
 
-	// 7. delete old files
-	for _, file := range filesToCompact {
-		file.Close()
-		os.Remove(file.Name())
+func (st *SsTable) writeCompactedFile(iteratorFunc func(fn func(key, value string, tombstone bool))) (*fileMetadata, error) {
+	compactedFile, err := st.NewFile()
+	if err != nil {
+		return nil, err
+	}
+	output, err := st.writeToFile(compactedFile, iteratorFunc)
+	if err != nil {
+		compactedFile.Close()
+		os.Remove(compactedFile.Name())
+		return nil, err
 	}
+	return output, nil
 }
 
-// takes the compacted file, old files array and current state of files array to construct the new ssTables array and sets it.
-// similar behaviour done for indexes array.
-// the old files / index block / index offset will not be kept after atomic swap as those have now been compacted.
-// while the new files which were not part of compaction will get added.
-func (st *SsTable) atomicSwap(compactedFile *os.File, oldFiles []*os.File, compactedIndexBlock []indexBlockEntry, compactedIndexOffset int) {
+// removes the compacted files from their levels and adds the output files to the next level.
+// the files which were not part of compaction are kept, level 0 can get new files while the
+// compaction is running.
+// the whole change is logged as a single edit to the manifest before the levels are updated.
+func (st *SsTable) installCompaction(c *compaction, outputs []*fileMetadata) error {
 	st.mutex.Lock()
 	defer st.mutex.Unlock()
 
-	oldFilesMap := map[string]bool{}
-
-	for _, file := range oldFiles {
-		oldFilesMap[file.Name()] = true
+	edit := versionEdit{}
+	compactedFiles := map[*fileMetadata]bool{}
+	for _, fileMetadata := range append(append([]*fileMetadata{}, c.inputs...), c.overlapping...) {
+		compactedFiles[fileMetadata] = true
+		edit.removedFiles = append(edit.removedFiles, filepath.Base(fileMetadata.file.Name()))
+	}
+	for _, fileMetadata := range outputs {
+		edit.addedFiles = append(edit.addedFiles, newManifestFile(fileMetadata, c.level+1))
+	}
+	if err := st.logEdit(edit); err != nil {
+		return err
 	}
 
-	currentFiles := st.firstLevelFiles
-
-	// position is important, compactedFile is older than the newly created files
-	swappedFiles := []*os.File{compactedFile}
-	fileNames := []string{compactedFile.Name()}
-	swappedIndexBlocks := [][]indexBlockEntry{compactedIndexBlock}
-	swappedIndexOffsets := []int{compactedIndexOffset}
-
-	for i, file := range currentFiles {
-		if !oldFilesMap[file.Name()] {
-			swappedFiles = append(swappedFiles, file)
-			swappedIndexBlocks = append(swappedIndexBlocks, st.indexBlocks[i])
-			swappedIndexOffsets = append(swappedIndexOffsets, st.indexOffsets[i])
-			fileNames = append(fileNames, file.Name())
+	for _, level := range []int{c.level, c.level + 1} {
+		remaining := []*fileMetadata{}
+		for _, fileMetadata := range st.levels[level] {
+			if !compactedFiles[fileMetadata] {
+				remaining = append(remaining, fileMetadata)
+			}
 		}
+		st.levels[level] = remaining
 	}
+	st.levels[c.level+1] = append(st.levels[c.level+1], outputs...)
+	sortByMinKey(st.levels[c.level+1])
 
-	st.firstLevelFiles = swappedFiles
-	st.indexBlocks = swappedIndexBlocks
-
-	st.manifest.FileNames = fileNames
-	st.saveManifest()
+	_, st.compactPointers[c.level] = keyRange(c.inputs)
+	return nil
 }
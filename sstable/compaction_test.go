@@ -0,0 +1,303 @@
+package sstable
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSsTableForCompactionTest(t *testing.T) *SsTable {
+	st, err := NewSsTable(Config{DataFilesDirectory: t.TempDir(), TargetFileSize: 512})
+	require.NoError(t, err)
+	return st
+}
+
+func assertLevelsAreNonOverlapping(t *testing.T, st *SsTable) {
+	for level := 1; level < numLevels; level++ {
+		files := st.levels[level]
+		for i := 1; i < len(files); i++ {
+			assert.Less(t, files[i-1].maxKey, files[i].minKey, "level %d files overlap", level)
+		}
+	}
+}
+
+func TestLevelZeroCompactionWritesNonOverlappingLevelOneFiles(t *testing.T) {
+	st := newSsTableForCompactionTest(t)
+	for i := 0; i < l0CompactionTrigger; i++ {
+		writeTestFile(t, st, fmt.Sprintf("file_%d", i), 100)
+	}
+	require.True(t, st.ShouldRunCompaction())
+
+	require.NoError(t, st.RunCompaction())
+
+	assert.Empty(t, st.levels[0])
+	assert.Greater(t, len(st.levels[1]), 1)
+	assertLevelsAreNonOverlapping(t, st)
+	for _, f := range st.levels[1] {
+		// data blocks are cut after the target size is crossed, the index and bloom filter add a bit more.
+		assert.Less(t, f.size, int64(2*st.targetFileSize))
+	}
+	assert.False(t, st.ShouldRunCompaction())
+
+	for i := 0; i < 100; i++ {
+		value, err := st.Get(fmt.Sprintf("key_%03d", i))
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("file_%d_%03d", l0CompactionTrigger-1, i), value)
+	}
+}
+
+func TestCompactionSplitsOutputAtTargetFileSize(t *testing.T) {
+	filesCountForTargetSize := func(targetFileSize int) int {
+		st, err := NewSsTable(Config{DataFilesDirectory: t.TempDir(), TargetFileSize: targetFileSize})
+		require.NoError(t, err)
+		for i := 0; i < l0CompactionTrigger; i++ {
+			writeTestFile(t, st, fmt.Sprintf("file_%d", i), 200)
+		}
+		require.NoError(t, st.RunCompaction())
+		require.Empty(t, st.levels[0])
+		assertLevelsAreNonOverlapping(t, st)
+		return len(st.levels[1])
+	}
+	// 200 entries of 33 bytes each (the internal key adds 10 bytes to the key) are ~6.6KB
+	assert.Equal(t, 1, filesCountForTargetSize(8*1024))
+	assert.Equal(t, 7, filesCountForTargetSize(1024))
+}
+
+func TestCompactionMergesNewestEntryAcrossInterleavedFiles(t *testing.T) {
+	st := newSsTableForCompactionTest(t)
+	// every file updates a different subset of the keys, the last file deletes a few of them.
+	for i := 0; i < l0CompactionTrigger-1; i++ {
+		writeTestEntries(t, st, func(fn func(key, value string, tombstone bool)) {
+			for k := i; k < 60; k += i + 1 {
+				fn(fmt.Sprintf("key_%03d", k), fmt.Sprintf("file_%d", i), false)
+			}
+		})
+	}
+	writeTestEntries(t, st, func(fn func(key, value string, tombstone bool)) {
+		for k := 0; k < 60; k += 10 {
+			fn(fmt.Sprintf("key_%03d", k), "", true)
+		}
+	})
+
+	require.NoError(t, st.RunCompaction())
+
+	iterators, err := st.NewIterators()
+	require.NoError(t, err)
+	it := NewMergingIterator(iterators)
+	defer it.Close()
+	keysCount := 0
+	for it.Seek(""); it.Valid(); it.Next() {
+		// tombstones are dropped as there is no older level
+		assert.False(t, it.Tombstone())
+		keysCount++
+	}
+	require.NoError(t, it.Error())
+	assert.Equal(t, 54, keysCount)
+
+	for k := 1; k < 60; k++ {
+		if k%10 == 0 {
+			continue
+		}
+		expected := ""
+		for i := 0; i < l0CompactionTrigger-1; i++ {
+			if k >= i && (k-i)%(i+1) == 0 {
+				expected = fmt.Sprintf("file_%d", i)
+			}
+		}
+		value, err := st.Get(fmt.Sprintf("key_%03d", k))
+		require.NoError(t, err)
+		assert.Equal(t, expected, value, "key_%03d", k)
+	}
+}
+
+func TestCompactionMovesDataToNextLevelOnceLevelExceedsSizeTarget(t *testing.T) {
+	st := newSsTableForCompactionTest(t)
+	st.levelOneMaxBytes = 1024
+	for i := 0; i < l0CompactionTrigger; i++ {
+		writeTestFile(t, st, fmt.Sprintf("file_%d", i), 200)
+	}
+
+	require.NoError(t, st.RunCompaction())
+
+	assert.NotEmpty(t, st.levels[2])
+	assert.Less(t, st.levelScore(1), 1.0)
+	assertLevelsAreNonOverlapping(t, st)
+	for i := 0; i < 200; i++ {
+		value, err := st.Get(fmt.Sprintf("key_%03d", i))
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf("file_%d_%03d", l0CompactionTrigger-1, i), value)
+	}
+}
+
+func TestCompactionKeepsTombstoneWhileDeeperLevelHasOlderValue(t *testing.T) {
+	st := newSsTableForCompactionTest(t)
+	// tiny size targets move all the data below level 1.
+	st.levelOneMaxBytes = 1
+	for i := 0; i < l0CompactionTrigger; i++ {
+		writeTestFile(t, st, "old", 50)
+	}
+	require.NoError(t, st.RunCompaction())
+	require.Empty(t, st.levels[0])
+	require.Empty(t, st.levels[1])
+
+	st.levelOneMaxBytes = defaultLevelOneMaxBytes
+	writeTestEntries(t, st, func(fn func(key, value string, tombstone bool)) {
+		fn("key_005", "", true)
+	})
+	for i := 1; i < l0CompactionTrigger; i++ {
+		writeTestEntries(t, st, func(fn func(key, value string, tombstone bool)) {
+			fn(fmt.Sprintf("key_%03d", 100+i), "new", false)
+		})
+	}
+	require.NoError(t, st.RunCompaction())
+	require.NotEmpty(t, st.levels[1])
+
+	value, err := st.Get("key_005")
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+	value, err = st.Get("key_006")
+	require.NoError(t, err)
+	assert.Equal(t, "old_006", value)
+}
+
+func TestCompactionKeepsVersionsReadByLiveSnapshots(t *testing.T) {
+	st := newSsTableForCompactionTest(t)
+	// every file overwrites key_000 and deletes key_001 in the last one
+	sequences := []uint64{}
+	for i := 0; i < l0CompactionTrigger; i++ {
+		writeTestEntries(t, st, func(fn func(key, value string, tombstone bool)) {
+			fn("key_000", fmt.Sprintf("file_%d", i), false)
+			fn("key_001", fmt.Sprintf("file_%d", i), i == l0CompactionTrigger-1)
+		})
+		sequences = append(sequences, lastTestSequence)
+	}
+	// the snapshots read the versions of the first and the third file
+	st.SetLiveSnapshotsFunc(func() []uint64 {
+		return []uint64{sequences[2], sequences[0]}
+	})
+
+	require.NoError(t, st.RunCompaction())
+	require.Empty(t, st.levels[0])
+
+	versionsCount := 0
+	iterators, err := st.NewIterators()
+	require.NoError(t, err)
+	it := NewMergingIterator(iterators)
+	for it.Seek(""); it.Valid(); it.Next() {
+		versionsCount++
+	}
+	require.NoError(t, it.Error())
+	it.Close()
+	// the version of the second file is hidden by the third file for both the snapshots
+	assert.Equal(t, 6, versionsCount)
+	for _, snapshotIdx := range []int{0, 2} {
+		for _, key := range []string{"key_000", "key_001"} {
+			version, found, err := st.GetVersion(key, sequences[snapshotIdx])
+			require.NoError(t, err)
+			require.True(t, found)
+			assert.Equal(t, fmt.Sprintf("file_%d", snapshotIdx), version.Value)
+		}
+	}
+	value, err := st.Get("key_001")
+	require.NoError(t, err)
+	assert.Equal(t, "", value)
+
+	// once the snapshots are released, the next compaction of the keys keeps only the newest version
+	// and drops the tombstone
+	st.SetLiveSnapshotsFunc(nil)
+	for i := 0; i < l0CompactionTrigger; i++ {
+		writeTestEntries(t, st, func(fn func(key, value string, tombstone bool)) {
+			fn("key_000_other", "value", false)
+		})
+	}
+	require.NoError(t, st.RunCompaction())
+	value, err = st.Get("key_000")
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("file_%d", l0CompactionTrigger-1), value)
+	_, found, err := st.GetVersion("key_000", sequences[2])
+	require.NoError(t, err)
+	assert.False(t, found)
+	_, found, err = st.GetVersion("key_001", sequences[3])
+	require.NoError(t, err)
+	assert.False(t, found)
+}
+
+func TestManifestRecordsLevelAndKeyRangeOfFiles(t *testing.T) {
+	st := newSsTableForCompactionTest(t)
+	for i := 0; i < l0CompactionTrigger; i++ {
+		writeTestFile(t, st, fmt.Sprintf("file_%d", i), 100)
+	}
+	require.NoError(t, st.RunCompaction())
+	newestFile := writeTestFile(t, st, "newest", 10)
+
+	reopened, err := NewSsTable(Config{DataFilesDirectory: st.dataFilesDirectory})
+	require.NoError(t, err)
+	for level := 0; level < numLevels; level++ {
+		require.Len(t, reopened.levels[level], len(st.levels[level]))
+		for i, f := range st.levels[level] {
+			assert.Equal(t, f.file.Name(), reopened.levels[level][i].file.Name())
+			assert.Equal(t, f.minKey, reopened.levels[level][i].minKey)
+			assert.Equal(t, f.maxKey, reopened.levels[level][i].maxKey)
+		}
+	}
+	require.Len(t, reopened.levels[0], 1)
+	assert.Equal(t, newestFile, reopened.levels[0][0].file.Name())
+	assert.Equal(t, "key_000", reopened.levels[0][0].minKey)
+	assert.Equal(t, "key_009", reopened.levels[0][0].maxKey)
+
+	value, err := reopened.Get("key_005")
+	require.NoError(t, err)
+	assert.Equal(t, "newest_005", value)
+	value, err = reopened.Get("key_050")
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("file_%d_050", l0CompactionTrigger-1), value)
+}
+
+func TestManifestWithoutLevelsIsMigratedToLevelZero(t *testing.T) {
+	st := newSsTableForCompactionTest(t)
+	olderFile := writeTestFile(t, st, "older", 20)
+	newerFile := writeTestFile(t, st, "newer", 10)
+
+	legacyManifest, err := json.Marshal(map[string]any{
+		"next_file_id": st.nextFileId,
+		"file_names":   []string{olderFile, newerFile},
+	})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(st.dataFilesDirectory, manifestJsonFileName), legacyManifest, 0644))
+	require.NoError(t, os.Remove(filepath.Join(st.dataFilesDirectory, manifestLogFileName)))
+
+	reopened, err := NewSsTable(Config{DataFilesDirectory: st.dataFilesDirectory})
+	require.NoError(t, err)
+	require.Len(t, reopened.levels[0], 2)
+	assert.Equal(t, olderFile, reopened.levels[0][0].file.Name())
+	assert.Equal(t, "key_019", reopened.levels[0][0].maxKey)
+	assert.Equal(t, newerFile, reopened.levels[0][1].file.Name())
+	// the JSON manifest is replaced by the manifest log
+	assert.NoFileExists(t, filepath.Join(st.dataFilesDirectory, manifestJsonFileName))
+	assert.FileExists(t, filepath.Join(st.dataFilesDirectory, manifestLogFileName))
+
+	value, err := reopened.Get("key_015")
+	require.NoError(t, err)
+	assert.Equal(t, "older_015", value)
+	value, err = reopened.Get("key_005")
+	require.NoError(t, err)
+	assert.Equal(t, "newer_005", value)
+}
+
+func TestFindFileInLevel(t *testing.T) {
+	files := []*fileMetadata{
+		{minKey: "b", maxKey: "d"},
+		{minKey: "f", maxKey: "h"},
+	}
+	assert.Nil(t, findFileInLevel(files, "a"))
+	assert.Equal(t, files[0], findFileInLevel(files, "b"))
+	assert.Equal(t, files[0], findFileInLevel(files, "d"))
+	assert.Nil(t, findFileInLevel(files, "e"))
+	assert.Equal(t, files[1], findFileInLevel(files, "g"))
+	assert.Nil(t, findFileInLevel(files, "i"))
+}
@@ -0,0 +1,267 @@
+package sstable
+
+import (
+	"container/heap"
+	"errors"
+	"os"
+)
+
+// Iterator iterates over the versions of the keys in the internal key order, see the internalkey package.
+// It is implemented by a single sstable file, the memtable and the merging iterator which
+// combines multiple iterators.
+type Iterator interface {
+	// Seek positions the iterator at the first internal key >= the given internal key.
+	Seek(key string)
+	// Key returns the internal key of the current version.
+	Valid() bool
+	Next()
+	Key() string
+	Value() string
+	Tombstone() bool
+	Error() error
+	Close() error
+}
+
+// fileIterator streams through the data blocks of a single sstable file.
+// only the current data block is kept in-memory.
+type fileIterator struct {
+	file          *os.File
+	indexBlock    []indexBlockEntry
+	indexOffset   int
+	formatVersion int
+	blockIdx      int    // index of the data block currently loaded in blockBuf
+	blockBuf      []byte // current data block
+	nextOffset    int    // offset of the entry after the current entry within blockBuf
+	current       entry
+	valid         bool
+	err           error
+}
+
+// NewIterators returns one iterator per sstable file, ordered from the newest file to the oldest one.
+// files of the same level (other than level 0) never overlap, so their relative order doesn't matter.
+// each iterator opens its own handle to the file, so the iterators keep working even if the file
+// is compacted and removed while iterating.
+func (st *SsTable) NewIterators() ([]Iterator, error) {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	if st.skipIndex {
+		return nil, errors.New("iterators are not supported when the index is skipped")
+	}
+	iterators := []Iterator{}
+	for _, fileMetadata := range st.filesNewestFirst() {
+		it, err := newFileIterator(fileMetadata)
+		if err != nil {
+			for _, it := range iterators {
+				it.Close()
+			}
+			return nil, err
+		}
+		iterators = append(iterators, it)
+	}
+	return iterators, nil
+}
+
+func newFileIterator(fileMetadata *fileMetadata) (*fileIterator, error) {
+	file, err := os.Open(fileMetadata.file.Name())
+	if err != nil {
+		return nil, err
+	}
+	return &fileIterator{
+		file:          file,
+		indexBlock:    fileMetadata.indexBlock,
+		indexOffset:   fileMetadata.indexOffset,
+		formatVersion: fileMetadata.formatVersion,
+	}, nil
+}
+
+// loads the data block at blockIdx and positions the iterator at its first entry.
+func (it *fileIterator) loadBlock(blockIdx int) {
+	it.valid = false
+	if blockIdx >= len(it.indexBlock) {
+		return
+	}
+	startOffset := int64(it.indexBlock[blockIdx].offset)
+	endOffset := int64(dataBlockEndOffset(it.indexBlock, blockIdx, it.indexOffset))
+	it.blockIdx = blockIdx
+	blockBuf, err := readBlock(it.file, startOffset, endOffset)
+	if err != nil {
+		it.err = err
+		return
+	}
+	it.blockBuf = blockBuf
+	it.nextOffset = 0
+	it.readNextEntry()
+}
+
+// reads the entry at nextOffset. moves to the next data block once the current block is exhausted.
+func (it *fileIterator) readNextEntry() {
+	if it.nextOffset >= len(it.blockBuf) {
+		it.loadBlock(it.blockIdx + 1)
+		return
+	}
+	e, next, err := readEntry(it.blockBuf, it.nextOffset, it.formatVersion)
+	if err != nil {
+		it.err = newCorruptionError(it.file, int64(it.indexBlock[it.blockIdx].offset), err.Error())
+		it.valid = false
+		return
+	}
+	it.nextOffset = next
+	it.current = e
+	it.valid = true
+}
+
+func (it *fileIterator) Seek(key string) {
+	blockIdx := getLowerBound(key, it.indexBlock)
+	if blockIdx == -1 {
+		blockIdx = 0
+	}
+	it.loadBlock(blockIdx)
+	for it.valid && it.current.key < key {
+		it.readNextEntry()
+	}
+}
+
+func (it *fileIterator) Valid() bool {
+	return it.valid && it.err == nil
+}
+
+func (it *fileIterator) Next() {
+	it.readNextEntry()
+}
+
+func (it *fileIterator) Key() string {
+	return it.current.key
+}
+
+func (it *fileIterator) Value() string {
+	return it.current.value
+}
+
+func (it *fileIterator) Tombstone() bool {
+	return it.current.tombstone
+}
+
+func (it *fileIterator) Error() error {
+	return it.err
+}
+
+func (it *fileIterator) Close() error {
+	it.valid = false
+	it.blockBuf = nil
+	return it.file.Close()
+}
+
+type heapItem struct {
+	iterator Iterator
+	position int // position of the iterator in mergingIterator.iterators. lower is newer.
+}
+
+// iteratorHeap is a min heap on the current key of the iterators.
+// for the same key, the iterator with the lower position (the newer source) comes first.
+type iteratorHeap []heapItem
+
+func (h iteratorHeap) Len() int {
+	return len(h)
+}
+
+func (h iteratorHeap) Less(i, j int) bool {
+	keyI, keyJ := h[i].iterator.Key(), h[j].iterator.Key()
+	if keyI != keyJ {
+		return keyI < keyJ
+	}
+	return h[i].position < h[j].position
+}
+
+func (h iteratorHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+}
+
+func (h *iteratorHeap) Push(x any) {
+	*h = append(*h, x.(heapItem))
+}
+
+func (h *iteratorHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// mergingIterator does a k-way merge of multiple sorted iterators in O(N logK).
+// every version of a key is returned, from the newest to the oldest one. when the same internal key is
+// present in multiple iterators, only the entry from the newest iterator is returned. it happens only
+// for the files storing user keys, whose entries are all read with sequence number 0.
+// tombstones are returned as well, it is up to the caller to skip them.
+type mergingIterator struct {
+	iterators []Iterator // ordered from newest to oldest
+	heap      *iteratorHeap
+	err       error
+}
+
+// NewMergingIterator merges the iterators which must be ordered from the newest source to the oldest one.
+// The merging iterator is not positioned, Seek must be called before reading.
+func NewMergingIterator(iterators []Iterator) Iterator {
+	return &mergingIterator{
+		iterators: iterators,
+		heap:      &iteratorHeap{},
+	}
+}
+
+func (m *mergingIterator) Seek(key string) {
+	m.heap = &iteratorHeap{}
+	for position, it := range m.iterators {
+		it.Seek(key)
+		if it.Valid() {
+			*m.heap = append(*m.heap, heapItem{iterator: it, position: position})
+		} else if err := it.Error(); err != nil && m.err == nil {
+			m.err = err
+		}
+	}
+	heap.Init(m.heap)
+}
+
+func (m *mergingIterator) Valid() bool {
+	return m.err == nil && m.heap.Len() > 0
+}
+
+// Next moves all the iterators positioned at the current internal key forward. This drops the
+// duplicates of the current version in older iterators.
+func (m *mergingIterator) Next() {
+	key := m.Key()
+	for m.heap.Len() > 0 && (*m.heap)[0].iterator.Key() == key {
+		item := heap.Pop(m.heap).(heapItem)
+		item.iterator.Next()
+		if item.iterator.Valid() {
+			heap.Push(m.heap, item)
+		} else if err := item.iterator.Error(); err != nil && m.err == nil {
+			m.err = err
+		}
+	}
+}
+
+func (m *mergingIterator) Key() string {
+	return (*m.heap)[0].iterator.Key()
+}
+
+func (m *mergingIterator) Value() string {
+	return (*m.heap)[0].iterator.Value()
+}
+
+func (m *mergingIterator) Tombstone() bool {
+	return (*m.heap)[0].iterator.Tombstone()
+}
+
+func (m *mergingIterator) Error() error {
+	return m.err
+}
+
+func (m *mergingIterator) Close() error {
+	var err error
+	for _, it := range m.iterators {
+		if closeErr := it.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
@@ -0,0 +1,123 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/golang-db/internalkey"
+)
+
+// files written before block checksums were added are [data-block(s)][index-block][footer] where the
+// blocks are not framed and the footer is only the 4 byte index block offset. there is no bloom filter,
+// no tombstones and the keys are user keys.
+const legacyFooterLength = 4
+
+// upgradeLegacyFile rewrites the file in the current format if it is in the legacy format, so that it
+// can be read like every other file. its entries are written as versions with sequence number 0, which
+// are older than every newer write. the file is replaced atomically by a rename.
+// a file which has neither the footer of the current format nor a readable legacy layout is reported
+// as corrupt.
+func (st *SsTable) upgradeLegacyFile(filePath string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	isLegacy, err := hasLegacyFooter(file)
+	if err != nil || !isLegacy {
+		file.Close()
+		return err
+	}
+	entries, err := readLegacyFile(file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	tempFilePath := filePath + ".tmp"
+	tempFile, err := os.OpenFile(tempFilePath, os.O_APPEND|os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0644)
+	if err != nil {
+		return err
+	}
+	_, err = st.writeToFile(tempFile, func(fn func(key, value string, tombstone bool)) {
+		for _, e := range entries {
+			fn(e.key, e.value, false)
+		}
+	})
+	tempFile.Close()
+	if err != nil {
+		os.Remove(tempFilePath)
+		return err
+	}
+	if err := os.Rename(tempFilePath, filePath); err != nil {
+		return err
+	}
+	if err := syncDirectory(filepath.Dir(filePath)); err != nil {
+		return err
+	}
+	slog.Info("SSTABLE_LEGACY_FILE_UPGRADED", "file_name", filePath, "entries_count", len(entries))
+	return nil
+}
+
+// returns true if the file doesn't end with the magic number of the current footer.
+func hasLegacyFooter(file *os.File) (bool, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return false, err
+	}
+	if info.Size() < footerLength {
+		return info.Size() >= legacyFooterLength, nil
+	}
+	magicBuf := make([]byte, 4)
+	if _, err := file.ReadAt(magicBuf, info.Size()-4); err != nil {
+		return false, err
+	}
+	return binary.BigEndian.Uint32(magicBuf) != footerMagicNumber, nil
+}
+
+// reads every entry of a legacy file in the order of the keys. the keys are returned as internal keys
+// with sequence number 0. the whole file must parse, as the legacy layout has no checksums to tell a
+// legacy file apart from a corrupt one.
+func readLegacyFile(file *os.File) ([]entry, error) {
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	footerOffset := info.Size() - legacyFooterLength
+	buf := make([]byte, info.Size())
+	if _, err := file.ReadAt(buf, 0); err != nil {
+		return nil, err
+	}
+	indexOffset := int64(binary.BigEndian.Uint32(buf[footerOffset:]))
+	if indexOffset > footerOffset {
+		return nil, newCorruptionError(file, footerOffset, "magic number mismatch")
+	}
+
+	// the index block is only validated, the data blocks are read one after the other
+	indexBlockBuf := buf[indexOffset:footerOffset]
+	for i := 0; i < len(indexBlockBuf); {
+		key, err := extractValueFromSsTable(indexBlockBuf, i)
+		if err != nil || i+4+len(key)+4 > len(indexBlockBuf) {
+			return nil, newCorruptionError(file, indexOffset, errWhileReadingIndexBlock+": "+potentialIndexBlockCorrupted)
+		}
+		i += 4 + len(key) + 4
+	}
+
+	dataBuf := buf[:indexOffset]
+	entries := []entry{}
+	for i := 0; i < len(dataBuf); {
+		key, err := extractValueFromSsTable(dataBuf, i)
+		if err == nil {
+			i += 4 + len(key)
+			var value string
+			value, err = extractValueFromSsTable(dataBuf, i)
+			i += 4 + len(value)
+			entries = append(entries, entry{key: internalkey.Make(key, 0), value: value})
+		}
+		if err != nil {
+			return nil, newCorruptionError(file, int64(i), "legacy file: "+err.Error())
+		}
+	}
+	return entries, nil
+}
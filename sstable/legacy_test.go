@@ -0,0 +1,59 @@
+package sstable
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// the files of testdata/baseline were written by the code before block checksums were added. the
+// manifest is the JSON one of that code, storing the path of each file as it was when written.
+func copyBaselineSsTableFiles(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	require.NoError(t, os.CopyFS(dir, os.DirFS(filepath.Join("..", "testdata", "baseline", "sstable"))))
+	return dir
+}
+
+func TestLegacyFilesAreUpgradedOnOpen(t *testing.T) {
+	dir := copyBaselineSsTableFiles(t)
+	st, err := NewSsTable(Config{DataFilesDirectory: dir})
+	require.NoError(t, err)
+
+	require.Len(t, st.levels[0], 3)
+	for _, fileMetadata := range st.levels[0] {
+		assert.Equal(t, footerFormatVersion, fileMetadata.formatVersion)
+	}
+	value, err := st.Get("_calatog")
+	require.NoError(t, err)
+	assert.Equal(t, "accounts", value)
+	version, found, err := st.GetVersion("_schema:accounts", 0)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.NotEmpty(t, version.Value)
+	assert.Equal(t, uint64(0), version.Sequence)
+	st.Close()
+
+	// the upgraded files are read like any other file on the next open
+	reopened, err := NewSsTable(Config{DataFilesDirectory: dir})
+	require.NoError(t, err)
+	defer reopened.Close()
+	value, err = reopened.Get("_calatog")
+	require.NoError(t, err)
+	assert.Equal(t, "accounts", value)
+	_, err = os.Stat(filepath.Join(dir, "0.log.tmp"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestOpenReturnsCorruptionErrorForUnreadableLegacyFile(t *testing.T) {
+	dir := copyBaselineSsTableFiles(t)
+	fileName := filepath.Join(dir, "1.log")
+	// the length of the first key now runs past the data blocks
+	flipByte(t, fileName, 0)
+
+	_, err := NewSsTable(Config{DataFilesDirectory: dir})
+	assert.ErrorIs(t, err, ErrCorruption)
+}
@@ -0,0 +1,116 @@
+package sstable
+
+import (
+	"os"
+	"sort"
+)
+
+const (
+	numLevels = 7
+
+	// compaction of level 0 starts once it has these many files.
+	l0CompactionTrigger = 4
+	// every level from level 1 onwards can hold levelSizeMultiplier times more bytes than the previous one.
+	levelSizeMultiplier = 10
+
+	defaultTargetFileSize   = 2 * 1024
+	defaultLevelOneMaxBytes = 10 * defaultTargetFileSize
+)
+
+// fileMetadata is the in-memory state of a single sstable file.
+// minKey and maxKey are user keys, the versions of a key are never split across the files of a level.
+type fileMetadata struct {
+	file          *os.File
+	minKey        string
+	maxKey        string
+	size          int64
+	indexOffset   int               // start offset of the index block
+	indexBlock    []indexBlockEntry // entire index block of the file
+	bloomFilter   []byte
+	formatVersion int
+}
+
+func (f *fileMetadata) overlaps(minKey, maxKey string) bool {
+	return f.minKey <= maxKey && minKey <= f.maxKey
+}
+
+// returns the files ordered from the newest to the oldest one, which is the order in which a key
+// must be searched. level 0 files are visited newest first, the files of the other levels
+// never overlap, so their order within a level doesn't matter.
+func (st *SsTable) filesNewestFirst() []*fileMetadata {
+	files := []*fileMetadata{}
+	for i := len(st.levels[0]) - 1; i >= 0; i-- {
+		files = append(files, st.levels[0][i])
+	}
+	for level := 1; level < numLevels; level++ {
+		files = append(files, st.levels[level]...)
+	}
+	return files
+}
+
+// returns the file of a sorted level whose key range can contain the key, nil otherwise.
+func findFileInLevel(files []*fileMetadata, key string) *fileMetadata {
+	i := sort.Search(len(files), func(i int) bool {
+		return files[i].maxKey >= key
+	})
+	if i < len(files) && files[i].minKey <= key {
+		return files[i]
+	}
+	return nil
+}
+
+// returns all the files in the level which overlap the key range [minKey, maxKey].
+func overlappingFiles(files []*fileMetadata, minKey, maxKey string) []*fileMetadata {
+	overlapping := []*fileMetadata{}
+	for _, f := range files {
+		if f.overlaps(minKey, maxKey) {
+			overlapping = append(overlapping, f)
+		}
+	}
+	return overlapping
+}
+
+// returns the smallest and the largest key across the files.
+func keyRange(files []*fileMetadata) (minKey, maxKey string) {
+	for i, f := range files {
+		if i == 0 || f.minKey < minKey {
+			minKey = f.minKey
+		}
+		if i == 0 || f.maxKey > maxKey {
+			maxKey = f.maxKey
+		}
+	}
+	return minKey, maxKey
+}
+
+func totalSize(files []*fileMetadata) int64 {
+	var size int64
+	for _, f := range files {
+		size += f.size
+	}
+	return size
+}
+
+func sortByMinKey(files []*fileMetadata) {
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].minKey < files[j].minKey
+	})
+}
+
+func (st *SsTable) maxBytesForLevel(level int) int64 {
+	maxBytes := st.levelOneMaxBytes
+	for l := 1; l < level; l++ {
+		maxBytes *= levelSizeMultiplier
+	}
+	return maxBytes
+}
+
+// a level needs compaction once its score reaches 1.
+// level 0 is scored on the number of files since every level 0 file has to be checked by a Get.
+// other levels are scored on their size compared to the size target of the level.
+func (st *SsTable) levelScore(level int) float64 {
+	if level == 0 {
+		return float64(len(st.levels[0])) / l0CompactionTrigger
+	}
+	return float64(totalSize(st.levels[level])) / float64(st.maxBytesForLevel(level))
+}
@@ -1,59 +1,442 @@
 package sstable
 
 import (
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/golang-db/internalkey"
+	"github.com/golang-db/wal"
 )
 
+// the manifest is an append-only log of version edits. each edit is a single
+// [length][payload][checksum] record written and fsynced through the wal package, hence an edit
+// is either applied completely or not at all.
+// the state of the files is the result of replaying all the edits from the start of the log.
+// on startup the replayed state is written to a new log which replaces the old one once it is complete.
+// the state is split into as many edits as needed for each of them to fit in a single record.
+
+var ssTableFileNameRegex = regexp.MustCompile(`^[0-9]+\.log$`)
+
 type manifest struct {
 	NextFileId int `json:"next_file_id"`
-	// fileNames in manifest indicates the actual order. Example: due to compaction, it is
-	// possible that 5.json has older data compared to 4.json
-	// FileNames will always have the oldest file first
-	FileNames []string `json:"file_names"`
+	// wal segments older than this one are flushed to the files, they must not be replayed again.
+	MinUnflushedWalSegmentId int `json:"min_unflushed_wal_segment_id,omitempty"`
+	// sequence number of the newest write flushed to the files
+	LastSequence uint64 `json:"last_sequence,omitempty"`
+	// Files lists the level 0 files first followed by the files of the other levels.
+	// Level 0 files are in the actual order. Example: due to compaction, it is
+	// possible that 5.log has older data compared to 4.log
+	// Level 0 files will always have the oldest file first
+	Files []manifestFile `json:"files"`
+	// FileNames is only read to migrate manifests written before files had levels.
+	// all of those files are level 0 files with the oldest file first.
+	FileNames []string `json:"file_names,omitempty"`
+}
+
+type manifestFile struct {
+	Name  string `json:"name"` // file name without the data files directory
+	Level int    `json:"level"`
+	// user keys. keys can have any bytes, hence they are stored base64 encoded instead of as JSON strings
+	MinKey []byte `json:"min_key"`
+	MaxKey []byte `json:"max_key"`
+}
+
+// versionEdit is a single change to the set of files. removed files are applied before the
+// added files, so a file can be moved to another level by removing and adding it in the same edit.
+type versionEdit struct {
+	nextFileId               int
+	minUnflushedWalSegmentId int
+	lastSequence             uint64
+	removedFiles             []string
+	addedFiles               []manifestFile
+}
+
+func newManifestFile(fileMetadata *fileMetadata, level int) manifestFile {
+	return manifestFile{
+		Name:   filepath.Base(fileMetadata.file.Name()),
+		Level:  level,
+		MinKey: []byte(fileMetadata.minKey),
+		MaxKey: []byte(fileMetadata.maxKey),
+	}
+}
+
+func appendLengthPrefixed(buf []byte, value []byte) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(value)))
+	return append(buf, value...)
+}
+
+// [next_file_id][removed_count]([name_length][name])...
+// [added_count]([name_length][name][level][min_key_length][min_key][max_key_length][max_key])...
+// [min_unflushed_wal_segment_id][last_sequence]
+// the min unflushed wal segment id was added later, edits written before it end after the added files.
+// the same goes for the last sequence, edits written before it end after the min unflushed wal segment id.
+func serialiseVersionEdit(edit versionEdit) []byte {
+	buf := binary.BigEndian.AppendUint32(nil, uint32(edit.nextFileId))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(edit.removedFiles)))
+	for _, name := range edit.removedFiles {
+		buf = appendLengthPrefixed(buf, []byte(name))
+	}
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(edit.addedFiles)))
+	for _, f := range edit.addedFiles {
+		buf = appendLengthPrefixed(buf, []byte(f.Name))
+		buf = binary.BigEndian.AppendUint32(buf, uint32(f.Level))
+		buf = appendLengthPrefixed(buf, f.MinKey)
+		buf = appendLengthPrefixed(buf, f.MaxKey)
+	}
+	buf = binary.BigEndian.AppendUint32(buf, uint32(edit.minUnflushedWalSegmentId))
+	return binary.BigEndian.AppendUint64(buf, edit.lastSequence)
 }
 
-func (st *SsTable) getManifest() (*manifest, error) {
-	filePath := fmt.Sprintf("%s/%s", st.dataFilesDirectory, manifestJsonFileName)
-	manifestJsonFile, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+func deserialiseVersionEdit(buf []byte) (versionEdit, error) {
+	edit := versionEdit{}
+	offset := 0
+	errIncomplete := errors.New("incomplete version edit in manifest")
+	readUint32 := func() (int, error) {
+		if offset+4 > len(buf) {
+			return 0, errIncomplete
+		}
+		value := binary.BigEndian.Uint32(buf[offset : offset+4])
+		offset += 4
+		return int(value), nil
+	}
+	readBytes := func() ([]byte, error) {
+		length, err := readUint32()
+		if err != nil {
+			return nil, err
+		}
+		if offset+length > len(buf) {
+			return nil, errIncomplete
+		}
+		value := buf[offset : offset+length]
+		offset += length
+		return value, nil
+	}
+
+	var err error
+	if edit.nextFileId, err = readUint32(); err != nil {
+		return edit, err
+	}
+	removedCount, err := readUint32()
 	if err != nil {
-		return nil, err
+		return edit, err
+	}
+	for i := 0; i < removedCount; i++ {
+		name, err := readBytes()
+		if err != nil {
+			return edit, err
+		}
+		edit.removedFiles = append(edit.removedFiles, string(name))
+	}
+	addedCount, err := readUint32()
+	if err != nil {
+		return edit, err
 	}
-	fileInfo, _ := manifestJsonFile.Stat()
-	fileSize := fileInfo.Size()
-	if fileSize == 0 {
+	for i := 0; i < addedCount; i++ {
+		f := manifestFile{}
+		name, err := readBytes()
+		if err != nil {
+			return edit, err
+		}
+		f.Name = string(name)
+		if f.Level, err = readUint32(); err != nil {
+			return edit, err
+		}
+		if f.MinKey, err = readBytes(); err != nil {
+			return edit, err
+		}
+		if f.MaxKey, err = readBytes(); err != nil {
+			return edit, err
+		}
+		edit.addedFiles = append(edit.addedFiles, f)
+	}
+	if offset == len(buf) {
+		return edit, nil
+	}
+	if edit.minUnflushedWalSegmentId, err = readUint32(); err != nil {
+		return edit, err
+	}
+	if offset == len(buf) {
+		return edit, nil
+	}
+	if offset+8 > len(buf) {
+		return edit, errIncomplete
+	}
+	edit.lastSequence = binary.BigEndian.Uint64(buf[offset : offset+8])
+	return edit, nil
+}
+
+func (m *manifest) apply(edit versionEdit) {
+	m.NextFileId = max(m.NextFileId, edit.nextFileId)
+	m.MinUnflushedWalSegmentId = max(m.MinUnflushedWalSegmentId, edit.minUnflushedWalSegmentId)
+	m.LastSequence = max(m.LastSequence, edit.lastSequence)
+	removed := map[string]bool{}
+	for _, name := range edit.removedFiles {
+		removed[name] = true
+	}
+	files := []manifestFile{}
+	for _, f := range m.Files {
+		if !removed[f.Name] {
+			files = append(files, f)
+		}
+	}
+	m.Files = append(files, edit.addedFiles...)
+}
+
+// getManifest replays the manifest log. if there is no manifest log yet, the manifest JSON
+// written by older versions is read instead.
+// complete is false if the log ended with an incomplete record. it is expected after a crash in the
+// middle of an edit, but the files which the unreadable edit added cannot be known.
+// an error is returned for a corrupt record.
+func (st *SsTable) getManifest() (m *manifest, complete bool, err error) {
+	filePath := filepath.Join(st.dataFilesDirectory, manifestLogFileName)
+	if _, err := os.Stat(filePath); errors.Is(err, os.ErrNotExist) {
+		m, err := st.getManifestFromJson()
+		return m, true, err
+	}
+	manifestLog, err := wal.NewWal(filePath)
+	if err != nil {
+		return nil, false, err
+	}
+	defer manifestLog.Close()
+
+	m = &manifest{}
+	for {
+		payload, err := manifestLog.ReadEntry()
+		if err == io.EOF {
+			return m, true, nil
+		}
+		// a record cut short can only be the last one, as the records are read till the end of the file.
+		// a corrupt record might be followed by edits which were acknowledged, dropping them would lose
+		// their files, so the startup fails instead.
+		if wal.IsIncompleteRecord(err) {
+			slog.Warn("MANIFEST_TAIL_UNREADABLE", "error", err.Error())
+			return m, false, nil
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("manifest log is corrupt: %w", err)
+		}
+		edit, err := deserialiseVersionEdit(payload)
+		if err != nil {
+			return nil, false, err
+		}
+		m.apply(edit)
+	}
+}
+
+func (st *SsTable) getManifestFromJson() (*manifest, error) {
+	filePath := filepath.Join(st.dataFilesDirectory, manifestJsonFileName)
+	manifestBuf, err := os.ReadFile(filePath)
+	if errors.Is(err, os.ErrNotExist) || len(manifestBuf) == 0 {
 		return &manifest{}, nil
 	}
-	manifestBuf := make([]byte, fileSize)
-	manifestJsonFile.Read(manifestBuf)
 	if err != nil {
 		return nil, err
 	}
 
 	var manifest manifest
-	err = json.Unmarshal(manifestBuf, &manifest)
-	return &manifest, err
+	if err = json.Unmarshal(manifestBuf, &manifest); err != nil {
+		return nil, err
+	}
+	// the JSON manifest stored the path of the file including the data files directory
+	for i := range manifest.FileNames {
+		manifest.FileNames[i] = filepath.Base(manifest.FileNames[i])
+	}
+	for i := range manifest.Files {
+		manifest.Files[i].Name = filepath.Base(manifest.Files[i].Name)
+	}
+	if len(manifest.FileNames) > 0 && len(manifest.Files) == 0 {
+		if err := st.migrateManifestFileNames(&manifest); err != nil {
+			return nil, err
+		}
+	}
+	return &manifest, nil
+}
+
+// files from a manifest without levels are added as level 0 files. their key range is read from the file.
+// such a manifest was written along with files in the legacy format, which are upgraded first.
+func (st *SsTable) migrateManifestFileNames(manifest *manifest) error {
+	for _, fileName := range manifest.FileNames {
+		if !st.skipIndex {
+			if err := st.upgradeLegacyFile(filepath.Join(st.dataFilesDirectory, fileName)); err != nil {
+				return err
+			}
+		}
+		minKey, maxKey, err := st.readKeyRange(fileName)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, manifestFile{
+			Name:   fileName,
+			Level:  0,
+			MinKey: []byte(minKey),
+			MaxKey: []byte(maxKey),
+		})
+	}
+	manifest.FileNames = nil
+	return nil
+}
+
+// the min key is the first key of the first data block and the max key is the last key of the last data block.
+// the range is returned as user keys.
+func (st *SsTable) readKeyRange(fileName string) (minKey, maxKey string, err error) {
+	if st.skipIndex {
+		return "", "", nil
+	}
+	file, err := os.Open(filepath.Join(st.dataFilesDirectory, fileName))
+	if err != nil {
+		return "", "", err
+	}
+	defer file.Close()
+	indexOffset, indexBlock, _, formatVersion, err := st.buildIndexFromFile(file)
+	if err != nil || len(indexBlock) == 0 {
+		return "", "", err
+	}
+	err = readDataBlockEntries(file, indexBlock, len(indexBlock)-1, indexOffset, formatVersion, func(e entry) bool {
+		maxKey = e.key
+		return true
+	})
+	if err != nil {
+		return "", "", err
+	}
+	if minKey, _, err = internalkey.Parse(indexBlock[0].key); err != nil {
+		return "", "", err
+	}
+	if maxKey, _, err = internalkey.Parse(maxKey); err != nil {
+		return "", "", err
+	}
+	return minKey, maxKey, nil
+}
+
+// writes the manifest as edits to a new log and atomically replaces the current log with it.
+// returns the new log opened for appending edits.
+func (st *SsTable) rewriteManifest(m *manifest) (*wal.Wal, error) {
+	filePath := filepath.Join(st.dataFilesDirectory, manifestLogFileName)
+	tempFilePath := filePath + ".tmp"
+	os.Remove(tempFilePath)
+	tempLog, err := wal.NewWal(tempFilePath)
+	if err != nil {
+		return nil, err
+	}
+	for _, edit := range splitManifestIntoEdits(m) {
+		if err = tempLog.WriteEntry(serialiseVersionEdit(edit)); err != nil {
+			break
+		}
+	}
+	tempLog.Close()
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tempFilePath, filePath); err != nil {
+		return nil, err
+	}
+	if err := syncDirectory(st.dataFilesDirectory); err != nil {
+		return nil, err
+	}
+	// the log has replaced the JSON manifest written by older versions
+	os.Remove(filepath.Join(st.dataFilesDirectory, manifestJsonFileName))
+	return wal.NewWal(filePath)
+}
+
+// splits the files of the manifest into as few edits as possible which each fit in a single record of
+// the log. the files are added in their order, replaying the edits gives back the manifest.
+func splitManifestIntoEdits(m *manifest) []versionEdit {
+	newEdit := func() versionEdit {
+		return versionEdit{
+			nextFileId:               m.NextFileId,
+			minUnflushedWalSegmentId: m.MinUnflushedWalSegmentId,
+			lastSequence:             m.LastSequence,
+		}
+	}
+	edits := []versionEdit{}
+	edit := newEdit()
+	editLength := len(serialiseVersionEdit(edit))
+	for _, f := range m.Files {
+		fileLength := 4 + len(f.Name) + 4 + 4 + len(f.MinKey) + 4 + len(f.MaxKey)
+		if len(edit.addedFiles) > 0 && editLength+fileLength > wal.MaxPayloadLength {
+			edits = append(edits, edit)
+			edit = newEdit()
+			editLength = len(serialiseVersionEdit(edit))
+		}
+		edit.addedFiles = append(edit.addedFiles, f)
+		editLength += fileLength
+	}
+	return append(edits, edit)
+}
+
+// the rename of a file is durable only once its directory is fsynced.
+func syncDirectory(directory string) error {
+	dir, err := os.Open(directory)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
 }
 
-func (st *SsTable) saveManifest() error {
-	manifestJsonBuf, err := json.MarshalIndent(st.manifest, "", " ")
+// removes the sstable files which are not part of the manifest. these are left behind by a crash
+// after a flush or compaction created a file but before its edit was logged, or after a
+// compaction logged its edit but before it deleted the compacted files.
+func (st *SsTable) removeOrphanedFiles(m *manifest) error {
+	liveFiles := map[string]bool{}
+	for _, f := range m.Files {
+		liveFiles[f.Name] = true
+	}
+	dirEntries, err := os.ReadDir(st.dataFilesDirectory)
 	if err != nil {
 		return err
 	}
-	filePath := fmt.Sprintf("%s/%s", st.dataFilesDirectory, manifestJsonFileName)
-	err = os.WriteFile(filePath, manifestJsonBuf, 0644)
-	return err
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if dirEntry.IsDir() || !ssTableFileNameRegex.MatchString(name) || liveFiles[name] {
+			continue
+		}
+		slog.Info("ORPHANED_SSTABLE_FILE_REMOVED", "file_name", name)
+		if err := os.Remove(filepath.Join(st.dataFilesDirectory, name)); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func (st *SsTable) getAllFiles(filePaths []string) ([]*os.File, error) {
-	ssTableFiles := []*os.File{}
-	for _, filePath := range filePaths {
-		file, err := os.OpenFile(filePath, os.O_RDONLY, 0644)
+// returns the highest id among the sstable files in the data files directory, -1 if there are none.
+func (st *SsTable) highestFileId() (int, error) {
+	highestFileId := -1
+	dirEntries, err := os.ReadDir(st.dataFilesDirectory)
+	if err != nil {
+		return 0, err
+	}
+	for _, dirEntry := range dirEntries {
+		name := dirEntry.Name()
+		if dirEntry.IsDir() || !ssTableFileNameRegex.MatchString(name) {
+			continue
+		}
+		id, err := strconv.Atoi(strings.TrimSuffix(name, ".log"))
 		if err != nil {
-			return nil, err
+			return 0, err
 		}
-		ssTableFiles = append(ssTableFiles, file)
+		highestFileId = max(highestFileId, id)
+	}
+	return highestFileId, nil
+}
+
+// logEdit appends the edit to the manifest log. the in-memory levels must be updated only after
+// the edit is logged successfully. must be called with the mutex held.
+func (st *SsTable) logEdit(edit versionEdit) error {
+	edit.nextFileId = st.nextFileId
+	edit.minUnflushedWalSegmentId = max(edit.minUnflushedWalSegmentId, st.minUnflushedWalSegmentId)
+	edit.lastSequence = max(edit.lastSequence, st.lastSequence)
+	if err := st.manifestLog.WriteEntry(serialiseVersionEdit(edit)); err != nil {
+		slog.Error("MANIFEST_EDIT_WRITE_FAILED", "error", err.Error())
+		return err
 	}
-	return ssTableFiles, nil
+	return nil
 }
@@ -0,0 +1,178 @@
+package sstable
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-db/wal"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVersionEditRoundTrip(t *testing.T) {
+	edit := versionEdit{
+		nextFileId:               42,
+		minUnflushedWalSegmentId: 7,
+		lastSequence:             1 << 40,
+		removedFiles:             []string{"1.log", "2.log"},
+		addedFiles: []manifestFile{
+			{Name: "3.log", Level: 1, MinKey: []byte("a\x00b"), MaxKey: []byte("z\xff")},
+		},
+	}
+	decoded, err := deserialiseVersionEdit(serialiseVersionEdit(edit))
+	require.NoError(t, err)
+	assert.Equal(t, edit, decoded)
+
+	_, err = deserialiseVersionEdit(serialiseVersionEdit(edit)[:10])
+	assert.Error(t, err)
+
+	// edits written before the last sequence was added end after the min unflushed wal segment id
+	buf := serialiseVersionEdit(edit)
+	decoded, err = deserialiseVersionEdit(buf[:len(buf)-8])
+	require.NoError(t, err)
+	assert.Equal(t, 7, decoded.minUnflushedWalSegmentId)
+	assert.Equal(t, uint64(0), decoded.lastSequence)
+
+	// edits written before the min unflushed wal segment id was added end after the added files
+	decoded, err = deserialiseVersionEdit(buf[:len(buf)-12])
+	require.NoError(t, err)
+	assert.Equal(t, 0, decoded.minUnflushedWalSegmentId)
+	assert.Equal(t, edit.addedFiles, decoded.addedFiles)
+}
+
+func TestManifestApplyMovesFileBetweenLevels(t *testing.T) {
+	m := &manifest{}
+	m.apply(versionEdit{nextFileId: 2, addedFiles: []manifestFile{{Name: "0.log"}, {Name: "1.log"}}})
+	m.apply(versionEdit{nextFileId: 2, removedFiles: []string{"0.log"}, addedFiles: []manifestFile{{Name: "0.log", Level: 1}}})
+
+	assert.Equal(t, 2, m.NextFileId)
+	assert.Equal(t, []manifestFile{{Name: "1.log"}, {Name: "0.log", Level: 1}}, m.Files)
+}
+
+func TestManifestLargerThanARecordIsSplitIntoEdits(t *testing.T) {
+	m := &manifest{NextFileId: 3000, MinUnflushedWalSegmentId: 4, LastSequence: 99}
+	for i := 0; i < 3000; i++ {
+		key := []byte(fmt.Sprintf("%0500d", i))
+		m.Files = append(m.Files, manifestFile{Name: fmt.Sprintf("%d.log", i), Level: i % 3, MinKey: key, MaxKey: key})
+	}
+
+	edits := splitManifestIntoEdits(m)
+	require.Greater(t, len(edits), 1)
+	replayed := &manifest{}
+	for _, edit := range edits {
+		assert.LessOrEqual(t, len(serialiseVersionEdit(edit)), wal.MaxPayloadLength)
+		replayed.apply(edit)
+	}
+	assert.Equal(t, m, replayed)
+}
+
+func TestStartupRemovesOrphanedFiles(t *testing.T) {
+	st := newSsTableForCompactionTest(t)
+	liveFile := writeTestFile(t, st, "value", 10)
+	// a file created by a flush or a compaction which crashed before logging its edit
+	orphanedFile, err := st.NewFile()
+	require.NoError(t, err)
+	orphanedFile.Close()
+	otherFile := filepath.Join(st.dataFilesDirectory, "wal.log")
+	require.NoError(t, os.WriteFile(otherFile, []byte("not an sstable"), 0644))
+	st.Close()
+
+	reopened, err := NewSsTable(Config{DataFilesDirectory: st.dataFilesDirectory})
+	require.NoError(t, err)
+	defer reopened.Close()
+	assert.NoFileExists(t, orphanedFile.Name())
+	assert.FileExists(t, liveFile)
+	assert.FileExists(t, otherFile)
+	require.Len(t, reopened.levels[0], 1)
+
+	// ids of the live files are never reused. the id of the orphaned file was never logged, it can be reused.
+	newFile, err := reopened.NewFile()
+	require.NoError(t, err)
+	defer newFile.Close()
+	assert.NotEqual(t, liveFile, newFile.Name())
+}
+
+func TestStartupReplaysEditsOfFlushesAndCompactions(t *testing.T) {
+	st := newSsTableForCompactionTest(t)
+	for i := 0; i < l0CompactionTrigger; i++ {
+		writeTestFile(t, st, fmt.Sprintf("file_%d", i), 100)
+	}
+	require.NoError(t, st.RunCompaction())
+	writeTestFile(t, st, "newest", 10)
+	st.Close()
+
+	reopened, err := NewSsTable(Config{DataFilesDirectory: st.dataFilesDirectory})
+	require.NoError(t, err)
+	defer reopened.Close()
+	assert.Len(t, reopened.levels[0], 1)
+	assert.Equal(t, len(st.levels[1]), len(reopened.levels[1]))
+	// the compacted level 0 files were deleted
+	dirEntries, err := os.ReadDir(st.dataFilesDirectory)
+	require.NoError(t, err)
+	assert.Len(t, dirEntries, 1+len(reopened.levels[0])+len(reopened.levels[1]))
+
+	value, err := reopened.Get("key_050")
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("file_%d_050", l0CompactionTrigger-1), value)
+}
+
+func TestStartupIgnoresTornManifestTail(t *testing.T) {
+	st := newSsTableForCompactionTest(t)
+	liveFile := writeTestFile(t, st, "value", 10)
+	orphanedFile, err := st.NewFile()
+	require.NoError(t, err)
+	orphanedFile.Close()
+	st.Close()
+
+	// a crash in the middle of writing an edit leaves a partial record
+	manifestLog, err := os.OpenFile(filepath.Join(st.dataFilesDirectory, manifestLogFileName), os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = manifestLog.Write([]byte{0, 0, 0, 50, 1, 2})
+	require.NoError(t, err)
+	manifestLog.Close()
+
+	reopened, err := NewSsTable(Config{DataFilesDirectory: st.dataFilesDirectory})
+	require.NoError(t, err)
+	require.Len(t, reopened.levels[0], 1)
+	assert.Equal(t, liveFile, reopened.levels[0][0].file.Name())
+	// the torn edit could have added the file, so it is kept
+	assert.FileExists(t, orphanedFile.Name())
+	value, err := reopened.Get("key_005")
+	require.NoError(t, err)
+	assert.Equal(t, "value_005", value)
+	// new files don't reuse the id of the kept file
+	newFile, err := reopened.NewFile()
+	require.NoError(t, err)
+	newFile.Close()
+	assert.NotEqual(t, orphanedFile.Name(), newFile.Name())
+	reopened.Close()
+
+	// the torn tail is dropped once the manifest is rewritten on startup
+	reopenedAgain, err := NewSsTable(Config{DataFilesDirectory: st.dataFilesDirectory})
+	require.NoError(t, err)
+	defer reopenedAgain.Close()
+	assert.NoFileExists(t, orphanedFile.Name())
+	require.Len(t, reopenedAgain.levels[0], 1)
+}
+
+func TestStartupFailsOnCorruptEditInTheMiddleOfTheManifest(t *testing.T) {
+	st := newSsTableForCompactionTest(t)
+	manifestLogPath := filepath.Join(st.dataFilesDirectory, manifestLogFileName)
+	fileInfo, err := os.Stat(manifestLogPath)
+	require.NoError(t, err)
+	firstFile := writeTestFile(t, st, "value", 10)
+	secondFile := writeTestFile(t, st, "other_value", 10)
+	st.Close()
+
+	// a bad byte in the payload of the edit which added the first file, the edit of the second file follows it
+	flipByte(t, manifestLogPath, fileInfo.Size()+8)
+	_, err = NewSsTable(Config{DataFilesDirectory: st.dataFilesDirectory})
+	assert.ErrorContains(t, err, "manifest log is corrupt")
+	// the files added by the edits after the corrupt one are still live, none of them is removed
+	assert.FileExists(t, firstFile)
+	assert.FileExists(t, secondFile)
+	_, err = NewSsTable(Config{DataFilesDirectory: st.dataFilesDirectory})
+	assert.ErrorContains(t, err, "manifest log is corrupt")
+}
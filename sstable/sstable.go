@@ -4,45 +4,81 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"io"
+	"math"
 	"os"
-	"strings"
+	"path/filepath"
 	"sync"
+
+	"github.com/golang-db/internalkey"
+	"github.com/golang-db/wal"
 )
 
 const (
-	dataFilesDefaultDirectory   = "data_files_sstable"
-	firstLevelFilesSubdirectory = "l0"
-	defaultBlockLength          = 100
+	dataFilesDefaultDirectory = "data_files_sstable"
+	defaultBlockLength        = 100
 
 	errWhileReadingIndexBlock         = "error while reading index block"
 	potentialIndexBlockCorrupted      = "index block seems incomplete or corrupted"
 	manifestJsonFileName              = "manifest.json"
+	manifestLogFileName               = "MANIFEST"
 	errorWhileReadingSsTableDatablock = "error while reading ss-table data block"
+
+	// value length stored for a deleted key. no value bytes follow it.
+	tombstoneValueLength = math.MaxUint32
 )
 
+// entry is a single version of a key read from a data block. key is the internal key of the version.
+type entry struct {
+	key       string
+	value     string
+	tombstone bool
+}
+
 // index block entry specifies a single entry in the index block.
 type indexBlockEntry struct {
-	key    string // first key of the data block
+	key    string // first internal key of the data block
 	offset int    // start of the data block
 }
 
 type SsTable struct {
 	mutex              sync.RWMutex
 	dataFilesDirectory string
-	firstLevelFiles    []*os.File
-	indexOffsets       []int // tracks the index block start offsets for each file
-	blockLength        int
-	indexBlocks        [][]indexBlockEntry // stores the index block array for each file.
-	manifest           manifest
-	skipIndex          bool // added only for benchmarking. Default is that index will always be used
-	compacting         bool
+	// levels[0] has the flushed files ordered from the oldest to the newest, their key ranges can overlap.
+	// every other level has files with non-overlapping key ranges sorted by their min key. all the versions
+	// of a key are kept in a single file of the level.
+	levels [][]*fileMetadata
+	// max key of the last file compacted from each level. the next compaction of the level
+	// picks the file after it, so that compactions rotate through the key space.
+	compactPointers  []string
+	blockLength      int
+	targetFileSize   int
+	levelOneMaxBytes int64
+	bloomBitsPerKey  int
+	nextFileId       int
+	// wal segments older than this one are flushed. recorded in the manifest along with the flushed file.
+	minUnflushedWalSegmentId int
+	// sequence number of the newest write flushed to the files. recorded in the manifest along with the flushed file.
+	lastSequence uint64
+	// returns the sequence numbers of the snapshots which can still read older versions of the keys.
+	// compaction keeps the versions which these snapshots need.
+	liveSnapshots   func() []uint64
+	manifestLog     *wal.Wal
+	skipIndex       bool // added only for benchmarking. Default is that index will always be used
+	skipBloomFilter bool // added only for benchmarking. Default is that bloom filter will always be checked
+	compacting      bool
 }
 
 type Config struct {
 	DataFilesDirectory string
 	BlockLength        int
-	SkipIndex          bool
+	// BloomFilterBitsPerKey is the size of the bloom filter written to each file. More bits per key
+	// lower the false positive rate at the cost of memory. Defaults to 10 (~1% false positives).
+	BloomFilterBitsPerKey int
+	// TargetFileSize is the approximate size in bytes of each file written by compaction.
+	// The output of a compaction is split into multiple files of this size. Defaults to 2KB.
+	TargetFileSize  int
+	SkipIndex       bool
+	SkipBloomFilter bool
 }
 
 func NewSsTable(config Config) (*SsTable, error) {
@@ -52,107 +88,210 @@ func NewSsTable(config Config) (*SsTable, error) {
 	if config.BlockLength == 0 {
 		config.BlockLength = defaultBlockLength
 	}
+	if config.BloomFilterBitsPerKey == 0 {
+		config.BloomFilterBitsPerKey = defaultBloomFilterBitsPerKey
+	}
+	if config.TargetFileSize == 0 {
+		config.TargetFileSize = defaultTargetFileSize
+	}
 	st := SsTable{
 		dataFilesDirectory: config.DataFilesDirectory,
 		blockLength:        config.BlockLength,
+		bloomBitsPerKey:    config.BloomFilterBitsPerKey,
 		skipIndex:          config.SkipIndex,
-		firstLevelFiles:    make([]*os.File, 0),
-		indexBlocks:        make([][]indexBlockEntry, 0),
+		skipBloomFilter:    config.SkipBloomFilter,
+		targetFileSize:     config.TargetFileSize,
+		levelOneMaxBytes:   defaultLevelOneMaxBytes,
+		levels:             make([][]*fileMetadata, numLevels),
+		compactPointers:    make([]string, numLevels),
 		mutex:              sync.RWMutex{},
-		indexOffsets:       make([]int, 0),
 	}
 
 	directoryMetadata, err := st.getDirectoryMetadata()
 	if err != nil {
 		return nil, err
 	}
-	st.firstLevelFiles = directoryMetadata.firstLevelFiles
-	st.manifest = directoryMetadata.manifest
+	st.levels = directoryMetadata.levels
+	st.nextFileId = directoryMetadata.nextFileId
+	st.minUnflushedWalSegmentId = directoryMetadata.minUnflushedWalSegmentId
+	st.lastSequence = directoryMetadata.lastSequence
+	st.manifestLog = directoryMetadata.manifestLog
+	return &st, nil
+}
 
-	if st.skipIndex {
-		return &st, err
+// Close closes all the sstable files and the manifest log.
+func (st *SsTable) Close() {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	for _, files := range st.levels {
+		for _, fileMetadata := range files {
+			fileMetadata.file.Close()
+		}
 	}
-	indexOffsets, indexBlocks, err := st.buildIndexes(st.firstLevelFiles)
-	st.indexBlocks = indexBlocks
-	st.indexOffsets = indexOffsets
-	return &st, err
+	st.manifestLog.Close()
 }
 
-// create a new first level file
+// create a new file. its level is decided once it is written.
 func (st *SsTable) NewFile() (*os.File, error) {
 	if err := os.MkdirAll(st.dataFilesDirectory, 0755); err != nil {
 		return nil, err
 	}
 	st.mutex.Lock()
-	id := st.manifest.NextFileId
-	st.manifest.NextFileId++
+	id := st.nextFileId
+	st.nextFileId++
 	st.mutex.Unlock()
 	ssTableFilePath := fmt.Sprintf("%s/%d.log", st.dataFilesDirectory, id)
-	return os.OpenFile(ssTableFilePath, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0644)
+	// O_EXCL as an existing file must never be appended to
+	return os.OpenFile(ssTableFilePath, os.O_APPEND|os.O_CREATE|os.O_EXCL|os.O_RDWR, 0644)
 }
 
 // Write writes a stream of key, value pairs to the required file as per the format
-// of SSTable file which is [data-block(s)][index-block][footer].
+// of SSTable file which is [data-block(s)][index-block][bloom-filter-block][footer].
 // It calls the iteratorFunc function to get a stream of key, value pairs from a source.
-// example: 1. MemTable OR 2. firstLevelFiles which need to be merged and compacted.
-// It also updates the internal structs for firstLevelFiles, indexBlocks, manifest files and indexOffsets
-func (st *SsTable) Write(file *os.File, iteratorFunc func(fn func(key, value string))) error {
-	indexOffset, indexBlock, err := st.writeToFile(file, iteratorFunc)
+// example: MemTable. the keys must be internal keys in sorted order.
+// The file is added as the newest level 0 file and the manifest is updated.
+func (st *SsTable) Write(file *os.File, iteratorFunc func(fn func(key, value string, tombstone bool))) error {
+	return st.writeLevelZeroFile(file, iteratorFunc, versionEdit{})
+}
+
+// FlushMemtable is similar to Write, but the manifest edit adding the file also records that the wal
+// segments up to flushedWalSegmentId are flushed. those segments can be deleted once it returns.
+// lastSequence is the sequence number of the newest write of the memtable, it is recovered on startup
+// even if every wal segment is removed.
+func (st *SsTable) FlushMemtable(file *os.File, iteratorFunc func(fn func(key, value string, tombstone bool)),
+	flushedWalSegmentId int, lastSequence uint64) error {
+	return st.writeLevelZeroFile(file, iteratorFunc, versionEdit{
+		minUnflushedWalSegmentId: flushedWalSegmentId + 1,
+		lastSequence:             lastSequence,
+	})
+}
+
+func (st *SsTable) writeLevelZeroFile(file *os.File, iteratorFunc func(fn func(key, value string, tombstone bool)), edit versionEdit) error {
+	fileMetadata, err := st.writeToFile(file, iteratorFunc)
 	if err != nil {
 		return err
 	}
 
 	st.mutex.Lock()
-	st.firstLevelFiles = append(st.firstLevelFiles, file)
-	if !st.skipIndex {
-		st.indexBlocks = append(st.indexBlocks, indexBlock)
+	defer st.mutex.Unlock()
+	edit.addedFiles = []manifestFile{newManifestFile(fileMetadata, 0)}
+	if err := st.logEdit(edit); err != nil {
+		return err
 	}
-	st.manifest.FileNames = append(st.manifest.FileNames, file.Name())
-	st.indexOffsets = append(st.indexOffsets, indexOffset)
-
-	st.saveManifest()
-	st.mutex.Unlock()
+	st.levels[0] = append(st.levels[0], fileMetadata)
+	st.minUnflushedWalSegmentId = max(st.minUnflushedWalSegmentId, edit.minUnflushedWalSegmentId)
+	st.lastSequence = max(st.lastSequence, edit.lastSequence)
 	return nil
 }
 
+// LastSequence returns the sequence number of the newest write flushed to the files.
+func (st *SsTable) LastSequence() uint64 {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	return st.lastSequence
+}
+
+// SetLiveSnapshotsFunc sets the func which compaction calls to get the sequence numbers of the open snapshots.
+// the versions of a key which any of them can read are kept, without it only the newest version is kept.
+func (st *SsTable) SetLiveSnapshotsFunc(liveSnapshots func() []uint64) {
+	st.mutex.Lock()
+	defer st.mutex.Unlock()
+	st.liveSnapshots = liveSnapshots
+}
+
+// MinUnflushedWalSegmentId returns the oldest wal segment whose writes are not flushed to the files yet.
+// the older segments must not be replayed, their writes can be older than the writes in the files.
+func (st *SsTable) MinUnflushedWalSegmentId() int {
+	st.mutex.RLock()
+	defer st.mutex.RUnlock()
+	return st.minUnflushedWalSegmentId
+}
+
 // Similar to Write function, but it doesn't update internal structs
 // Write writes a stream of key, value pairs to the required file as per the format
-// of SSTable file which is [data-block(s)][index-block][footer].
+// of SSTable file which is [data-block(s)][index-block][bloom-filter-block][footer].
 // It calls the iteratorFunc function to get a stream of key, value pairs from a source.
-// example: 1. MemTable OR 2. firstLevelFiles which need to be merged and compacted.
-// returns the index block and indexOffset after writing to file.
-func (st *SsTable) writeToFile(file *os.File, iteratorFunc func(fn func(key, value string))) (int, []indexBlockEntry, error) {
-	indexOffset, indexBlock, err := st.writeDataBlocks(file, iteratorFunc)
+// example: 1. MemTable OR 2. files which need to be merged and compacted.
+// returns the metadata of the written file: key range, size, index block, bloom filter and indexOffset.
+func (st *SsTable) writeToFile(file *os.File, iteratorFunc func(fn func(key, value string, tombstone bool))) (*fileMetadata, error) {
+	fileMetadata := &fileMetadata{file: file, formatVersion: footerFormatVersion}
+	keyHashes := []uint32{}
+	var keyErr error
+	// keys are received in sorted order, so the first user key is the min key and the last one is the max key.
+	trackKeyRange := func(fn func(key, value string, tombstone bool)) {
+		iteratorFunc(func(key, value string, tombstone bool) {
+			if keyErr != nil {
+				return
+			}
+			userKey, _, err := internalkey.Parse(key)
+			if err != nil {
+				keyErr = fmt.Errorf("%w: %q", err, key)
+				return
+			}
+			if fileMetadata.minKey == "" {
+				fileMetadata.minKey = userKey
+			}
+			fileMetadata.maxKey = userKey
+			// the bloom filter is checked with the user key, a Get doesn't know the sequence number
+			// of the version it finds. tombstones are also added, a Get needs to find them to stop
+			// searching older files.
+			keyHashes = append(keyHashes, bloomHash(userKey))
+			fn(key, value, tombstone)
+		})
+	}
+	indexOffset, indexBlock, err := st.writeDataBlocks(file, trackKeyRange)
+	if err == nil {
+		err = keyErr
+	}
 	if err != nil {
-		return 0, nil, err
+		return nil, err
 	}
+	fileMetadata.indexOffset = indexOffset
+	fileMetadata.indexBlock = indexBlock
 	if !st.skipIndex {
-		if err = st.writeIndexBlock(file, indexBlock); err != nil {
-			return 0, nil, err
+		indexBlockLength, err := st.writeIndexBlock(file, indexBlock)
+		if err != nil {
+			return nil, err
+		}
+		fileMetadata.bloomFilter = buildBloomFilter(keyHashes, st.bloomBitsPerKey)
+		if _, err = file.Write(encodeBlock(fileMetadata.bloomFilter)); err != nil {
+			return nil, err
 		}
-		if err = st.writeFooter(file, indexOffset); err != nil {
-			return 0, nil, err
+		if err = st.writeFooter(file, indexOffset, indexOffset+indexBlockLength); err != nil {
+			return nil, err
 		}
 	}
-	return indexOffset, indexBlock, err
+	// the file must be durable before the manifest refers to it
+	if err = file.Sync(); err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	fileMetadata.size = info.Size()
+	return fileMetadata, nil
 }
 
-func (st *SsTable) writeFooter(file *os.File, indexBlockStartOffset int) error {
-	footerBuf := make([]byte, 4)
+// footer: [index_block_offset][bloom_filter_block_offset][format_version][magic_number]
+func (st *SsTable) writeFooter(file *os.File, indexBlockStartOffset, bloomFilterStartOffset int) error {
+	footerBuf := make([]byte, footerLength)
 	binary.BigEndian.PutUint32(footerBuf[0:4], uint32(indexBlockStartOffset))
+	binary.BigEndian.PutUint32(footerBuf[4:8], uint32(bloomFilterStartOffset))
+	binary.BigEndian.PutUint32(footerBuf[8:12], footerFormatVersion)
+	binary.BigEndian.PutUint32(footerBuf[12:16], footerMagicNumber)
 	_, err := file.Write(footerBuf)
 	return err
 }
 
 // writeDataBlocks breaks down the blocks into blocks of fixed size as defined in ssTable.blockLength.
 // the last block might have lesser blockLength.
+// each data block is written as [length][payload][checksum] where payload is the list of entries.
 // It also returns:
 // 1. Offset from which the index block should be written. This is also important to be tracked in the file footer.
 // 2. A struct slice for the index block entries which is next written to the ssTable file.
-func (st *SsTable) writeDataBlocks(file *os.File, iteratorFunc func(fn func(key, value string))) (int,
+func (st *SsTable) writeDataBlocks(file *os.File, iteratorFunc func(fn func(key, value string, tombstone bool))) (int,
 	[]indexBlockEntry, error) {
-	blockLength := 0
-	blockStartOffset := 0
 	blockFirstKey := ""
 	ssTableBlockBuf := []byte{}
 	offset := 0
@@ -160,231 +299,309 @@ func (st *SsTable) writeDataBlocks(file *os.File, iteratorFunc func(fn func(key,
 
 	var err error
 
-	iteratorFunc(func(key, value string) {
+	writeBlock := func() {
+		indexBlock = append(indexBlock, indexBlockEntry{
+			key:    blockFirstKey,
+			offset: offset,
+		})
+		n, writeErr := file.Write(encodeBlock(ssTableBlockBuf))
+		if writeErr != nil {
+			err = writeErr
+		}
+		offset += n
+
+		// start new block
+		blockFirstKey = ""
+		ssTableBlockBuf = []byte{}
+	}
+
+	iteratorFunc(func(key, value string, tombstone bool) {
+		// no more writes once a block write has failed
+		if err != nil {
+			return
+		}
 		if blockFirstKey == "" {
 			blockFirstKey = key
 		}
-		// write byte array
-		// todo: checksum to be added later
 		// [length_of_key][key][length_of_value][value]
-		ssTableEntryBuf := []byte{}
-		ssTableEntryBuf = binary.BigEndian.AppendUint32(ssTableEntryBuf, uint32(len(key)))
-		ssTableEntryBuf = append(ssTableEntryBuf, []byte(key)...)
-		ssTableEntryBuf = binary.BigEndian.AppendUint32(ssTableEntryBuf, uint32(len(value)))
-		ssTableEntryBuf = append(ssTableEntryBuf, []byte(value)...)
-		offset += len(ssTableEntryBuf)
-		blockLength += len(ssTableEntryBuf)
-		ssTableBlockBuf = append(ssTableBlockBuf, ssTableEntryBuf...)
-		if blockLength > st.blockLength {
+		// for a tombstone, length_of_value is tombstoneValueLength and value is skipped.
+		ssTableBlockBuf = binary.BigEndian.AppendUint32(ssTableBlockBuf, uint32(len(key)))
+		ssTableBlockBuf = append(ssTableBlockBuf, []byte(key)...)
+		if tombstone {
+			ssTableBlockBuf = binary.BigEndian.AppendUint32(ssTableBlockBuf, tombstoneValueLength)
+		} else {
+			ssTableBlockBuf = binary.BigEndian.AppendUint32(ssTableBlockBuf, uint32(len(value)))
+			ssTableBlockBuf = append(ssTableBlockBuf, []byte(value)...)
+		}
+		if len(ssTableBlockBuf) > st.blockLength {
 			// one data block completed
-
-			indexBlock = append(indexBlock, indexBlockEntry{
-				key:    blockFirstKey,
-				offset: blockStartOffset,
-			})
-
-			// write this data block to the file
-			// todo: change data block entry to [length][payload][checksum]
-			// instead of "PUT key value\n"
-			if _, err = file.Write(ssTableBlockBuf); err != nil {
-				// todo: add some break statement
-				// break
-			}
-
-			// start new block
-			blockStartOffset = offset
-			blockFirstKey = ""
-			blockLength = 0
-			ssTableBlockBuf = []byte{}
+			writeBlock()
 		}
 	})
 
 	// add last data block
-	if blockFirstKey != "" {
-		indexBlock = append(indexBlock, indexBlockEntry{
-			key:    blockFirstKey,
-			offset: blockStartOffset,
-		})
-		_, err = file.Write(ssTableBlockBuf)
+	if blockFirstKey != "" && err == nil {
+		writeBlock()
 	}
 	return offset, indexBlock, err
 }
 
-func (st *SsTable) writeIndexBlock(file *os.File, indexBlock []indexBlockEntry) error {
+// index block payload: [key_length_1][key_1][offset_1][key_length_2][key_2][offset_2]...
+// returns the number of bytes written for the index block.
+func (st *SsTable) writeIndexBlock(file *os.File, indexBlock []indexBlockEntry) (int, error) {
+	indexBuf := []byte{}
 	for _, ib := range indexBlock {
-		keyLength := len(ib.key)
-		indexBuf := make([]byte, 4+keyLength+4)
-		binary.BigEndian.PutUint32(indexBuf[0:4], uint32(keyLength))
-		copy(indexBuf[4:4+keyLength], []byte(ib.key))
-		binary.BigEndian.PutUint32(indexBuf[4+keyLength:], uint32(ib.offset))
-		if _, err := file.Write(indexBuf); err != nil {
-			return err
-		}
+		indexBuf = binary.BigEndian.AppendUint32(indexBuf, uint32(len(ib.key)))
+		indexBuf = append(indexBuf, []byte(ib.key)...)
+		indexBuf = binary.BigEndian.AppendUint32(indexBuf, uint32(ib.offset))
 	}
-	return nil
+	return file.Write(encodeBlock(indexBuf))
 }
 
 // Gets the following metadata:
-// 1. Reads manifest JSON to get the nextFileId and expected order of files. Populate in
-// directoryMetadata.manifest.
-// 2. Opens all sstable log files and populates in directoryMetadata.firstLevelFiles
+// 1. Replays the manifest log to get the nextFileId, the level and key range of every file and the
+// expected order of level 0 files.
+// 2. Removes the orphaned sstable files which the manifest doesn't list and starts a new manifest log.
+// Populate in directoryMetadata.nextFileId and directoryMetadata.manifestLog.
+// 3. Opens all sstable log files, builds their indexes and populates in directoryMetadata.levels
 func (st *SsTable) getDirectoryMetadata() (directoryMetadata *SsTable, err error) {
-	directoryMetadata = &SsTable{}
+	directoryMetadata = &SsTable{levels: make([][]*fileMetadata, numLevels)}
 	if err := os.MkdirAll(st.dataFilesDirectory, 0755); err != nil {
 		return nil, err
 	}
-	manifest, err := st.getManifest()
+	manifest, complete, err := st.getManifest()
 	if err != nil {
 		return nil, err
 	}
-	directoryMetadata.manifest = *manifest
-
-	ssTableFiles, err := st.getAllFiles(directoryMetadata.manifest.FileNames)
+	directoryMetadata.nextFileId = manifest.NextFileId
+	directoryMetadata.minUnflushedWalSegmentId = manifest.MinUnflushedWalSegmentId
+	directoryMetadata.lastSequence = manifest.LastSequence
+	// an unreadable edit might have added files, those are kept till the next startup.
+	// new files must not reuse their ids.
+	if complete {
+		if err := st.removeOrphanedFiles(manifest); err != nil {
+			return nil, err
+		}
+	} else {
+		highestFileId, err := st.highestFileId()
+		if err != nil {
+			return nil, err
+		}
+		directoryMetadata.nextFileId = max(directoryMetadata.nextFileId, highestFileId+1)
+	}
+	directoryMetadata.manifestLog, err = st.rewriteManifest(manifest)
 	if err != nil {
 		return nil, err
 	}
-	directoryMetadata.firstLevelFiles = ssTableFiles
-	return directoryMetadata, nil
-}
 
-// builds all of the indexes from the ss-table files.
-// returns: array of indexOffsets and array of indexBlock.
-// an indexBlock is denoted by an array of indexBlockEntry.
-func (st *SsTable) buildIndexes(files []*os.File) ([]int, [][]indexBlockEntry, error) {
-	ssTableIndexes := [][]indexBlockEntry{}
-	indexOffsets := []int{}
-	for _, file := range files {
-		indexOffset, ssTableIndex, err := st.buildIndexFromFile(file)
+	for _, manifestFile := range manifest.Files {
+		fileMetadata, err := st.openFile(manifestFile)
 		if err != nil {
-			return nil, nil, err
+			return nil, err
 		}
-		ssTableIndexes = append(ssTableIndexes, ssTableIndex)
-		indexOffsets = append(indexOffsets, indexOffset)
+		directoryMetadata.levels[manifestFile.Level] = append(directoryMetadata.levels[manifestFile.Level], fileMetadata)
+	}
+	for level := 1; level < numLevels; level++ {
+		sortByMinKey(directoryMetadata.levels[level])
 	}
-	return indexOffsets, ssTableIndexes, nil
+	return directoryMetadata, nil
 }
 
-func (st *SsTable) getIndexOffset(file *os.File) (uint32, error) {
-	info, err := os.Stat(file.Name())
-	fileSize := info.Size()
-	footerOffset := fileSize - 4
-	indexOffsetBuf := make([]byte, 4)
-	if _, err = file.ReadAt(indexOffsetBuf, footerOffset); err != nil {
-		return 0, err
+// opens a file listed in the manifest and loads its index block and bloom filter in-memory.
+func (st *SsTable) openFile(manifestFile manifestFile) (*fileMetadata, error) {
+	if manifestFile.Level < 0 || manifestFile.Level >= numLevels {
+		return nil, fmt.Errorf("invalid level %d for file %s in manifest", manifestFile.Level, manifestFile.Name)
 	}
-	return binary.BigEndian.Uint32(indexOffsetBuf), nil
+	filePath := filepath.Join(st.dataFilesDirectory, manifestFile.Name)
+	if !st.skipIndex {
+		if err := st.upgradeLegacyFile(filePath); err != nil {
+			return nil, err
+		}
+	}
+	file, err := os.OpenFile(filePath, os.O_RDONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	fileMetadata := &fileMetadata{
+		file:          file,
+		minKey:        string(manifestFile.MinKey),
+		maxKey:        string(manifestFile.MaxKey),
+		size:          info.Size(),
+		formatVersion: footerFormatVersion,
+	}
+	if st.skipIndex {
+		return fileMetadata, nil
+	}
+	fileMetadata.indexOffset, fileMetadata.indexBlock, fileMetadata.bloomFilter, fileMetadata.formatVersion, err = st.buildIndexFromFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return fileMetadata, nil
 }
 
-// reads the index block from file and populates it in-memory.
-// stores both the index offset and the entire index block in-memory.
-func (st *SsTable) buildIndexFromFile(file *os.File) (int, []indexBlockEntry, error) {
-	// 1. get the index offset
+// reads the footer and returns the index block offset and the bloom filter block offset.
+// also returns the footer offset which marks the end of the bloom filter block and the format version.
+func (st *SsTable) readFooter(file *os.File) (indexOffset, bloomFilterOffset, footerOffset int64, formatVersion int, err error) {
 	info, err := os.Stat(file.Name())
 	if err != nil {
-		return 0, nil, err
+		return 0, 0, 0, 0, err
+	}
+	footerOffset = info.Size() - footerLength
+	if footerOffset < 0 {
+		return 0, 0, 0, 0, newCorruptionError(file, 0, "file is smaller than the footer")
+	}
+	footerBuf := make([]byte, footerLength)
+	if _, err = file.ReadAt(footerBuf, footerOffset); err != nil {
+		return 0, 0, 0, 0, err
 	}
-	fileSize := info.Size()
-	indexOffset, err := st.getIndexOffset(file)
+	if binary.BigEndian.Uint32(footerBuf[12:16]) != footerMagicNumber {
+		return 0, 0, 0, 0, newCorruptionError(file, footerOffset, "magic number mismatch")
+	}
+	formatVersion = int(binary.BigEndian.Uint32(footerBuf[8:12]))
+	if formatVersion != footerFormatVersion && formatVersion != footerFormatVersionUserKeys {
+		return 0, 0, 0, 0, newCorruptionError(file, footerOffset, fmt.Sprintf("unsupported format version %d", formatVersion))
+	}
+	indexOffset = int64(binary.BigEndian.Uint32(footerBuf[0:4]))
+	bloomFilterOffset = int64(binary.BigEndian.Uint32(footerBuf[4:8]))
+	if indexOffset > bloomFilterOffset || bloomFilterOffset > footerOffset {
+		return 0, 0, 0, 0, newCorruptionError(file, footerOffset, "footer offsets are out of range")
+	}
+	return indexOffset, bloomFilterOffset, footerOffset, formatVersion, nil
+}
+
+// reads the index block and bloom filter block from file and populates it in-memory.
+// stores the index offset, the entire index block, the bloom filter and the format version in-memory.
+// the keys of the index block are returned as internal keys even for the files storing user keys.
+func (st *SsTable) buildIndexFromFile(file *os.File) (int, []indexBlockEntry, []byte, int, error) {
+	// 1. get the index offset
+	indexOffset, bloomFilterOffset, footerOffset, formatVersion, err := st.readFooter(file)
 	if err != nil {
-		return 0, nil, err
+		return 0, nil, nil, 0, err
 	}
-	// todo: store index offset in-memory
 
 	// 2. load index in-memory
-	// 2.1 read index byte array
-	indexBlockLength := (fileSize - 4) - int64(indexOffset)
-	indexBlockBuf := make([]byte, indexBlockLength)
-	if _, err = file.ReadAt(indexBlockBuf, int64(indexOffset)); err != nil {
-		return 0, nil, err
+	// 2.1 read and verify the index block
+	indexBlockBuf, err := readBlock(file, indexOffset, bloomFilterOffset)
+	if err != nil {
+		return 0, nil, nil, 0, err
 	}
+	indexBlockLength := len(indexBlockBuf)
+	corruptedIndexErr := newCorruptionError(file, indexOffset, errWhileReadingIndexBlock+": "+potentialIndexBlockCorrupted)
 
 	// 2.2 read keys and offsets from the index block and create in-memory index
 	ssTableIndex := []indexBlockEntry{}
-	for i := 0; i < int(indexBlockLength); {
+	for i := 0; i < indexBlockLength; {
 		// read first 4 bytes to get length
-		keyLengthBuf := indexBlockBuf[i : i+4]
-		keyLength := binary.BigEndian.Uint32(keyLengthBuf)
+		if i+4 > indexBlockLength {
+			return 0, nil, nil, 0, corruptedIndexErr
+		}
+		keyLength := int(binary.BigEndian.Uint32(indexBlockBuf[i : i+4]))
 
 		// read next keyLength bytes
 		i += 4
-		if i >= int(indexBlockLength) {
-			return 0, nil, errors.New(errWhileReadingIndexBlock + ": " + potentialIndexBlockCorrupted)
+		if i+keyLength > indexBlockLength {
+			return 0, nil, nil, 0, corruptedIndexErr
+		}
+		key := string(indexBlockBuf[i : i+keyLength])
+		if formatVersion == footerFormatVersionUserKeys {
+			key = internalkey.Make(key, 0)
 		}
-		key := string(indexBlockBuf[i : i+int(keyLength)])
 
 		// read offset
-		i += int(keyLength)
-		if i >= int(indexBlockLength) {
-			return 0, nil, errors.New(errWhileReadingIndexBlock + ": " + potentialIndexBlockCorrupted)
+		i += keyLength
+		if i+4 > indexBlockLength {
+			return 0, nil, nil, 0, corruptedIndexErr
 		}
-		offsetBuf := indexBlockBuf[i : i+4]
-		offset := binary.BigEndian.Uint32(offsetBuf)
+		offset := binary.BigEndian.Uint32(indexBlockBuf[i : i+4])
 
 		ssTableIndex = append(ssTableIndex, indexBlockEntry{key: key, offset: int(offset)})
 		i += 4
 	}
-	return int(indexOffset), ssTableIndex, nil
+
+	// 3. load bloom filter in-memory
+	bloomFilter, err := readBlock(file, bloomFilterOffset, footerOffset)
+	if err != nil {
+		return 0, nil, nil, 0, err
+	}
+	return int(indexOffset), ssTableIndex, bloomFilter, formatVersion, nil
 }
 
+// Version is a single version of a key.
+type Version struct {
+	Value     string
+	Tombstone bool
+	Sequence  uint64
+}
+
+// Get returns the most recent value for the key across all files.
+// An empty value is returned if the key is not found or its most recent entry is a tombstone.
 func (st *SsTable) Get(key string) (string, error) {
+	version, _, err := st.GetVersion(key, internalkey.MaxSequence)
+	if err != nil || version.Tombstone {
+		return "", err
+	}
+	return version.Value, nil
+}
+
+// GetVersion returns the newest version of the key written at or before the sequence. false is
+// returned if no file has such a version. the version can be a tombstone.
+// All level 0 files are checked from the newest to the oldest one, after that at most
+// one file is checked per level. a newer file only has newer versions of a key than an older file,
+// hence the first version found is the newest one.
+func (st *SsTable) GetVersion(key string, sequence uint64) (Version, bool, error) {
 	st.mutex.RLock()
 	defer st.mutex.RUnlock()
 	if st.skipIndex {
-		return st.linearSearch(key)
-	}
-	// newest file to oldest file
-	for i := len(st.firstLevelFiles) - 1; i >= 0; i-- {
-		file := st.firstLevelFiles[i]
-		ssTableIndex := st.indexBlocks[i]
-		lowerBoundSliceIndex := getLowerBound(key, ssTableIndex)
-		if lowerBoundSliceIndex == -1 {
-			continue
-		}
-		endOffset := st.indexOffsets[i]
-		if lowerBoundSliceIndex < len(ssTableIndex)-1 {
-			endOffset = ssTableIndex[lowerBoundSliceIndex+1].offset
+		return st.linearSearch(key, sequence)
+	}
+	filesToSearch := []*fileMetadata{}
+	for i := len(st.levels[0]) - 1; i >= 0; i-- {
+		filesToSearch = append(filesToSearch, st.levels[0][i])
+	}
+	for level := 1; level < numLevels; level++ {
+		if fileMetadata := findFileInLevel(st.levels[level], key); fileMetadata != nil {
+			filesToSearch = append(filesToSearch, fileMetadata)
 		}
-		value, err := st.getValueFromSsTableDataBlock(file, key,
-			ssTableIndex[lowerBoundSliceIndex].offset, endOffset)
-		if value == "" && err == nil {
-			continue
+	}
+	for _, fileMetadata := range filesToSearch {
+		version, found, err := st.getFromFile(fileMetadata, key, sequence)
+		if err != nil || found {
+			return version, found, err
 		}
-		return value, err
 	}
-	return "", nil
+	return Version{}, false, nil
 }
 
-// given the prefix key, PrefixScan returns the serialised key
-// and value in a map for all keys which match that prefix in the sstable.
-func (st *SsTable) PrefixScan(prefixKey string) (map[string]string, error) {
-	st.mutex.RLock()
-	defer st.mutex.RUnlock()
-	tableMap := map[string]string{}
-	// newest file to oldest file
-	for i := len(st.firstLevelFiles) - 1; i >= 0; i-- {
-		file := st.firstLevelFiles[i]
-		ssTableIndex := st.indexBlocks[i]
-		lowerBoundSliceIndex := getLowerBound(prefixKey, ssTableIndex)
-		// means that even the first key prefix >= prefix in tableKey
-		if lowerBoundSliceIndex == -1 {
-			// if prefix doesn't match for the first key, no need to read this file
-			if len(ssTableIndex) == 0 || !strings.HasPrefix(ssTableIndex[0].key, prefixKey) {
-				continue
-			}
-			// if prefix matches, we need to read the entire file till we encounter a different prefix
-			lowerBoundSliceIndex = 0
-		}
-		// endOffset would be the start of index block
-		endOffset := st.indexOffsets[i]
-
-		var err error
-		tableMap, err = st.sequentiallyScanTableAndUpdateMap(file, prefixKey,
-			ssTableIndex[lowerBoundSliceIndex].offset, endOffset, tableMap)
-		if err != nil {
-			return nil, err
-		}
+// returns false if the file has no version of the key written at or before the sequence.
+func (st *SsTable) getFromFile(fileMetadata *fileMetadata, key string, sequence uint64) (Version, bool, error) {
+	// skip reading the data block if the key is definitely not present in the file
+	if !st.skipBloomFilter && !bloomFilterMayContain(fileMetadata.bloomFilter, key) {
+		return Version{}, false, nil
+	}
+	// the versions of the key can continue in the next data block, hence the file is read with an iterator.
+	// the iterator shares the file handle with other reads, so it must not be closed.
+	it := &fileIterator{
+		file:          fileMetadata.file,
+		indexBlock:    fileMetadata.indexBlock,
+		indexOffset:   fileMetadata.indexOffset,
+		formatVersion: fileMetadata.formatVersion,
+	}
+	it.Seek(internalkey.Make(key, sequence))
+	if !it.Valid() {
+		return Version{}, false, it.Error()
+	}
+	userKey, versionSequence, err := internalkey.Parse(it.Key())
+	if err != nil {
+		return Version{}, false, newCorruptionError(fileMetadata.file, int64(it.indexBlock[it.blockIdx].offset), err.Error())
+	}
+	if userKey != key {
+		return Version{}, false, nil
 	}
-	return tableMap, nil
+	return Version{Value: it.Value(), Tombstone: it.Tombstone(), Sequence: versionSequence}, true, nil
 }
 
 func extractValueFromSsTable(ssTableDataBlockBuf []byte, i int) (string, error) {
@@ -399,66 +616,30 @@ func extractValueFromSsTable(ssTableDataBlockBuf []byte, i int) (string, error)
 	return string(ssTableDataBlockBuf[i : i+int(keyLen)]), nil
 }
 
-func (st *SsTable) sequentiallyScanTableAndUpdateMap(ssTableFile *os.File, tableKey string,
-	dataBlockStartOffset, fileEndOffset int, tableMap map[string]string) (map[string]string, error) {
-	ssTableDataBlockBuf := make([]byte, fileEndOffset-dataBlockStartOffset)
-	_, err := ssTableFile.ReadAt(ssTableDataBlockBuf, int64(dataBlockStartOffset))
-	if err != nil && err != io.EOF {
-		return nil, err
+// readEntry reads the [length_of_key][key][length_of_value][value] entry starting at i.
+// returns the entry and the offset of the next entry. the key of a file storing user keys is
+// returned as an internal key.
+func readEntry(ssTableDataBlockBuf []byte, i int, formatVersion int) (entry, int, error) {
+	key, err := extractValueFromSsTable(ssTableDataBlockBuf, i)
+	if err != nil {
+		return entry{}, 0, err
 	}
-	for i := 0; i < len(ssTableDataBlockBuf); {
-		key, err := extractValueFromSsTable(ssTableDataBlockBuf, i)
-		if err != nil {
-			return nil, err
-		}
-		i += (4 + len(key))
-		value, err := extractValueFromSsTable(ssTableDataBlockBuf, i)
-		if err != nil {
-			return nil, err
-		}
-		i += (4 + len(value))
-
-		fmt.Printf("key3333: %+v\n", key)
-		fmt.Printf("value3333: %+v\n", value)
-		if strings.HasPrefix(key, tableKey) {
-			// only set the key value pair if the key is not found
-			// this is because we are sequentially going through the newest file first
-			if _, ok := (tableMap[key]); !ok {
-				fmt.Printf("REACH_22222 %v %v\n", key, value)
-				tableMap[key] = value
-			}
-		} else {
-			keyPrefix := key[0:min(len(tableKey), len(key))]
-			if keyPrefix > tableKey {
-				return tableMap, nil
-			}
-		}
+	i += (4 + len(key))
+	if formatVersion == footerFormatVersionUserKeys {
+		key = internalkey.Make(key, 0)
 	}
-	return tableMap, nil
-}
-
-func (st *SsTable) getValueFromSsTableDataBlock(ssTableFile *os.File, key string, dataBlockStartOffset, dataBlockEndOffset int) (string, error) {
-	ssTableDataBlockBuf := make([]byte, dataBlockEndOffset-dataBlockStartOffset+1)
-	_, err := ssTableFile.ReadAt(ssTableDataBlockBuf, int64(dataBlockStartOffset))
-	if err != nil && err != io.EOF {
-		return "", err
+	if i+4 > len(ssTableDataBlockBuf) {
+		return entry{}, 0, errors.New(errorWhileReadingSsTableDatablock)
 	}
-	for i := 0; i < len(ssTableDataBlockBuf); {
-		currentKey, err := extractValueFromSsTable(ssTableDataBlockBuf, i)
-		if err != nil {
-			return "", err
-		}
-		i += (4 + len(currentKey))
-		currentValue, err := extractValueFromSsTable(ssTableDataBlockBuf, i)
-		if err != nil {
-			return "", err
-		}
-		i += (4 + len(currentValue))
-		if currentKey == key {
-			return currentValue, nil
-		}
+	if binary.BigEndian.Uint32(ssTableDataBlockBuf[i:i+4]) == tombstoneValueLength {
+		return entry{key: key, tombstone: true}, i + 4, nil
+	}
+	value, err := extractValueFromSsTable(ssTableDataBlockBuf, i)
+	if err != nil {
+		return entry{}, 0, err
 	}
-	return "", nil
+	i += (4 + len(value))
+	return entry{key: key, value: value}, i, nil
 }
 
 func getLowerBound(key string, index []indexBlockEntry) int {
@@ -477,31 +658,52 @@ func getLowerBound(key string, index []indexBlockEntry) int {
 	return lowerBoundSliceIndex
 }
 
-func (st *SsTable) linearSearch(key string) (string, error) {
-	for i := len(st.firstLevelFiles) - 1; i >= 0; i-- {
-		file := st.firstLevelFiles[i]
-		value, err := st.linearSearchFile(file, key)
-		if err != nil || value != "" {
-			return value, err
+func (st *SsTable) linearSearch(key string, sequence uint64) (Version, bool, error) {
+	for _, fileMetadata := range st.filesNewestFirst() {
+		version, found, err := st.linearSearchFile(fileMetadata.file, key, sequence)
+		if err != nil || found {
+			return version, found, err
 		}
 	}
-	return "", nil
+	return Version{}, false, nil
 }
 
-func (st *SsTable) linearSearchFile(file *os.File, key string) (string, error) {
-	stat, _ := file.Stat()
-	fileSize := stat.Size()
-	buf := make([]byte, fileSize)
-	_, err := file.Read(buf)
-	if err != nil && err != io.EOF {
-		return "", err
+// without the index, the file only consists of data blocks. hence every block is read using
+// the length stored in its header. the versions are sorted from the newest to the oldest one,
+// so the first one written at or before the sequence is returned.
+func (st *SsTable) linearSearchFile(file *os.File, key string, sequence uint64) (Version, bool, error) {
+	stat, err := file.Stat()
+	if err != nil {
+		return Version{}, false, err
 	}
-	entries := strings.Split(string(buf), "\n")
-	for _, payload := range entries {
-		cmds := strings.Split(payload, " ")
-		if cmds[1] == key {
-			return cmds[2], nil
+	fileSize := stat.Size()
+	var found *Version
+	var parseErr error
+	for offset := int64(0); offset < fileSize && found == nil && parseErr == nil; {
+		lengthBuf := make([]byte, blockHeaderLength)
+		if _, err := file.ReadAt(lengthBuf, offset); err != nil {
+			return Version{}, false, newCorruptionError(file, offset, "incomplete block length")
+		}
+		endOffset := offset + blockHeaderLength + int64(binary.BigEndian.Uint32(lengthBuf)) + blockTrailerLength
+		err := readBlockEntries(file, offset, endOffset, footerFormatVersion, func(e entry) bool {
+			userKey, versionSequence, err := internalkey.Parse(e.key)
+			if err != nil {
+				parseErr = newCorruptionError(file, offset, err.Error())
+				return false
+			}
+			if userKey == key && versionSequence <= sequence {
+				found = &Version{Value: e.value, Tombstone: e.tombstone, Sequence: versionSequence}
+				return false
+			}
+			return true
+		})
+		if err != nil {
+			return Version{}, false, err
 		}
+		offset = endOffset
+	}
+	if parseErr != nil || found == nil {
+		return Version{}, false, parseErr
 	}
-	return "", nil
+	return *found, true, nil
 }
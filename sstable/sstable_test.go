@@ -0,0 +1,123 @@
+package sstable
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/golang-db/internalkey"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetVersionReturnsNewestVersionAtSequence(t *testing.T) {
+	st, err := NewSsTable(Config{DataFilesDirectory: t.TempDir()})
+	require.NoError(t, err)
+	defer st.Close()
+	file, err := st.NewFile()
+	require.NoError(t, err)
+	// enough versions of key_1 to span multiple data blocks
+	require.NoError(t, st.Write(file, func(fn func(key, value string, tombstone bool)) {
+		fn(internalkey.Make("key_0", 1), "key_0@1", false)
+		for sequence := uint64(40); sequence >= 10; sequence -= 2 {
+			fn(internalkey.Make("key_1", sequence), fmt.Sprintf("key_1@%d", sequence), false)
+		}
+		fn(internalkey.Make("key_1", 5), "", true)
+		fn(internalkey.Make("key_1", 3), "key_1@3", false)
+		fn(internalkey.Make("key_2", 8), "key_2@8", false)
+	}))
+	require.Greater(t, len(st.levels[0][0].indexBlock), 2)
+
+	version, found, err := st.GetVersion("key_1", 25)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, Version{Value: "key_1@24", Sequence: 24}, version)
+
+	version, found, err = st.GetVersion("key_1", 9)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, Version{Tombstone: true, Sequence: 5}, version)
+
+	version, found, err = st.GetVersion("key_1", 4)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, "key_1@3", version.Value)
+
+	_, found, err = st.GetVersion("key_1", 2)
+	require.NoError(t, err)
+	assert.False(t, found)
+	_, found, err = st.GetVersion("key_2", 7)
+	require.NoError(t, err)
+	assert.False(t, found)
+
+	value, err := st.Get("key_1")
+	require.NoError(t, err)
+	assert.Equal(t, "key_1@40", value)
+}
+
+// rewrites the file in the format written before sequence numbers were added: the entries and the
+// index block store the user keys and the footer has format version 1.
+func rewriteAsUserKeysFile(t *testing.T, st *SsTable, fileName string, keyValues [][2]string) {
+	file, err := os.OpenFile(fileName, os.O_TRUNC|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	defer file.Close()
+	indexOffset, indexBlock, err := st.writeDataBlocks(file, func(fn func(key, value string, tombstone bool)) {
+		for _, keyValue := range keyValues {
+			fn(keyValue[0], keyValue[1], false)
+		}
+	})
+	require.NoError(t, err)
+	indexBlockLength, err := st.writeIndexBlock(file, indexBlock)
+	require.NoError(t, err)
+	keyHashes := []uint32{}
+	for _, keyValue := range keyValues {
+		keyHashes = append(keyHashes, bloomHash(keyValue[0]))
+	}
+	_, err = file.Write(encodeBlock(buildBloomFilter(keyHashes, st.bloomBitsPerKey)))
+	require.NoError(t, err)
+	footerBuf := binary.BigEndian.AppendUint32(nil, uint32(indexOffset))
+	footerBuf = binary.BigEndian.AppendUint32(footerBuf, uint32(indexOffset+indexBlockLength))
+	footerBuf = binary.BigEndian.AppendUint32(footerBuf, footerFormatVersionUserKeys)
+	footerBuf = binary.BigEndian.AppendUint32(footerBuf, footerMagicNumber)
+	_, err = file.Write(footerBuf)
+	require.NoError(t, err)
+}
+
+func TestFilesStoringUserKeysAreReadAsOldestVersions(t *testing.T) {
+	st := newSsTableForCompactionTest(t)
+	keyValues := [][2]string{}
+	for i := 0; i < 20; i++ {
+		keyValues = append(keyValues, [2]string{fmt.Sprintf("key_%03d", i), fmt.Sprintf("legacy_%03d", i)})
+	}
+	legacyFile := writeTestFile(t, st, "", len(keyValues))
+	rewriteAsUserKeysFile(t, st, legacyFile, keyValues)
+	st.Close()
+
+	reopened, err := NewSsTable(Config{DataFilesDirectory: st.dataFilesDirectory, TargetFileSize: 512})
+	require.NoError(t, err)
+	defer reopened.Close()
+	require.Equal(t, footerFormatVersionUserKeys, reopened.levels[0][0].formatVersion)
+	version, found, err := reopened.GetVersion("key_005", 0)
+	require.NoError(t, err)
+	require.True(t, found)
+	assert.Equal(t, Version{Value: "legacy_005"}, version)
+
+	// newer files win over the legacy file, also once they are compacted together
+	for i := 1; i < l0CompactionTrigger; i++ {
+		writeTestEntries(t, reopened, func(fn func(key, value string, tombstone bool)) {
+			fn(fmt.Sprintf("key_%03d", i), "new", false)
+		})
+	}
+	require.NoError(t, reopened.RunCompaction())
+	require.Empty(t, reopened.levels[0])
+	for i := 0; i < 20; i++ {
+		expected := fmt.Sprintf("legacy_%03d", i)
+		if i >= 1 && i < l0CompactionTrigger {
+			expected = "new"
+		}
+		value, err := reopened.Get(fmt.Sprintf("key_%03d", i))
+		require.NoError(t, err)
+		assert.Equal(t, expected, value)
+	}
+}
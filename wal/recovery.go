@@ -0,0 +1,152 @@
+package wal
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"log/slog"
+	"os"
+)
+
+// RecoveryMode decides how Replay handles records which can't be read.
+// a crash in the middle of a write leaves a partial record at the end of the file, a torn tail.
+// a bad disk or a bug can corrupt records anywhere in the file.
+type RecoveryMode int
+
+const (
+	// RecoveryStrict fails on the first record which can't be read.
+	RecoveryStrict RecoveryMode = iota
+	// RecoveryTolerateTail truncates the file at the end of the last good record, dropping
+	// everything after the first record which can't be read.
+	RecoveryTolerateTail
+	// RecoverySkipCorrupt skips the records which can't be read and continues with the next good record.
+	// bad bytes at the end of the file with no good record after them are truncated like a torn tail.
+	RecoverySkipCorrupt
+)
+
+// MaxPayloadLength is the largest payload of a record. a record with a longer payload can't be read back,
+// hence it is rejected on write with ErrPayloadTooLarge.
+const MaxPayloadLength = 1_000_000 // 1 MB max
+
+// ErrPayloadTooLarge is returned for a write of a payload longer than MaxPayloadLength. nothing is written then.
+var ErrPayloadTooLarge = errors.New("payload is larger than the max payload length of a record")
+
+// RecoveryReport lists what Replay dropped to recover the file.
+type RecoveryReport struct {
+	// DroppedTailBytes is the number of bytes truncated from the end of the file.
+	DroppedTailBytes int
+	SkippedRanges    []SkippedRange
+}
+
+// SkippedRange is a range of bad bytes in the middle of the file which was skipped.
+type SkippedRange struct {
+	Offset int
+	Length int
+	Reason string
+}
+
+var (
+	errIncompleteLength   = errors.New("partial write: incomplete length")
+	errIncompletePayload  = errors.New("partial write: incomplete payload")
+	errIncompleteChecksum = errors.New("partial write: incomplete checksum")
+	errLengthTooLarge     = errors.New("corrupt: length too large")
+	errChecksumMismatch   = errors.New("corrupt: checksum mismatch")
+)
+
+// IsIncompleteRecord returns true if the error is returned for a record cut short by the end of the file,
+// which is what a crash in the middle of writing the last record leaves behind. a record which is complete
+// but can't be read is corrupt instead.
+func IsIncompleteRecord(err error) bool {
+	return errors.Is(err, errIncompleteLength) || errors.Is(err, errIncompletePayload) ||
+		errors.Is(err, errIncompleteChecksum)
+}
+
+// decodeEntry decodes the [length][payload][checksum] record at the start of buf and returns
+// its payload and the length of the whole record.
+func decodeEntry(buf []byte) (payload []byte, recordLength int, err error) {
+	if len(buf) < 4 {
+		return nil, 0, errIncompleteLength
+	}
+	payloadLength := int(binary.BigEndian.Uint32(buf[0:4]))
+	if payloadLength > MaxPayloadLength {
+		return nil, 0, errLengthTooLarge
+	}
+	if len(buf) < 4+payloadLength {
+		return nil, 0, errIncompletePayload
+	}
+	if len(buf) < 4+payloadLength+4 {
+		return nil, 0, errIncompleteChecksum
+	}
+	payload = buf[4 : 4+payloadLength]
+	storedChecksum := binary.BigEndian.Uint32(buf[4+payloadLength : 4+payloadLength+4])
+	if storedChecksum != crc32.ChecksumIEEE(payload) {
+		return nil, 0, errChecksumMismatch
+	}
+	return payload, 4 + payloadLength + 4, nil
+}
+
+// returns the offset of the first good record starting after offset, -1 if there is none.
+// a length field can be corrupted as well, so every offset is tried till a record with a valid checksum is found.
+func nextGoodEntryOffset(buf []byte, offset int) int {
+	for ; offset < len(buf); offset++ {
+		if _, _, err := decodeEntry(buf[offset:]); err == nil {
+			return offset
+		}
+	}
+	return -1
+}
+
+// Replay reads every record from the start of the file and calls fn with its payload.
+// records which can't be read are handled as per the recovery mode.
+func (w *Wal) Replay(mode RecoveryMode, fn func(payload []byte) error) (RecoveryReport, error) {
+	report := RecoveryReport{}
+	if _, err := w.file.Seek(0, io.SeekStart); err != nil {
+		return report, err
+	}
+	buf, err := io.ReadAll(w.file)
+	if err != nil {
+		return report, err
+	}
+
+	offset := 0
+	for offset < len(buf) {
+		payload, recordLength, err := decodeEntry(buf[offset:])
+		if err == nil {
+			if err := fn(payload); err != nil {
+				return report, err
+			}
+			offset += recordLength
+			continue
+		}
+
+		nextOffset := -1
+		switch mode {
+		case RecoveryStrict:
+			return report, err
+		case RecoverySkipCorrupt:
+			nextOffset = nextGoodEntryOffset(buf, offset+1)
+		}
+		if nextOffset == -1 {
+			report.DroppedTailBytes = len(buf) - offset
+			slog.Warn("WAL_TAIL_TRUNCATED", "file_name", w.file.Name(), "offset", offset, "dropped_bytes", report.DroppedTailBytes, "reason", err.Error())
+			return report, truncateFile(w.file.Name(), offset)
+		}
+		report.SkippedRanges = append(report.SkippedRanges, SkippedRange{Offset: offset, Length: nextOffset - offset, Reason: err.Error()})
+		slog.Warn("WAL_CORRUPT_BYTES_SKIPPED", "file_name", w.file.Name(), "offset", offset, "skipped_bytes", nextOffset-offset, "reason", err.Error())
+		offset = nextOffset
+	}
+	return report, nil
+}
+
+func truncateFile(filePath string, size int) error {
+	file, err := os.OpenFile(filePath, os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := file.Truncate(int64(size)); err != nil {
+		return err
+	}
+	return file.Sync()
+}
@@ -0,0 +1,252 @@
+package wal
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncMode decides when the records written to the segments are fsynced.
+type SyncMode int
+
+const (
+	// SyncAlways fsyncs every write before it returns. an acknowledged write survives a machine crash.
+	SyncAlways SyncMode = iota
+	// SyncInterval fsyncs the active segment every Config.SyncInterval in the background.
+	// writes acknowledged in the last interval can be lost on a machine crash.
+	SyncInterval
+	// SyncNever leaves it to the OS to write the records to disk. writes survive a crash of the
+	// process but not of the machine.
+	SyncNever
+)
+
+const defaultSyncInterval = 10 * time.Millisecond
+
+type Config struct {
+	// SyncMode defaults to SyncAlways
+	SyncMode SyncMode
+	// SyncInterval is used only by SyncInterval mode. Defaults to 10ms.
+	SyncInterval time.Duration
+}
+
+// SegmentedWal splits the log into numbered segment files: <file_path>.<segment_id>.
+// records are only appended to the newest segment, called the active segment. Rotate starts a new
+// active segment, so the records of the older segments never change.
+// an older segment is removed once its records are persisted to some other storage,
+// typically once the memtable built from it is flushed to an sstable.
+type SegmentedWal struct {
+	mu              sync.Mutex // guards the active segment, it is shared with the background sync
+	filePath        string
+	activeSegment   *Wal
+	activeSegmentId int
+	config          Config
+	unsynced        bool // set when records are written to the active segment after its last fsync
+	stopSync        chan struct{}
+	syncWg          sync.WaitGroup
+}
+
+var ErrActiveSegment = errors.New("the active wal segment can't be removed")
+
+// NewSegmentedWal opens the segments of the wal at filePath and appends new records to the newest one.
+// a single wal file at filePath written by older versions becomes the newest segment.
+// If empty filePath is provided, segments are created at the default location: "wal.log.<segment_id>"
+func NewSegmentedWal(filePath string, config Config) (*SegmentedWal, error) {
+	if filePath == "" {
+		filePath = defaultWalPath
+	}
+	if config.SyncInterval == 0 {
+		config.SyncInterval = defaultSyncInterval
+	}
+	s := SegmentedWal{filePath: filePath, config: config}
+	segmentIds, err := s.SegmentIds()
+	if err != nil {
+		return nil, err
+	}
+	nextSegmentId := 0
+	if len(segmentIds) > 0 {
+		nextSegmentId = segmentIds[len(segmentIds)-1] + 1
+	}
+
+	if fileInfo, err := os.Stat(filePath); err == nil && fileInfo.Mode().IsRegular() {
+		if err := os.Rename(filePath, s.segmentFilePath(nextSegmentId)); err != nil {
+			return nil, err
+		}
+		slog.Info("WAL_FILE_MIGRATED_TO_SEGMENT", "file_name", filePath, "segment_id", nextSegmentId)
+		segmentIds = append(segmentIds, nextSegmentId)
+	}
+	if len(segmentIds) == 0 {
+		segmentIds = append(segmentIds, nextSegmentId)
+	}
+
+	s.activeSegmentId = segmentIds[len(segmentIds)-1]
+	s.activeSegment, err = NewWal(s.segmentFilePath(s.activeSegmentId))
+	if err != nil {
+		return nil, err
+	}
+	if config.SyncMode == SyncInterval {
+		s.stopSync = make(chan struct{})
+		s.syncWg.Add(1)
+		go s.syncLoop()
+	}
+	return &s, nil
+}
+
+func (s *SegmentedWal) segmentFilePath(segmentId int) string {
+	return fmt.Sprintf("%s.%d", s.filePath, segmentId)
+}
+
+// SegmentIds returns the ids of the segments present on disk, ordered from the oldest to the newest segment.
+func (s *SegmentedWal) SegmentIds() ([]int, error) {
+	matches, err := filepath.Glob(s.filePath + ".*")
+	if err != nil {
+		return nil, err
+	}
+	segmentIds := []int{}
+	for _, match := range matches {
+		segmentId, err := strconv.Atoi(strings.TrimPrefix(match, s.filePath+"."))
+		if err != nil || segmentId < 0 {
+			continue
+		}
+		segmentIds = append(segmentIds, segmentId)
+	}
+	sort.Ints(segmentIds)
+	return segmentIds, nil
+}
+
+// ActiveSegmentId returns the id of the segment which new records are appended to.
+func (s *SegmentedWal) ActiveSegmentId() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.activeSegmentId
+}
+
+// WriteEntry appends the record to the active segment.
+func (s *SegmentedWal) WriteEntry(payload []byte) error {
+	return s.WriteEntries([][]byte{payload})
+}
+
+// WriteEntries appends the records to the active segment with a single write. with SyncAlways the
+// records share one fsync, so a group of concurrent writes costs a single fsync.
+// none of the records is written if any of them is longer than MaxPayloadLength.
+func (s *SegmentedWal) WriteEntries(payloads [][]byte) error {
+	buf := []byte{}
+	for _, payload := range payloads {
+		if err := checkPayloadLength(payload); err != nil {
+			return err
+		}
+		buf = encodeEntry(buf, payload)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.activeSegment.file.Write(buf); err != nil {
+		slog.Error("WAL_WRITE_FAILED", "error", err.Error())
+		return err
+	}
+	switch s.config.SyncMode {
+	case SyncAlways:
+		return s.activeSegment.file.Sync()
+	case SyncInterval:
+		s.unsynced = true
+	}
+	return nil
+}
+
+// syncLoop fsyncs the active segment every sync interval if anything was written to it.
+func (s *SegmentedWal) syncLoop() {
+	defer s.syncWg.Done()
+	ticker := time.NewTicker(s.config.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopSync:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.unsynced {
+				if err := s.activeSegment.file.Sync(); err != nil {
+					slog.Error("WAL_SYNC_FAILED", "segment_id", s.activeSegmentId, "error", err.Error())
+				} else {
+					s.unsynced = false
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// Rotate starts a new active segment and returns its id. every record written so far
+// stays in the older segments.
+func (s *SegmentedWal) Rotate() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// the records of an older segment are never synced by the background sync
+	if s.config.SyncMode == SyncInterval && s.unsynced {
+		if err := s.activeSegment.file.Sync(); err != nil {
+			return 0, err
+		}
+		s.unsynced = false
+	}
+	newSegmentId := s.activeSegmentId + 1
+	newSegment, err := NewWal(s.segmentFilePath(newSegmentId))
+	if err != nil {
+		return 0, err
+	}
+	// the new segment must survive a crash, else the records written to it would be lost
+	if err := syncDirectory(filepath.Dir(s.filePath)); err != nil {
+		newSegment.Close()
+		return 0, err
+	}
+	s.activeSegment.Close()
+	s.activeSegment = newSegment
+	s.activeSegmentId = newSegmentId
+	return newSegmentId, nil
+}
+
+// NewSegmentReader opens the segment for reading its records from the start.
+func (s *SegmentedWal) NewSegmentReader(segmentId int) (*Wal, error) {
+	file, err := os.Open(s.segmentFilePath(segmentId))
+	if err != nil {
+		slog.Error("WAL_SEGMENT_OPEN_FAILED", "segment_id", segmentId, "error", err.Error())
+		return nil, err
+	}
+	return &Wal{file: file}, nil
+}
+
+// RemoveSegment deletes a segment whose records are persisted to some other storage.
+func (s *SegmentedWal) RemoveSegment(segmentId int) error {
+	if segmentId == s.ActiveSegmentId() {
+		return ErrActiveSegment
+	}
+	return os.Remove(s.segmentFilePath(segmentId))
+}
+
+// Close stops the background sync and closes the active segment. the records written since the last
+// fsync are synced unless the sync mode is SyncNever.
+func (s *SegmentedWal) Close() {
+	if s.stopSync != nil {
+		close(s.stopSync)
+		s.syncWg.Wait()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.unsynced {
+		s.activeSegment.file.Sync()
+	}
+	s.activeSegment.Close()
+}
+
+func syncDirectory(directory string) error {
+	dir, err := os.Open(directory)
+	if err != nil {
+		return err
+	}
+	defer dir.Close()
+	return dir.Sync()
+}
@@ -0,0 +1,128 @@
+package wal
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readSegment(t *testing.T, s *SegmentedWal, segmentId int) []string {
+	reader, err := s.NewSegmentReader(segmentId)
+	require.NoError(t, err)
+	defer reader.Close()
+	payloads := []string{}
+	for {
+		payload, err := reader.ReadEntry()
+		if err == io.EOF {
+			return payloads
+		}
+		require.NoError(t, err)
+		payloads = append(payloads, string(payload))
+	}
+}
+
+func TestSegmentedWal_RotateStartsNewSegment(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "wal.log")
+	s, err := NewSegmentedWal(filePath, Config{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, s.ActiveSegmentId())
+	require.NoError(t, s.WriteEntry([]byte("PUT key_0")))
+
+	segmentId, err := s.Rotate()
+	require.NoError(t, err)
+	assert.Equal(t, 1, segmentId)
+	require.NoError(t, s.WriteEntry([]byte("PUT key_1")))
+	assert.Equal(t, []string{"PUT key_0"}, readSegment(t, s, 0))
+	assert.Equal(t, []string{"PUT key_1"}, readSegment(t, s, 1))
+
+	assert.ErrorIs(t, s.RemoveSegment(1), ErrActiveSegment)
+	require.NoError(t, s.RemoveSegment(0))
+	assert.NoFileExists(t, filePath+".0")
+	s.Close()
+
+	// writes continue in the newest segment after a restart
+	reopened, err := NewSegmentedWal(filePath, Config{})
+	require.NoError(t, err)
+	defer reopened.Close()
+	segmentIds, err := reopened.SegmentIds()
+	require.NoError(t, err)
+	assert.Equal(t, []int{1}, segmentIds)
+	require.NoError(t, reopened.WriteEntry([]byte("PUT key_2")))
+	assert.Equal(t, []string{"PUT key_1", "PUT key_2"}, readSegment(t, reopened, 1))
+}
+
+func TestSegmentedWal_SegmentIdsAreNumericallyOrdered(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "wal.log")
+	for _, segmentId := range []int{10, 2, 9} {
+		require.NoError(t, os.WriteFile(fmt.Sprintf("%s.%d", filePath, segmentId), nil, 0644))
+	}
+	require.NoError(t, os.WriteFile(filePath+".tmp", nil, 0644))
+
+	s, err := NewSegmentedWal(filePath, Config{})
+	require.NoError(t, err)
+	defer s.Close()
+	segmentIds, err := s.SegmentIds()
+	require.NoError(t, err)
+	assert.Equal(t, []int{2, 9, 10}, segmentIds)
+	assert.Equal(t, 10, s.ActiveSegmentId())
+}
+
+func TestSegmentedWal_SingleWalFileBecomesNewestSegment(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "wal.log")
+	older, err := NewWal(filePath + ".3")
+	require.NoError(t, err)
+	require.NoError(t, older.WriteEntry([]byte("PUT older")))
+	older.Close()
+	legacy, err := NewWal(filePath)
+	require.NoError(t, err)
+	require.NoError(t, legacy.WriteEntry([]byte("PUT newer")))
+	legacy.Close()
+
+	s, err := NewSegmentedWal(filePath, Config{})
+	require.NoError(t, err)
+	defer s.Close()
+	assert.NoFileExists(t, filePath)
+	assert.Equal(t, 4, s.ActiveSegmentId())
+	assert.Equal(t, []string{"PUT older"}, readSegment(t, s, 3))
+	assert.Equal(t, []string{"PUT newer"}, readSegment(t, s, 4))
+}
+
+func TestSegmentedWal_WriteEntriesInEverySyncMode(t *testing.T) {
+	for _, syncMode := range []SyncMode{SyncAlways, SyncInterval, SyncNever} {
+		t.Run(fmt.Sprintf("sync mode %d", syncMode), func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "wal.log")
+			s, err := NewSegmentedWal(filePath, Config{SyncMode: syncMode, SyncInterval: time.Millisecond})
+			require.NoError(t, err)
+			require.NoError(t, s.WriteEntries([][]byte{[]byte("PUT key_0"), []byte("PUT key_1")}))
+			require.NoError(t, s.WriteEntry([]byte("PUT key_2")))
+			// gives the background sync a chance to run along with the writes
+			time.Sleep(5 * time.Millisecond)
+			require.NoError(t, s.WriteEntry([]byte("PUT key_3")))
+			s.Close()
+
+			reopened, err := NewSegmentedWal(filePath, Config{SyncMode: syncMode})
+			require.NoError(t, err)
+			defer reopened.Close()
+			assert.Equal(t, []string{"PUT key_0", "PUT key_1", "PUT key_2", "PUT key_3"}, readSegment(t, reopened, 0))
+		})
+	}
+}
+
+func TestSegmentedWal_WriteEntriesRejectsPayloadLongerThanMax(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "wal.log")
+	s, err := NewSegmentedWal(filePath, Config{})
+	require.NoError(t, err)
+	defer s.Close()
+	largestPayload := make([]byte, MaxPayloadLength)
+
+	err = s.WriteEntries([][]byte{[]byte("PUT key_0"), make([]byte, MaxPayloadLength+1)})
+	assert.ErrorIs(t, err, ErrPayloadTooLarge)
+	require.NoError(t, s.WriteEntries([][]byte{[]byte("PUT key_1"), largestPayload}))
+	assert.Equal(t, []string{"PUT key_1", string(largestPayload)}, readSegment(t, s, 0))
+}
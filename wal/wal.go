@@ -2,7 +2,7 @@ package wal
 
 import (
 	"encoding/binary"
-	"errors"
+	"fmt"
 	"hash/crc32"
 	"io"
 	"log/slog"
@@ -19,21 +19,35 @@ type Wal struct {
 
 // WriteEntry writes [length][payload][checksum] to file
 func (w *Wal) WriteEntry(payload []byte) error {
-	buf := make([]byte, 4+len(payload)+4)
-	checksum := crc32.ChecksumIEEE([]byte(payload))
-	// 1. add length
-	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
-	// 2. add payload
-	copy(buf[4:4+len(payload)], []byte(payload))
-	// 3. add checksum
-	binary.BigEndian.PutUint32(buf[4+len(payload):], checksum)
-	if _, err := w.file.Write(buf); err != nil {
+	if err := checkPayloadLength(payload); err != nil {
+		return err
+	}
+	if _, err := w.file.Write(encodeEntry(nil, payload)); err != nil {
 		slog.Error("WAL_WRITE_FAILED", "error", err.Error())
 		return err
 	}
 	return w.file.Sync()
 }
 
+// a record is only written if it can be read back.
+func checkPayloadLength(payload []byte) error {
+	if len(payload) > MaxPayloadLength {
+		return fmt.Errorf("%w: %d bytes", ErrPayloadTooLarge, len(payload))
+	}
+	return nil
+}
+
+// encodeEntry appends [length][payload][checksum] to buf
+func encodeEntry(buf []byte, payload []byte) []byte {
+	checksum := crc32.ChecksumIEEE(payload)
+	// 1. add length
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(payload)))
+	// 2. add payload
+	buf = append(buf, payload...)
+	// 3. add checksum
+	return binary.BigEndian.AppendUint32(buf, checksum)
+}
+
 // Close closes the walFile
 func (w *Wal) Close() {
 	w.file.Close()
@@ -48,7 +62,7 @@ func (w *Wal) ReadEntry() (payload []byte, err error) {
 		return nil, io.EOF
 	}
 	if err == io.ErrUnexpectedEOF {
-		return nil, errors.New("partial write: incomplete length")
+		return nil, errIncompleteLength
 	}
 	if err != nil {
 		return nil, err
@@ -57,15 +71,15 @@ func (w *Wal) ReadEntry() (payload []byte, err error) {
 	payloadLength := binary.BigEndian.Uint32(lengthBuf)
 
 	// 3. Sanity Check
-	if payloadLength > 1_000_000 { // 1 MB max
-		return nil, errors.New("corrupt: length too large")
+	if payloadLength > MaxPayloadLength {
+		return nil, errLengthTooLarge
 	}
 
 	// 4. Read payload
 	payload = make([]byte, payloadLength)
 	_, err = io.ReadFull(w.file, payload)
-	if err == io.ErrUnexpectedEOF {
-		return nil, errors.New("partial write: incomplete payload")
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return nil, errIncompletePayload
 	}
 	if err != nil {
 		return nil, err
@@ -74,8 +88,8 @@ func (w *Wal) ReadEntry() (payload []byte, err error) {
 	// 5. Read checksum
 	checksumBuf := make([]byte, 4)
 	_, err = io.ReadFull(w.file, checksumBuf)
-	if err == io.ErrUnexpectedEOF {
-		return nil, errors.New("partial write: incomplete checksum")
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		return nil, errIncompleteChecksum
 	}
 	if err != nil {
 		return nil, err
@@ -85,20 +99,12 @@ func (w *Wal) ReadEntry() (payload []byte, err error) {
 	storedChecksum := binary.BigEndian.Uint32(checksumBuf)
 	computedChecksum := crc32.ChecksumIEEE(payload)
 	if storedChecksum != computedChecksum {
-		return nil, errors.New("corrupt: checksum mismatch")
+		return nil, errChecksumMismatch
 	}
 
 	return payload, err
 }
 
-// Clear clears the content in the wal file
-// It is typically used when the data is persisted to some other persistent storage
-// which is faster for retrieval, typically disk IO
-func (w *Wal) Clear() {
-	w.file.Truncate(0)
-	w.file.Seek(0, 0)
-}
-
 // NewWal creates a new instance of Wal which can be utilised in any DB.
 // If empty filePath is provided, reads and writes will happen from default location: "wal.log"
 func NewWal(filePath string) (*Wal, error) {
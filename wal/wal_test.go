@@ -3,9 +3,11 @@ package wal
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 // TestWal_WriteAndReadSingleEntry
@@ -149,23 +151,139 @@ func TestWal_CorruptedWrites(t *testing.T) {
 	}
 }
 
-func TestWal_Clear(t *testing.T) {
-	defer os.Remove(tempWalFile)
-	walWrite, err := NewWal(tempWalFile)
-	assert.NoError(t, err)
+// writes the records and returns the offset at which each record starts followed by the file size
+func writeRecordsForRecoveryTest(t *testing.T, filePath string, payloads ...string) []int {
+	w, err := NewWal(filePath)
+	require.NoError(t, err)
+	defer w.Close()
+	offsets := []int{0}
+	for _, payload := range payloads {
+		require.NoError(t, w.WriteEntry([]byte(payload)))
+		offsets = append(offsets, offsets[len(offsets)-1]+4+len(payload)+4)
+	}
+	return offsets
+}
 
-	payload := "PUT key value"
-	err = walWrite.WriteEntry([]byte(payload))
-	assert.NoError(t, err)
+func replayForRecoveryTest(t *testing.T, filePath string, mode RecoveryMode) ([]string, RecoveryReport, error) {
+	w, err := NewWal(filePath)
+	require.NoError(t, err)
+	defer w.Close()
+	payloads := []string{}
+	report, err := w.Replay(mode, func(payload []byte) error {
+		payloads = append(payloads, string(payload))
+		return nil
+	})
+	return payloads, report, err
+}
 
-	walRead, err := NewWal(tempWalFile)
-	assert.NoError(t, err)
+func corruptByte(t *testing.T, filePath string, offset int) {
+	file, err := os.OpenFile(filePath, os.O_RDWR, 0644)
+	require.NoError(t, err)
+	defer file.Close()
+	b := make([]byte, 1)
+	_, err = file.ReadAt(b, int64(offset))
+	require.NoError(t, err)
+	_, err = file.WriteAt([]byte{b[0] ^ 0xff}, int64(offset))
+	require.NoError(t, err)
+}
+
+func TestWal_ReplayStrictFailsOnTornTailAndCorruption(t *testing.T) {
+	tornTailFilePath := filepath.Join(t.TempDir(), "torn.log")
+	offsets := writeRecordsForRecoveryTest(t, tornTailFilePath, "PUT key_0", "PUT key_1")
+	require.NoError(t, os.Truncate(tornTailFilePath, int64(offsets[2]-2)))
+	payloads, _, err := replayForRecoveryTest(t, tornTailFilePath, RecoveryStrict)
+	assert.EqualError(t, err, "partial write: incomplete checksum")
+	assert.Equal(t, []string{"PUT key_0"}, payloads)
+	// the file is left as it is
+	fileInfo, err := os.Stat(tornTailFilePath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(offsets[2]-2), fileInfo.Size())
+
+	corruptFilePath := filepath.Join(t.TempDir(), "corrupt.log")
+	offsets = writeRecordsForRecoveryTest(t, corruptFilePath, "PUT key_0", "PUT key_1", "PUT key_2")
+	corruptByte(t, corruptFilePath, offsets[1]+6)
+	_, _, err = replayForRecoveryTest(t, corruptFilePath, RecoveryStrict)
+	assert.EqualError(t, err, "corrupt: checksum mismatch")
+}
+
+func TestWal_ReplayTolerateTailTruncatesTornTail(t *testing.T) {
+	testCases := []struct {
+		name         string
+		truncateSize int // bytes of the last record which were written before the crash
+	}{
+		{name: "incomplete length", truncateSize: 2},
+		{name: "incomplete payload", truncateSize: 7},
+		{name: "incomplete checksum", truncateSize: 15},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "wal.log")
+			offsets := writeRecordsForRecoveryTest(t, filePath, "PUT key_0", "PUT key_1", "PUT key_2")
+			require.NoError(t, os.Truncate(filePath, int64(offsets[2]+tt.truncateSize)))
+
+			payloads, report, err := replayForRecoveryTest(t, filePath, RecoveryTolerateTail)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"PUT key_0", "PUT key_1"}, payloads)
+			assert.Equal(t, tt.truncateSize, report.DroppedTailBytes)
+			assert.Empty(t, report.SkippedRanges)
+
+			// the torn tail is gone, new records are appended right after the last good record
+			writeRecordsForRecoveryTest(t, filePath, "PUT key_3")
+			payloads, _, err = replayForRecoveryTest(t, filePath, RecoveryStrict)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"PUT key_0", "PUT key_1", "PUT key_3"}, payloads)
+		})
+	}
+}
+
+func TestWal_ReplayTolerateTailDropsEverythingAfterCorruption(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "wal.log")
+	offsets := writeRecordsForRecoveryTest(t, filePath, "PUT key_0", "PUT key_1", "PUT key_2")
+	corruptByte(t, filePath, offsets[1]+6)
+
+	payloads, report, err := replayForRecoveryTest(t, filePath, RecoveryTolerateTail)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"PUT key_0"}, payloads)
+	assert.Equal(t, offsets[3]-offsets[1], report.DroppedTailBytes)
+}
+
+func TestWal_ReplaySkipCorruptSkipsBadRecords(t *testing.T) {
+	testCases := []struct {
+		name          string
+		corruptOffset int // offset within the second record
+		reason        string
+	}{
+		{name: "corrupted payload", corruptOffset: 6, reason: "corrupt: checksum mismatch"},
+		{name: "corrupted checksum", corruptOffset: 14, reason: "corrupt: checksum mismatch"},
+		{name: "corrupted length", corruptOffset: 0, reason: "corrupt: length too large"},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "wal.log")
+			offsets := writeRecordsForRecoveryTest(t, filePath, "PUT key_0", "PUT key_1", "PUT key_2", "PUT key_3")
+			corruptByte(t, filePath, offsets[1]+tt.corruptOffset)
+
+			payloads, report, err := replayForRecoveryTest(t, filePath, RecoverySkipCorrupt)
+			require.NoError(t, err)
+			assert.Equal(t, []string{"PUT key_0", "PUT key_2", "PUT key_3"}, payloads)
+			assert.Equal(t, []SkippedRange{{Offset: offsets[1], Length: offsets[2] - offsets[1], Reason: tt.reason}}, report.SkippedRanges)
+			assert.Equal(t, 0, report.DroppedTailBytes)
+		})
+	}
+}
 
-	readPayload, err := walRead.ReadEntry()
-	assert.Equal(t, payload, string(readPayload))
+func TestWal_ReplaySkipCorruptTruncatesTornTail(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "wal.log")
+	offsets := writeRecordsForRecoveryTest(t, filePath, "PUT key_0", "PUT key_1", "PUT key_2")
+	corruptByte(t, filePath, offsets[0]+6)
+	require.NoError(t, os.Truncate(filePath, int64(offsets[3]-1)))
 
-	walReadAfterClear, err := NewWal(tempWalFile)
-	walReadAfterClear.Clear()
-	readPayload, err = walReadAfterClear.ReadEntry()
-	assert.Equal(t, "EOF", err.Error())
+	payloads, report, err := replayForRecoveryTest(t, filePath, RecoverySkipCorrupt)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"PUT key_1"}, payloads)
+	require.Len(t, report.SkippedRanges, 1)
+	assert.Equal(t, offsets[3]-1-offsets[2], report.DroppedTailBytes)
+	fileInfo, err := os.Stat(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, int64(offsets[2]), fileInfo.Size())
 }